@@ -0,0 +1,22 @@
+//go:build !headless
+
+package main
+
+import (
+	"log"
+
+	"github.com/barishamil/kde-connect-fyne/internal/core"
+	"github.com/barishamil/kde-connect-fyne/internal/ui"
+)
+
+const hasGUI = true
+
+// runGUI shows the app until it quits.
+func runGUI(engine *core.Engine) {
+	app := ui.NewApp(engine)
+
+	engine.Start()
+
+	log.Printf("KDE Connect client started with ID %s\n", engine.Identity.DeviceId)
+	app.Run()
+}
@@ -0,0 +1,17 @@
+//go:build headless
+
+package main
+
+import (
+	"log"
+
+	"github.com/barishamil/kde-connect-fyne/internal/core"
+)
+
+// Built with -tags headless there's no Fyne (and no cgo or display libraries
+// it needs), so servers can build it; -headless is then the default.
+const hasGUI = false
+
+func runGUI(engine *core.Engine) {
+	log.Fatal("This build has no GUI; run it with -headless")
+}
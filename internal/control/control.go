@@ -0,0 +1,282 @@
+// Package control lets the engine be driven without the GUI, over a local
+// socket that takes one command per line and answers each with a JSON line.
+package control
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/barishamil/kde-connect-fyne/internal/core"
+	"github.com/barishamil/kde-connect-fyne/internal/network"
+)
+
+const usage = `commands:
+  devices                  list discovered and paired devices
+  connections              list active connections and their transport
+  stats                    show connection and transfer counters
+  pair <id>                request pairing, prints the verification key
+  accept <id>              accept a pending pair request
+  reject <id>              ignore a pending pair request
+  unpair <id>              forget a paired device
+  ping <id> [message]      send a ping
+  send <id> <path>         send a file
+  mount <id>               serve the device's files over WebDAV`
+
+type Server struct {
+	Engine *core.Engine
+	// Trusted holds certificate fingerprints (hex SHA-256) whose pair
+	// requests are accepted without asking.
+	Trusted map[string]bool
+
+	mu      sync.Mutex
+	pending map[string]core.PairRequest
+	webdav  map[string]*network.WebDAVServer
+}
+
+type response struct {
+	OK     bool        `json:"ok"`
+	Result interface{} `json:"result,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+type deviceInfo struct {
+	Id      string `json:"id"`
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Address string `json:"address,omitempty"`
+	Paired  bool   `json:"paired"`
+	Online  bool   `json:"online"`
+}
+
+func NewServer(engine *core.Engine, trusted []string) *Server {
+	s := &Server{
+		Engine:  engine,
+		Trusted: make(map[string]bool),
+		pending: make(map[string]core.PairRequest),
+		webdav:  make(map[string]*network.WebDAVServer),
+	}
+	for _, fp := range trusted {
+		s.Trusted[strings.ToLower(strings.ReplaceAll(fp, ":", ""))] = true
+	}
+
+	engine.Events.On("pair_request", func(data interface{}) {
+		if req, ok := data.(core.PairRequest); ok {
+			s.handlePairRequest(req)
+		}
+	})
+	engine.Events.On("pairing_changed", func(data interface{}) {
+		if deviceId, ok := data.(string); ok {
+			s.mu.Lock()
+			delete(s.pending, deviceId)
+			s.mu.Unlock()
+		}
+	})
+	return s
+}
+
+// Listen opens a Unix socket at path that only the current user can use,
+// replacing one left behind by an earlier run.
+func Listen(path string) (net.Listener, error) {
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("%s is in use by another instance", path)
+	}
+	os.Remove(path)
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Serve accepts clients until l is closed.
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go s.handleClient(conn)
+	}
+}
+
+// Close stops any WebDAV bridges started by mount.
+func (s *Server) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, srv := range s.webdav {
+		srv.Stop()
+		delete(s.webdav, id)
+	}
+}
+
+func (s *Server) handlePairRequest(req core.PairRequest) {
+	deviceId := req.Identity.DeviceId
+	if (req.Fingerprint != "" && s.Trusted[req.Fingerprint]) || s.Engine.AutoPairAllowed(deviceId, req.Fingerprint) {
+		fmt.Printf("Accepting pair request from trusted device %s (%s), verification key %s\n", req.Identity.DeviceName, deviceId, req.VerificationKey)
+		s.Engine.AcceptPair(deviceId)
+		s.Engine.MarkAsPaired(deviceId)
+		return
+	}
+
+	s.mu.Lock()
+	s.pending[deviceId] = req
+	s.mu.Unlock()
+
+	fmt.Printf("Pair request from %s (%s)\n", req.Identity.DeviceName, deviceId)
+	fmt.Printf("  verification key: %s\n", req.VerificationKey)
+	fmt.Printf("  certificate: %s\n", req.Fingerprint)
+	fmt.Printf("  run \"accept %s\" on the control socket to pair\n", deviceId)
+}
+
+func (s *Server) handleClient(conn net.Conn) {
+	defer conn.Close()
+
+	enc := json.NewEncoder(conn)
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		cmd, rest, _ := strings.Cut(strings.TrimSpace(scanner.Text()), " ")
+		if cmd == "" {
+			continue
+		}
+
+		result, err := s.run(cmd, strings.TrimSpace(rest))
+		resp := response{OK: err == nil, Result: result}
+		if err != nil {
+			resp.Error = err.Error()
+		}
+		if err := enc.Encode(resp); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) run(cmd, args string) (interface{}, error) {
+	if cmd == "devices" {
+		return s.devices(), nil
+	}
+	if cmd == "connections" {
+		return s.Engine.GetActiveConnections(), nil
+	}
+	if cmd == "stats" {
+		return s.Engine.Stats(), nil
+	}
+	if cmd == "help" {
+		return usage, nil
+	}
+
+	deviceId, arg, _ := strings.Cut(args, " ")
+	if deviceId == "" {
+		return nil, fmt.Errorf("%s: missing device id", cmd)
+	}
+	arg = strings.TrimSpace(arg)
+
+	switch cmd {
+	case "pair":
+		key, err := s.Engine.Pair(deviceId)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]string{"verificationKey": key}, nil
+	case "accept", "reject":
+		s.mu.Lock()
+		_, ok := s.pending[deviceId]
+		delete(s.pending, deviceId)
+		s.mu.Unlock()
+		if !ok {
+			return nil, fmt.Errorf("no pending pair request from %s", deviceId)
+		}
+		if cmd == "accept" {
+			s.Engine.AcceptPair(deviceId)
+			s.Engine.MarkAsPaired(deviceId)
+		}
+		return nil, nil
+	case "unpair":
+		return nil, s.Engine.Unpair(deviceId)
+	case "ping":
+		return nil, s.Engine.SendPing(deviceId, arg)
+	case "send":
+		if arg == "" {
+			return nil, errors.New("send: missing path")
+		}
+		return nil, s.Engine.SendFile(context.Background(), deviceId, arg, nil)
+	case "mount":
+		srv, err := s.mount(deviceId)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]string{"url": srv.URL().String()}, nil
+	}
+	return nil, fmt.Errorf("unknown command %q, try \"help\"", cmd)
+}
+
+func (s *Server) devices() []deviceInfo {
+	var list []deviceInfo
+	seen := make(map[string]bool)
+	for _, dev := range s.Engine.GetDiscoveredDevices() {
+		info := deviceInfo{
+			Id:     dev.Identity.DeviceId,
+			Name:   dev.Identity.DeviceName,
+			Type:   dev.Identity.DeviceType,
+			Paired: s.Engine.IsPaired(dev.Identity.DeviceId),
+			Online: s.Engine.IsOnline(dev.Identity.DeviceId),
+		}
+		if dev.Addr != nil {
+			info.Address = dev.Addr.String()
+		}
+		list = append(list, info)
+		seen[info.Id] = true
+	}
+	for _, dev := range s.Engine.GetPairedDevices() {
+		if seen[dev.Identity.DeviceId] {
+			continue
+		}
+		list = append(list, deviceInfo{
+			Id:     dev.Identity.DeviceId,
+			Name:   dev.Identity.DeviceName,
+			Type:   dev.Identity.DeviceType,
+			Paired: true,
+		})
+	}
+	return list
+}
+
+func (s *Server) mount(deviceId string) (*network.WebDAVServer, error) {
+	s.mu.Lock()
+	srv, ok := s.webdav[deviceId]
+	s.mu.Unlock()
+	if ok {
+		return srv, nil
+	}
+
+	client, err := s.Engine.ConnectSFTP(deviceId)
+	if err != nil {
+		return nil, err
+	}
+	offer, _ := s.Engine.GetSftpOffer(deviceId)
+
+	srv = network.NewWebDAVServer(client, offer.Path)
+	if err := srv.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start WebDAV bridge: %w", err)
+	}
+
+	s.mu.Lock()
+	s.webdav[deviceId] = srv
+	s.mu.Unlock()
+	return srv, nil
+}
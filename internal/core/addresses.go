@@ -0,0 +1,183 @@
+package core
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/barishamil/kde-connect-fyne/internal/network"
+)
+
+// maxCandidateAddrs caps how many addresses are remembered per device, and
+// so how many getOrConnect tries.
+const maxCandidateAddrs = 4
+
+// Connecting gives each address a short chance, within an overall budget.
+const (
+	connectAttemptTimeout = 3 * time.Second
+	connectTotalTimeout   = 10 * time.Second
+)
+
+// addrRank orders addresses by how likely they are to reach the device, lower
+// being better. Bluetooth connections report a placeholder 0.0.0.0.
+func addrRank(addr *net.UDPAddr) int {
+	switch {
+	case addr == nil || addr.IP == nil || addr.IP.IsUnspecified() || addr.IP.IsLoopback():
+		return 4
+	case addr.IP.IsLinkLocalUnicast():
+		return 3
+	case addr.IP.To4() != nil && addr.IP.IsPrivate():
+		return 0
+	case addr.IP.To4() != nil:
+		return 1
+	default:
+		return 2
+	}
+}
+
+func isPlaceholderAddr(addr *net.UDPAddr) bool {
+	return addrRank(addr) == 4
+}
+
+// splitZone splits an IPv6 zone such as the %en0 in fe80::1%en0 off ip, and
+// the brackets around it, as in [fe80::1%en0], if there are any.
+func splitZone(ip string) (host, zone string) {
+	if strings.HasPrefix(ip, "[") && strings.HasSuffix(ip, "]") {
+		ip = ip[1 : len(ip)-1]
+	}
+	host, zone, _ = strings.Cut(ip, "%")
+	return host, zone
+}
+
+// parseIP parses ip, ignoring its zone, or returns nil if it isn't an IP
+// address.
+func parseIP(ip string) net.IP {
+	host, _ := splitZone(ip)
+	return net.ParseIP(host)
+}
+
+// resolveAddr returns ip and port as an address, or the placeholder 0.0.0.0
+// if ip isn't an IP address, so a device's Addr is never nil. Host names
+// aren't looked up.
+func resolveAddr(ip string, port int) *net.UDPAddr {
+	host, zone := splitZone(ip)
+	parsed := net.ParseIP(host)
+	if parsed == nil {
+		return &net.UDPAddr{IP: net.IPv4zero, Port: port}
+	}
+	return &net.UDPAddr{IP: parsed, Port: port, Zone: zone}
+}
+
+// mergeCandidates returns candidates with addr moved to the front (most
+// recent first). Placeholder addresses aren't remembered.
+func mergeCandidates(candidates []*net.UDPAddr, addr *net.UDPAddr) []*net.UDPAddr {
+	if isPlaceholderAddr(addr) {
+		return candidates
+	}
+	merged := []*net.UDPAddr{addr}
+	for _, c := range candidates {
+		if !c.IP.Equal(addr.IP) || c.Port != addr.Port {
+			merged = append(merged, c)
+		}
+	}
+	if len(merged) > maxCandidateAddrs {
+		merged = merged[:maxCandidateAddrs]
+	}
+	return merged
+}
+
+// bestAddr picks the preferred candidate, the most recent one on ties, or
+// nil if there are none.
+func bestAddr(candidates []*net.UDPAddr) *net.UDPAddr {
+	if len(candidates) == 0 {
+		return nil
+	}
+	return slices.MinFunc(candidates, func(a, b *net.UDPAddr) int {
+		return addrRank(a) - addrRank(b)
+	})
+}
+
+// connectCandidates lists the addresses to try connecting to the device at,
+// most recently seen first, falling back to the last address it was paired at.
+func (e *Engine) connectCandidates(deviceId string) []*net.UDPAddr {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	var addrs []*net.UDPAddr
+	if dev, ok := e.discoveredDevices[deviceId]; ok {
+		addrs = slices.Clone(dev.Candidates)
+		if len(addrs) == 0 && !isPlaceholderAddr(dev.Addr) {
+			addrs = append(addrs, dev.Addr)
+		}
+	}
+	if info, ok := e.pairedDevices[deviceId]; ok {
+		last := &net.UDPAddr{IP: net.ParseIP(info.LastIP), Port: info.LastPort}
+		if !isPlaceholderAddr(last) && last.Port != 0 && !slices.ContainsFunc(addrs, func(a *net.UDPAddr) bool {
+			return a.IP.Equal(last.IP) && a.Port == last.Port
+		}) {
+			addrs = append(addrs, last)
+		}
+	}
+	return addrs
+}
+
+// rememberAddr records the address a connection succeeded at as the paired
+// device's last known address.
+func (e *Engine) rememberAddr(deviceId string, addr *net.UDPAddr) {
+	e.mu.Lock()
+	changed := false
+	if info, ok := e.pairedDevices[deviceId]; ok && (info.LastIP != addr.IP.String() || info.LastPort != addr.Port) {
+		info.LastIP = addr.IP.String()
+		info.LastPort = addr.Port
+		e.pairedDevices[deviceId] = info
+		changed = true
+	}
+	e.mu.Unlock()
+
+	if changed {
+		e.scheduleSave()
+	}
+}
+
+// ConnectAddress connects to a device at a known address, for when discovery
+// can't find it (guest Wi-Fi, VLANs, VPNs). The connection is kept, ready for
+// pairing.
+func (e *Engine) ConnectAddress(ip string, port int) (DiscoveredDevice, error) {
+	conn, err := e.probe(ip, port)
+	if err != nil {
+		return DiscoveredDevice{}, err
+	}
+
+	if !e.handleNewConnection(conn) {
+		return DiscoveredDevice{}, ErrCertificateChanged
+	}
+	go conn.StartLoop()
+
+	e.mu.RLock()
+	dev := e.discoveredDevices[conn.DeviceId]
+	e.mu.RUnlock()
+
+	caps := dev.Identity.IncomingCapabilities
+	if len(caps) > 0 && !slices.Contains(caps, "kdeconnect.pair") {
+		return dev, fmt.Errorf("%s is reachable but doesn't accept pairing", dev.Identity.DeviceName)
+	}
+	return dev, nil
+}
+
+// probe connects and handshakes with whatever is at ip:port.
+func (e *Engine) probe(ip string, port int) (*network.Connection, error) {
+	conn, err := e.dial("", ip, port, connectAttemptTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't reach %s: %w", net.JoinHostPort(ip, fmt.Sprintf("%d", port)), err)
+	}
+	if conn.DeviceId == "" {
+		conn.Close()
+		return nil, fmt.Errorf("%s didn't identify itself as a KDE Connect device", ip)
+	}
+	if conn.RemoteIdentity.TcpPort == 0 {
+		conn.RemoteIdentity.TcpPort = port
+	}
+	return conn, nil
+}
@@ -0,0 +1,193 @@
+package core
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+func udpAddr(ip string, port int) *net.UDPAddr {
+	return &net.UDPAddr{IP: net.ParseIP(ip), Port: port}
+}
+
+func TestAddrRank(t *testing.T) {
+	// In order of preference
+	addrs := []*net.UDPAddr{
+		udpAddr("192.168.1.20", 1716),
+		udpAddr("203.0.113.5", 1716),
+		udpAddr("2001:db8::5", 1716),
+		udpAddr("fe80::1", 1716),
+		udpAddr("0.0.0.0", 1716),
+	}
+	for i := 1; i < len(addrs); i++ {
+		if addrRank(addrs[i-1]) >= addrRank(addrs[i]) {
+			t.Errorf("%v isn't preferred over %v", addrs[i-1], addrs[i])
+		}
+	}
+	for _, addr := range []*net.UDPAddr{nil, {}, udpAddr("0.0.0.0", 0), udpAddr("127.0.0.1", 1716), udpAddr("::", 1716)} {
+		if !isPlaceholderAddr(addr) {
+			t.Errorf("%v isn't a placeholder", addr)
+		}
+	}
+}
+
+func TestBestAddr(t *testing.T) {
+	tests := []struct {
+		name       string
+		candidates []*net.UDPAddr
+		want       *net.UDPAddr
+	}{
+		{"none", nil, nil},
+		{"LAN over link-local", []*net.UDPAddr{udpAddr("fe80::1", 1716), udpAddr("10.0.0.4", 1716)}, udpAddr("10.0.0.4", 1716)},
+		{"LAN over public", []*net.UDPAddr{udpAddr("203.0.113.5", 1716), udpAddr("172.16.0.9", 1716)}, udpAddr("172.16.0.9", 1716)},
+		{"IPv4 over IPv6", []*net.UDPAddr{udpAddr("2001:db8::5", 1716), udpAddr("203.0.113.5", 1716)}, udpAddr("203.0.113.5", 1716)},
+		{"most recent on ties", []*net.UDPAddr{udpAddr("192.168.1.20", 1716), udpAddr("192.168.1.21", 1716)}, udpAddr("192.168.1.20", 1716)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := bestAddr(tt.candidates)
+			if (got == nil) != (tt.want == nil) || got != nil && got.String() != tt.want.String() {
+				t.Fatalf("bestAddr = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeCandidates(t *testing.T) {
+	var candidates []*net.UDPAddr
+	for _, addr := range []*net.UDPAddr{
+		udpAddr("192.168.1.20", 1716),
+		udpAddr("0.0.0.0", 1716),
+		udpAddr("fe80::1", 1716),
+		udpAddr("192.168.1.20", 1716),
+		udpAddr("10.0.0.4", 1716),
+		udpAddr("10.0.0.5", 1716),
+		udpAddr("10.0.0.6", 1716),
+	} {
+		candidates = mergeCandidates(candidates, addr)
+	}
+
+	want := []string{"10.0.0.6:1716", "10.0.0.5:1716", "10.0.0.4:1716", "192.168.1.20:1716"}
+	if len(candidates) != len(want) {
+		t.Fatalf("candidates = %v, want %v", candidates, want)
+	}
+	for i, c := range candidates {
+		if c.String() != want[i] {
+			t.Fatalf("candidates = %v, want %v", candidates, want)
+		}
+	}
+}
+
+func TestDiscoveryKeepsLANAddress(t *testing.T) {
+	e := newTestEngine(t)
+	phone := testIdentity()
+
+	e.addDiscoveredDevice(phone, udpAddr("192.168.1.20", 1716))
+	e.addDiscoveredDevice(phone, udpAddr("fe80::1", 1716))
+	// Seen over Bluetooth last
+	e.addDiscoveredDevice(phone, udpAddr("0.0.0.0", 0))
+
+	e.mu.RLock()
+	dev, ok := e.discoveredDevices[phone.DeviceId]
+	e.mu.RUnlock()
+	if !ok {
+		t.Fatal("device not discovered")
+	}
+	if dev.Addr.String() != "192.168.1.20:1716" {
+		t.Errorf("Addr = %v, want the LAN address", dev.Addr)
+	}
+
+	e.mu.Lock()
+	e.pairedDevices[phone.DeviceId] = PairedDeviceInfo{Identity: phone, LastIP: "10.0.0.4", LastPort: 1716}
+	e.mu.Unlock()
+
+	got := e.connectCandidates(phone.DeviceId)
+	want := []string{"[fe80::1]:1716", "192.168.1.20:1716", "10.0.0.4:1716"}
+	if len(got) != len(want) {
+		t.Fatalf("connectCandidates = %v, want %v", got, want)
+	}
+	for i, c := range got {
+		if c.String() != want[i] {
+			t.Fatalf("connectCandidates = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestAddDeviceManualUnusableIP(t *testing.T) {
+	e := newTestEngine(t)
+	for _, ip := range []string{"", "not an ip", "example.invalid", "300.1.2.3", "192.168.1", "fe80::1::2", "%en0"} {
+		t.Run(ip, func(t *testing.T) {
+			phone := testIdentity()
+			e.AddDeviceManual(phone, ip, 1716)
+
+			e.mu.RLock()
+			dev := e.discoveredDevices[phone.DeviceId]
+			e.mu.RUnlock()
+			if !isPlaceholderAddr(dev.Addr) {
+				t.Fatalf("Addr = %v, want the placeholder", dev.Addr)
+			}
+			if got, ok := e.GetDeviceByIP(ip); ok {
+				t.Fatalf("GetDeviceByIP found %s", got.Identity.DeviceId)
+			}
+			if addrs := e.connectCandidates(phone.DeviceId); len(addrs) != 0 {
+				t.Fatalf("connectCandidates = %v", addrs)
+			}
+			if err := e.SendPing(phone.DeviceId, ""); !errors.Is(err, ErrDeviceNotFound) {
+				t.Fatalf("SendPing = %v, want ErrDeviceNotFound", err)
+			}
+		})
+	}
+}
+
+func TestGetDeviceByIP(t *testing.T) {
+	e := newTestEngine(t)
+	devices := make(map[string]string)
+	for _, ip := range []string{"192.168.1.20", "2001:db8::5", "fe80::1%en0", "::1"} {
+		phone := testIdentity()
+		e.AddDeviceManual(phone, ip, 1716)
+		devices[ip] = phone.DeviceId
+	}
+
+	tests := []struct {
+		ip   string
+		want string // the address the device was added with, "" if none
+	}{
+		{"192.168.1.20", "192.168.1.20"},
+		{"::ffff:192.168.1.20", "192.168.1.20"},
+		{"::ffff:c0a8:114", "192.168.1.20"},
+		{"2001:db8::5", "2001:db8::5"},
+		{"2001:0db8:0000:0000:0000:0000:0000:0005", "2001:db8::5"},
+		{"[2001:db8::5]", "2001:db8::5"},
+		{"2001:DB8::5", "2001:db8::5"},
+		{"fe80::1", "fe80::1%en0"},
+		{"fe80::1%eth0", "fe80::1%en0"},
+		{"[fe80::1%en0]", "fe80::1%en0"},
+		{"0:0:0:0:0:0:0:1", "::1"},
+		{"[::1]", "::1"},
+		{"192.168.1.21", ""},
+		{"2001:db8::6", ""},
+		{"[192.168.1.20", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			dev, ok := e.GetDeviceByIP(tt.ip)
+			if tt.want == "" {
+				if ok {
+					t.Fatalf("found %s", dev.Identity.DeviceId)
+				}
+				return
+			}
+			if !ok || dev.Identity.DeviceId != devices[tt.want] {
+				t.Fatalf("GetDeviceByIP = %s, %v; want the device at %s", dev.Identity.DeviceId, ok, tt.want)
+			}
+		})
+	}
+
+	e.mu.RLock()
+	addr := e.discoveredDevices[devices["fe80::1%en0"]].Addr
+	e.mu.RUnlock()
+	if addr.Zone != "en0" {
+		t.Errorf("zone of %v lost", addr)
+	}
+}
@@ -0,0 +1,45 @@
+package core
+
+// AutoPairAllowed reports whether a pair request from the device, presenting
+// the certificate with fingerprint, is accepted without asking. Only the
+// certificate it was allowed with counts, so another host claiming its device
+// id still has to be confirmed.
+func (e *Engine) AutoPairAllowed(deviceId, fingerprint string) bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	allowed, ok := e.autoPair[deviceId]
+	return ok && fingerprint != "" && allowed == fingerprint
+}
+
+// AutoPairEnabled reports whether the device is on the auto-pair allowlist.
+func (e *Engine) AutoPairEnabled(deviceId string) bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	_, ok := e.autoPair[deviceId]
+	return ok
+}
+
+// SetAutoPair puts the device on the auto-pair allowlist for the certificate
+// with fingerprint, or takes it off if fingerprint is empty.
+func (e *Engine) SetAutoPair(deviceId, fingerprint string) {
+	e.mu.Lock()
+	if e.autoPair[deviceId] == fingerprint {
+		e.mu.Unlock()
+		return
+	}
+	if fingerprint == "" {
+		delete(e.autoPair, deviceId)
+	} else {
+		e.autoPair[deviceId] = fingerprint
+	}
+	e.mu.Unlock()
+	e.scheduleSave()
+}
+
+// PairedFingerprint returns the fingerprint of the certificate the device
+// paired with, or "" if it isn't paired or hasn't connected since.
+func (e *Engine) PairedFingerprint(deviceId string) string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.pairedDevices[deviceId].Fingerprint
+}
@@ -0,0 +1,111 @@
+package core
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/barishamil/kde-connect-fyne/internal/logging"
+	"github.com/barishamil/kde-connect-fyne/internal/network"
+	"github.com/barishamil/kde-connect-fyne/internal/protocol"
+)
+
+// certKeyType is the key type new certificates get: $KDECONNECT_FYNE_KEY_TYPE
+// if set, otherwise the config's keyType. Empty means RSA.
+func (e *Engine) certKeyType() string {
+	if keyType := os.Getenv("KDECONNECT_FYNE_KEY_TYPE"); keyType != "" {
+		return keyType
+	}
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.keyType
+}
+
+// newCertificate creates a certificate for deviceId, which is used as its
+// Common Name.
+func newCertificate(deviceId, keyType string) (*tls.Certificate, []byte, []byte, error) {
+	cert, certPEM, privPEM, err := protocol.GenerateCertificate(deviceId, keyType)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	hash := sha256.Sum256(cert.Certificate[0])
+	logging.Debugf("Engine Certificate Fingerprint: %x\n", hash)
+
+	// Deep copy cert to separate heap allocation
+	eCert := new(tls.Certificate)
+	eCert.PrivateKey = cert.PrivateKey
+	for _, c := range cert.Certificate {
+		cb := make([]byte, len(c))
+		copy(cb, c)
+		eCert.Certificate = append(eCert.Certificate, cb)
+	}
+	return eCert, certPEM, privPEM, nil
+}
+
+// Generating the certificate is tried certAttempts times, waiting
+// certRetryDelay after the first failure and twice as long after each one
+// after that, before the error is reported.
+const certAttempts = 4
+
+var certRetryDelay = 2 * time.Second
+
+// generateCert creates the certificate for a new identity, saves it along
+// with the config, and signals those waiting on it.
+func (e *Engine) generateCert() {
+	var cert *tls.Certificate
+	var certPEM, privPEM []byte
+	var err error
+	delay := certRetryDelay
+	for attempt := 1; ; attempt++ {
+		cert, certPEM, privPEM, err = newCertificate(e.Identity.DeviceId, e.certKeyType())
+		if err == nil {
+			break
+		}
+		if attempt == certAttempts {
+			e.setCertReady(fmt.Errorf("failed to generate certificate: %w", err))
+			return
+		}
+		fmt.Printf("Generating the certificate failed, retrying in %v: %v\n", delay, err)
+		select {
+		case <-time.After(delay):
+		case <-e.stop:
+			e.setCertReady(fmt.Errorf("failed to generate certificate: %w", err))
+			return
+		}
+		delay *= 2
+	}
+
+	e.mu.Lock()
+	e.Cert = cert
+	e.btProvider = network.NewBluetoothLinkProvider(e.Identity, cert)
+	e.mu.Unlock()
+
+	e.SaveConfig()
+	e.SaveCertificate(certPEM, privPEM)
+	e.setCertReady(nil)
+}
+
+func (e *Engine) setCertReady(err error) {
+	e.certOnce.Do(func() {
+		e.certErr = err
+		close(e.certReady)
+	})
+
+	e.mu.Lock()
+	initializing := e.status.Initializing
+	e.status.Initializing = false
+	e.mu.Unlock()
+	if initializing {
+		e.setServiceStatus("certificate", err, func(*Status) {})
+	}
+}
+
+// waitCert blocks until the certificate is ready, and returns the error if
+// generating it failed.
+func (e *Engine) waitCert() error {
+	<-e.certReady
+	return e.certErr
+}
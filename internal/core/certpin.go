@@ -0,0 +1,87 @@
+package core
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	"github.com/barishamil/kde-connect-fyne/internal/network"
+)
+
+// ErrCertificateChanged means a paired device presented a different
+// certificate than the one it paired with.
+var ErrCertificateChanged = errors.New("device certificate changed")
+
+// CertChanged is emitted with cert_changed when a paired device presents a
+// new certificate, as it does after a factory reset or reinstall. Its
+// connections are refused until it is paired again, see RepairDevice.
+type CertChanged struct {
+	DeviceId       string
+	DeviceName     string
+	OldFingerprint string
+	NewFingerprint string
+}
+
+func certFingerprint(cert *x509.Certificate) string {
+	if cert == nil {
+		return ""
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(cert.Raw))
+}
+
+// checkPeerCert reports whether a connection may be used: devices that
+// aren't paired always may, paired ones only with the certificate they paired
+// with. Pairings made before certificates were pinned pin the first one seen.
+func (e *Engine) checkPeerCert(conn *network.Connection) bool {
+	fingerprint := certFingerprint(conn.PeerCertificate())
+
+	e.mu.Lock()
+	info, paired := e.pairedDevices[conn.DeviceId]
+	if !paired || fingerprint == "" || info.Fingerprint == fingerprint {
+		e.mu.Unlock()
+		return true
+	}
+	if info.Fingerprint == "" {
+		info.Fingerprint = fingerprint
+		e.pairedDevices[conn.DeviceId] = info
+		e.mu.Unlock()
+		e.scheduleSave()
+		return true
+	}
+	// Ask once per certificate rather than on every reconnection attempt
+	notify := e.rejectedCerts[conn.DeviceId] != fingerprint
+	e.rejectedCerts[conn.DeviceId] = fingerprint
+	e.mu.Unlock()
+
+	fmt.Printf("Refusing %s: certificate changed from %s to %s\n", conn.DeviceId, info.Fingerprint, fingerprint)
+	if notify {
+		e.Events.Emit("cert_changed", CertChanged{
+			DeviceId:       conn.DeviceId,
+			DeviceName:     info.Identity.DeviceName,
+			OldFingerprint: info.Fingerprint,
+			NewFingerprint: fingerprint,
+		})
+	}
+	return false
+}
+
+// RepairDevice forgets a device whose certificate changed and sends it a new
+// pair request, so the verification key can be compared on both screens
+// again. The new certificate is pinned once the device accepts.
+func (e *Engine) RepairDevice(deviceId string) (string, error) {
+	e.mu.Lock()
+	info, paired := e.pairedDevices[deviceId]
+	_, discovered := e.discoveredDevices[deviceId]
+	delete(e.rejectedCerts, deviceId)
+	e.mu.Unlock()
+
+	if paired {
+		// Keep an address to reach it at once the pairing is gone
+		if !discovered {
+			e.AddDeviceManual(info.Identity, info.LastIP, info.LastPort)
+		}
+		e.Unpair(deviceId)
+	}
+	return e.Pair(deviceId)
+}
@@ -0,0 +1,15 @@
+package core
+
+import (
+	"fmt"
+
+	"github.com/barishamil/kde-connect-fyne/internal/protocol"
+)
+
+// SendClipboard replaces the device's clipboard with content.
+func (e *Engine) SendClipboard(deviceId, content string) error {
+	if !e.DeviceSupports(deviceId, "kdeconnect.clipboard") {
+		return fmt.Errorf("device %s does not support clipboard sharing", deviceId)
+	}
+	return e.SendPacket(deviceId, "kdeconnect.clipboard", protocol.ClipboardBody{Content: content})
+}
@@ -0,0 +1,65 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"syscall"
+
+	"github.com/barishamil/kde-connect-fyne/internal/network"
+)
+
+// The KDE Connect port range. Another KDE Connect on this machine, such as
+// kdeconnectd or GSConnect, usually holds the first port.
+const (
+	tcpPortMin = 1716
+	tcpPortMax = 1764
+)
+
+func addrInUse(err error) bool {
+	return errors.Is(err, syscall.EADDRINUSE)
+}
+
+// freePort returns the first port of the KDE Connect range nothing listens
+// on.
+func freePort() (int, bool) {
+	for p := tcpPortMin; p <= tcpPortMax; p++ {
+		l, err := net.Listen("tcp", fmt.Sprintf(":%d", p))
+		if err == nil {
+			l.Close()
+			return p, true
+		}
+	}
+	return 0, false
+}
+
+// listen binds the server's port. If something else has taken it since the
+// identity was created, it moves to a free port of the range and announces
+// that instead, unless the port was set explicitly.
+func (e *Engine) listen(server *network.Server) error {
+	err := server.Listen()
+	e.mu.RLock()
+	fixed := e.fixedPort
+	e.mu.RUnlock()
+	if !addrInUse(err) || fixed {
+		return err
+	}
+
+	port, ok := freePort()
+	if !ok {
+		return err
+	}
+	log.Printf("TCP port %d is in use, listening on %d instead", server.Port, port)
+	server.Port = port
+	if err := server.Listen(); err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	e.Identity.TcpPort = port
+	server.Identity = e.Identity
+	e.mu.Unlock()
+	e.scheduleSave()
+	return nil
+}
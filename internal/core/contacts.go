@@ -0,0 +1,234 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/barishamil/kde-connect-fyne/internal/logging"
+)
+
+// contactsResponse carries a contacts plugin reply. Besides "uids", every key
+// is a contact uid mapping to a timestamp or a vCard depending on the packet.
+type contactsResponse struct {
+	Entries map[string]json.RawMessage
+}
+
+type cachedContact struct {
+	Timestamp int64  `json:"timestamp"`
+	VCard     string `json:"vcard"`
+}
+
+func (e *Engine) contactsCachePath(deviceId string) string {
+	dir := filepath.Join(e.configDir, "contacts")
+	os.MkdirAll(dir, 0700)
+	return filepath.Join(dir, deviceId+".json")
+}
+
+func (e *Engine) loadContactsCache(deviceId string) map[string]cachedContact {
+	cache := make(map[string]cachedContact)
+	data, err := os.ReadFile(e.contactsCachePath(deviceId))
+	if err == nil {
+		json.Unmarshal(data, &cache)
+	}
+	return cache
+}
+
+func (e *Engine) saveContactsCache(deviceId string, cache map[string]cachedContact) error {
+	data, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(e.contactsCachePath(deviceId), data, 0600)
+}
+
+// SyncContacts fetches the device's address book, only downloading vCards
+// whose timestamp changed since the last sync.
+func (e *Engine) SyncContacts(deviceId string) error {
+	if !e.DeviceSupports(deviceId, "kdeconnect.contacts.request_all_uids_timestamps") {
+		return fmt.Errorf("device %s does not support contacts", deviceId)
+	}
+
+	resp, err := e.requestContacts(deviceId, "kdeconnect.contacts.request_all_uids_timestamps", struct{}{}, "kdeconnect.contacts.response_uids_timestamps")
+	if err != nil {
+		return err
+	}
+
+	cache := e.loadContactsCache(deviceId)
+	remote := make(map[string]int64)
+	var changed []string
+	for uid, raw := range resp.Entries {
+		if uid == "uids" {
+			continue
+		}
+		var ts int64
+		if err := json.Unmarshal(raw, &ts); err != nil {
+			continue
+		}
+		remote[uid] = ts
+		if c, ok := cache[uid]; !ok || c.Timestamp != ts {
+			changed = append(changed, uid)
+		}
+	}
+
+	// Drop contacts deleted on the device
+	for uid := range cache {
+		if _, ok := remote[uid]; !ok {
+			delete(cache, uid)
+		}
+	}
+
+	if len(changed) > 0 {
+		resp, err := e.requestContacts(deviceId, "kdeconnect.contacts.request_vcards_by_uid", map[string][]string{"uids": changed}, "kdeconnect.contacts.response_vcards")
+		if err != nil {
+			return err
+		}
+		for uid, raw := range resp.Entries {
+			if uid == "uids" {
+				continue
+			}
+			var vcard string
+			if err := json.Unmarshal(raw, &vcard); err != nil {
+				continue
+			}
+			cache[uid] = cachedContact{Timestamp: remote[uid], VCard: vcard}
+		}
+	}
+
+	if err := e.saveContactsCache(deviceId, cache); err != nil {
+		fmt.Printf("Failed to save contacts cache: %v\n", err)
+	}
+
+	e.mu.Lock()
+	e.contacts[deviceId] = buildContactIndex(cache)
+	e.mu.Unlock()
+	return nil
+}
+
+// syncContactsOnConnect refreshes the address book of a paired device that
+// just connected, so notification titles can be resolved offline later.
+func (e *Engine) syncContactsOnConnect(deviceId string) {
+	if !e.IsPaired(deviceId) || !e.DeviceSupports(deviceId, "kdeconnect.contacts.request_all_uids_timestamps") {
+		return
+	}
+	go func() {
+		if err := e.SyncContacts(deviceId); err != nil {
+			logging.Debugf("Failed to sync contacts of %s: %v\n", deviceId, err)
+		}
+	}()
+}
+
+func (e *Engine) requestContacts(deviceId, reqType string, body interface{}, respType string) (contactsResponse, error) {
+	p, err := e.Request(deviceId, reqType, body, respType, 30*time.Second)
+	if err != nil {
+		return contactsResponse{}, err
+	}
+	var resp contactsResponse
+	if err := json.Unmarshal(p.Body, &resp.Entries); err != nil {
+		return contactsResponse{}, fmt.Errorf("invalid %s: %w", respType, err)
+	}
+	return resp, nil
+}
+
+// ContactName resolves a phone number to a contact name using the synced
+// address book of the device, or returns "" if unknown.
+func (e *Engine) ContactName(deviceId, number string) string {
+	e.mu.RLock()
+	index, ok := e.contacts[deviceId]
+	e.mu.RUnlock()
+
+	if !ok {
+		index = buildContactIndex(e.loadContactsCache(deviceId))
+		e.mu.Lock()
+		e.contacts[deviceId] = index
+		e.mu.Unlock()
+	}
+
+	digits := normalizePhoneNumber(number)
+	if digits == "" {
+		return ""
+	}
+	if name, ok := index[digits]; ok {
+		return name
+	}
+	// Fall back to matching without country/trunk prefixes
+	if len(digits) > 9 {
+		return index[digits[len(digits)-9:]]
+	}
+	return ""
+}
+
+func buildContactIndex(cache map[string]cachedContact) map[string]string {
+	index := make(map[string]string)
+	for _, c := range cache {
+		name, numbers := parseVCard(c.VCard)
+		if name == "" {
+			continue
+		}
+		for _, n := range numbers {
+			digits := normalizePhoneNumber(n)
+			if digits == "" {
+				continue
+			}
+			index[digits] = name
+			if len(digits) > 9 {
+				index[digits[len(digits)-9:]] = name
+			}
+		}
+	}
+	return index
+}
+
+// parseVCard extracts the formatted name and phone numbers from a vCard.
+func parseVCard(vcard string) (string, []string) {
+	// Unfold continuation lines (RFC 6350 section 3.2)
+	vcard = strings.ReplaceAll(vcard, "\r\n", "\n")
+	vcard = strings.ReplaceAll(vcard, "\n ", "")
+	vcard = strings.ReplaceAll(vcard, "\n\t", "")
+
+	var name string
+	var numbers []string
+	for _, line := range strings.Split(vcard, "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		prop, _, _ := strings.Cut(key, ";")
+		switch strings.ToUpper(prop) {
+		case "FN":
+			name = strings.TrimSpace(value)
+		case "TEL":
+			numbers = append(numbers, strings.TrimSpace(value))
+		}
+	}
+	return name, numbers
+}
+
+// looksLikePhoneNumber reports whether s is only a phone number, as messaging
+// apps title a message from a sender not in their own address book.
+func looksLikePhoneNumber(s string) bool {
+	digits := 0
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			digits++
+		case strings.ContainsRune("+-(). ", r):
+		default:
+			return false
+		}
+	}
+	return digits >= 5
+}
+
+func normalizePhoneNumber(number string) string {
+	var b strings.Builder
+	for _, r := range number {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -1,19 +1,23 @@
 package core
 
 import (
-	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net"
+	"os"
 	"os/exec"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/barishamil/kde-connect-fyne/internal/events"
+	"github.com/barishamil/kde-connect-fyne/internal/logging"
 	"github.com/barishamil/kde-connect-fyne/internal/network"
 	"github.com/barishamil/kde-connect-fyne/internal/protocol"
 	"github.com/pkg/sftp"
@@ -22,13 +26,56 @@ import (
 
 type DiscoveredDevice struct {
 	Identity protocol.IdentityBody
-	Addr     *net.UDPAddr
+	// Addr is the preferred address to connect to, with the TCP port
+	Addr *net.UDPAddr
+	// Candidates are the addresses the device was recently seen at, most
+	// recent first
+	Candidates []*net.UDPAddr
 }
 
 type PairRequest struct {
 	RemoteIP        string
 	Identity        protocol.IdentityBody
 	VerificationKey string
+	// Fingerprint is the hex SHA-256 of the device's certificate
+	Fingerprint string
+}
+
+// Capabilities we advertise. Incoming are packet types we handle, outgoing are
+// packet types we may send.
+var (
+	incomingCapabilities = []string{"kdeconnect.ping", "kdeconnect.identity", "kdeconnect.pair", "kdeconnect.sftp", "kdeconnect.sftp.request", "kdeconnect.systemvolume.request", "kdeconnect.presenter", "kdeconnect.mousepad.request", "kdeconnect.lock", "kdeconnect.lock.request", "kdeconnect.contacts.response_uids_timestamps", "kdeconnect.contacts.response_vcards", "kdeconnect.notification"}
+	outgoingCapabilities = []string{"kdeconnect.ping", "kdeconnect.identity", "kdeconnect.pair", "kdeconnect.sftp", "kdeconnect.sftp.request", "kdeconnect.systemvolume", "kdeconnect.lock", "kdeconnect.lock.request", "kdeconnect.contacts.request_all_uids_timestamps", "kdeconnect.contacts.request_vcards_by_uid", "kdeconnect.share.request", "kdeconnect.clipboard", "kdeconnect.mousepad.request", "kdeconnect.notification.reply", "kdeconnect.notification.action"}
+)
+
+// Android rotates the SFTP port/password, so offers are only reused briefly.
+const sftpOfferTTL = 30 * time.Second
+
+type sftpOffer struct {
+	body     protocol.SftpBody
+	received time.Time
+}
+
+type PingReceived struct {
+	DeviceId   string
+	DeviceName string
+	Message    string
+}
+
+// ErrDeviceNotFound means we have no address to reach the device at.
+var ErrDeviceNotFound = errors.New("device not found")
+
+// ConnectionError is emitted with connection_error when getOrConnect fails.
+type ConnectionError struct {
+	DeviceId string
+	Message  string
+	Err      error
+}
+
+type SecurityWarning struct {
+	DeviceId     string
+	Message      string
+	PresentedKey string
 }
 
 type Engine struct {
@@ -37,32 +84,109 @@ type Engine struct {
 	Cert              *tls.Certificate
 	discoveredDevices map[string]DiscoveredDevice
 	pairedDevices     map[string]PairedDeviceInfo
-	sftpOffers        map[string]protocol.SftpBody
+	sftpOffers        map[string]sftpOffer
 	activeConns       map[string]*network.Connection
-	pendingPairing    map[string]bool
+	standbyConns      map[string]*network.Connection // Bluetooth kept while LAN is active
+	rejectedCerts     map[string]string              // last changed certificate refused, by device
+	connecting        map[string]*connectCall
+	pendingPairing    map[string]int64 // timestamp of our outstanding pair request
+	knownHosts        map[string]string
+	pluginSettings    map[string]map[string]bool
+	openWith          map[string]string
+	lastPaths         map[string]string // last folder browsed, by device
+	autoPair          map[string]string // allowed certificate fingerprint, by device
+	sharedFolders     []string
+	discoveryIfaces   []string
+	minTLSVersion     string
+	idleTimeout       time.Duration
+	keyType           string
+	fixedPort         bool // set with SetListenPort, so never moved off
+	savedPort         int  // saved in place of the port set with SetListenPort
+	sftpServers       map[string]*network.SFTPServer
+	notifications     []Notification
+	notificationIcons map[string][]byte // by app name
+	ungrouped         bool              // notifications aren't grouped by app and title
+	packetHandlers    map[string][]PacketHandler
+	requests          []*pendingRequest
+	sendInterceptors  []SendInterceptor
+	mouseThrottles    map[string]*mouseThrottle
+	status            Status
+	stats             engineStats
+	devStats          sync.Map // deviceId -> *deviceStats
+	presenter         presenterState
+	contacts          map[string]map[string]string
 	btProvider        *network.BluetoothLinkProvider
+	certReady         chan struct{} // closed once Cert (or certErr) is set
+	certOnce          sync.Once
+	certErr           error
+	stop              chan struct{} // closed by Stop
+	stopOnce          sync.Once
+	configDir         string
 	mu                sync.RWMutex
+	saveMu            sync.Mutex
+	saveTimer         *time.Timer
+	saveTimerMu       sync.Mutex
+
+	// dial opens outgoing connections; replaceable so the engine can be
+	// driven over in-memory connections.
+	dial func(deviceId, ip string, port int, timeout time.Duration) (*network.Connection, error)
 }
 
+// AddDeviceManual records a device under an identity the caller already
+// knows, such as a paired device's stored one. Use ConnectAddress to reach a
+// device known only by address.
 func (e *Engine) AddDeviceManual(identity protocol.IdentityBody, ip string, port int) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
-	addr, _ := net.ResolveUDPAddr("udp", net.JoinHostPort(ip, fmt.Sprintf("%d", port)))
-	// We don't really need UDPAddr to be perfect, just the IP for pairing
+	addr := resolveAddr(ip, port)
+	if isPlaceholderAddr(addr) && ip != "" {
+		fmt.Printf("Ignoring unusable address %q for %s\n", ip, identity.DeviceId)
+	}
 	dev := DiscoveredDevice{Identity: identity, Addr: addr}
 	e.discoveredDevices[identity.DeviceId] = dev
 	e.Events.Emit("device_discovered", dev)
 }
 
 func NewEngine(deviceName string) (*Engine, error) {
+	return NewEngineWithConfigDir(deviceName, GetConfigDir())
+}
+
+// NewEngineWithConfigDir creates an engine that keeps its config, certificate
+// and caches in configDir instead of the default location.
+func NewEngineWithConfigDir(deviceName, configDir string) (*Engine, error) {
+	if err := os.MkdirAll(configDir, 0700); err != nil {
+		return nil, err
+	}
+
 	engine := &Engine{
+		stats:             engineStats{started: time.Now()},
+		configDir:         configDir,
 		Events:            events.NewEventEmitter(),
 		discoveredDevices: make(map[string]DiscoveredDevice),
 		pairedDevices:     make(map[string]PairedDeviceInfo),
-		sftpOffers:        make(map[string]protocol.SftpBody),
+		sftpOffers:        make(map[string]sftpOffer),
 		activeConns:       make(map[string]*network.Connection),
-		pendingPairing:    make(map[string]bool),
+		standbyConns:      make(map[string]*network.Connection),
+		rejectedCerts:     make(map[string]string),
+		connecting:        make(map[string]*connectCall),
+		pendingPairing:    make(map[string]int64),
+		knownHosts:        make(map[string]string),
+		pluginSettings:    make(map[string]map[string]bool),
+		openWith:          make(map[string]string),
+		lastPaths:         make(map[string]string),
+		autoPair:          make(map[string]string),
+		sftpServers:       make(map[string]*network.SFTPServer),
+		notificationIcons: make(map[string][]byte),
+		contacts:          make(map[string]map[string]string),
+		certReady:         make(chan struct{}),
+		stop:              make(chan struct{}),
+	}
+	engine.dial = func(deviceId, ip string, port int, timeout time.Duration) (*network.Connection, error) {
+		if err := engine.waitCert(); err != nil {
+			return nil, err
+		}
+		return network.ConnectTimeout(ip, port, engine.Cert, engine.identityFor(deviceId), timeout)
 	}
 
 	// Try to load existing config
@@ -75,6 +199,13 @@ func NewEngine(deviceName string) (*Engine, error) {
 				engine.Identity.DeviceName = deviceName
 				changed = true
 			}
+			// Refresh capabilities in case this build supports more plugins
+			if !slices.Equal(engine.Identity.IncomingCapabilities, incomingCapabilities) ||
+				!slices.Equal(engine.Identity.OutgoingCapabilities, outgoingCapabilities) {
+				engine.Identity.IncomingCapabilities = slices.Clone(incomingCapabilities)
+				engine.Identity.OutgoingCapabilities = slices.Clone(outgoingCapabilities)
+				changed = true
+			}
 			// Update bluetooth address if missing
 			if engine.Identity.BluetoothAddress == "" {
 				addr := getBluetoothAddress()
@@ -87,90 +218,102 @@ func NewEngine(deviceName string) (*Engine, error) {
 				engine.SaveConfig()
 			}
 			engine.btProvider = network.NewBluetoothLinkProvider(engine.Identity, engine.Cert)
+			engine.setCertReady(nil)
 			return engine, nil
 		}
 	}
 
-	// KDE Connect deviceId should be between 32 and 38 characters
-	deviceId := fmt.Sprintf("fyne-%030x", time.Now().UnixNano())
-	cert, certPEM, privPEM, err := protocol.GenerateCertificate(deviceId) // Use DeviceID as Common Name
+	// Generating the key takes a while, so it happens in the background
+	// and Start and outgoing connections wait for it.
+	engine.Identity = newIdentity(deviceName)
+	engine.status.Initializing = true
+	go engine.generateCert()
+
+	return engine, nil
+}
+
+// generateIdentity creates a fresh deviceId and certificate.
+func generateIdentity(deviceName, keyType string) (protocol.IdentityBody, *tls.Certificate, []byte, []byte, error) {
+	identity := newIdentity(deviceName)
+	cert, certPEM, privPEM, err := newCertificate(identity.DeviceId, keyType)
 	if err != nil {
-		return nil, err
+		return protocol.IdentityBody{}, nil, nil, nil, err
 	}
+	return identity, cert, certPEM, privPEM, nil
+}
 
-	// Debug: Print Cert Fingerprint
-	hash := sha256.Sum256(cert.Certificate[0])
-	fmt.Printf("Engine Certificate Fingerprint: %x\n", hash)
+// newIdentity creates a fresh deviceId on a free port.
+func newIdentity(deviceName string) protocol.IdentityBody {
+	// KDE Connect deviceId should be between 32 and 38 characters
+	deviceId := fmt.Sprintf("fyne-%030x", time.Now().UnixNano())
 
-	// Try to find an available port in the KDE Connect range
-	port := 1716
-	for p := 1716; p <= 1764; p++ {
-		l, err := net.Listen("tcp", fmt.Sprintf(":%d", p))
-		if err == nil {
-			l.Close()
-			port = p
-			break
-		}
+	port, ok := freePort()
+	if !ok {
+		port = tcpPortMin
 	}
 
-	identity := protocol.IdentityBody{
+	return protocol.IdentityBody{
 		DeviceId:             deviceId,
 		DeviceName:           deviceName,
 		DeviceType:           "desktop",
 		ProtocolVersion:      8,
 		TcpPort:              port,
 		BluetoothAddress:     getBluetoothAddress(),
-		IncomingCapabilities: []string{"kdeconnect.ping", "kdeconnect.identity", "kdeconnect.pair", "kdeconnect.sftp"},
-		OutgoingCapabilities: []string{"kdeconnect.ping", "kdeconnect.identity", "kdeconnect.pair", "kdeconnect.sftp"},
+		IncomingCapabilities: slices.Clone(incomingCapabilities),
+		OutgoingCapabilities: slices.Clone(outgoingCapabilities),
 	}
+}
 
-	// Deep copy cert to separate heap allocation
-	eCert := new(tls.Certificate)
-	eCert.PrivateKey = cert.PrivateKey
-	for _, c := range cert.Certificate {
-		cb := make([]byte, len(c))
-		copy(cb, c)
-		eCert.Certificate = append(eCert.Certificate, cb)
+// SetListenPort makes the engine listen on port instead of the one picked
+// from the KDE Connect range when its identity was created. The port must be
+// free. It only lasts until exit: the config keeps the port it had. Call it
+// before Start.
+func (e *Engine) SetListenPort(port int) error {
+	if port < 1 || port > 65535 {
+		return fmt.Errorf("invalid port %d", port)
 	}
+	l, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return fmt.Errorf("port %d is not available: %w", port, err)
+	}
+	l.Close()
 
-	engine.Identity = identity
-	engine.Cert = eCert
-	engine.btProvider = network.NewBluetoothLinkProvider(identity, eCert)
-
-	// Save new config
-	engine.SaveConfig()
-	engine.SaveCertificate(certPEM, privPEM)
-
-	return engine, nil
+	e.mu.Lock()
+	if !e.fixedPort {
+		e.savedPort = e.Identity.TcpPort
+	}
+	e.Identity.TcpPort = port
+	e.fixedPort = true
+	e.mu.Unlock()
+	return nil
 }
 
 func (e *Engine) handlePacket(conn *network.Connection, p protocol.Packet) {
 	fmt.Printf("Received packet from %s: %s\n", conn.DeviceId, p.Type)
 
+	if !e.acceptsPacket(conn.DeviceId, p.Type) {
+		logging.Debugf("Ignoring %s from %s: not an incoming capability\n", p.Type, conn.DeviceId)
+		return
+	}
+
+	e.dispatchPacketHandlers(conn.DeviceId, p.Type, p.Body)
+	e.resolveRequests(conn.DeviceId, p)
+
 	switch p.Type {
 	case "kdeconnect.pair":
 		var pair protocol.PairBody
-		if err := json.Unmarshal(p.Body, &pair); err != nil {
-			fmt.Printf("Failed to unmarshal pair request: %v\n", err)
+		if !decodeBody(conn.DeviceId, p, &pair) {
 			return
 		}
 		if pair.Pair {
 			remoteIP, _, _ := net.SplitHostPort(conn.Conn.RemoteAddr().String())
 
-			// Calculate Verification Key
-			var key string
-			if tlsConn, ok := conn.Conn.(*tls.Conn); ok {
-				peerCerts := tlsConn.ConnectionState().PeerCertificates
-				if len(peerCerts) > 0 {
-					myCert, _ := x509.ParseCertificate(e.Cert.Certificate[0])
-					key, _ = protocol.GetVerificationKey(myCert, peerCerts[0], pair.Timestamp)
-				}
-			}
+			key := e.verificationKey(conn, pair.Timestamp)
 
 			// Ensure device is known before emitting event (important for AcceptPair)
 			e.mu.RLock()
 			_, exists := e.discoveredDevices[conn.DeviceId]
-			isPending := e.pendingPairing[conn.DeviceId]
+			_, isPending := e.pendingPairing[conn.DeviceId]
 			e.mu.RUnlock()
 
 			if isPending {
@@ -182,98 +325,259 @@ func (e *Engine) handlePacket(conn *network.Connection, p protocol.Packet) {
 			}
 
 			if !exists {
-				remoteIP, _, _ := net.SplitHostPort(conn.Conn.RemoteAddr().String())
-				addr, _ := net.ResolveUDPAddr("udp", net.JoinHostPort(remoteIP, fmt.Sprintf("%d", conn.RemoteIdentity.TcpPort)))
-				e.addDiscoveredDevice(conn.RemoteIdentity, addr)
+				e.addDiscoveredDevice(conn.RemoteIdentity, resolveAddr(remoteIP, conn.RemoteIdentity.TcpPort))
 			}
 
+			fingerprint := certFingerprint(conn.PeerCertificate())
+
 			e.Events.Emit("pair_request", PairRequest{
 				RemoteIP:        remoteIP,
 				Identity:        conn.RemoteIdentity,
 				VerificationKey: key,
+				Fingerprint:     fingerprint,
 			})
 		} else {
+			// pair:false answers our pending request, or ends an existing pairing
+			e.mu.Lock()
+			_, isPending := e.pendingPairing[conn.DeviceId]
+			delete(e.pendingPairing, conn.DeviceId)
+			e.mu.Unlock()
+
+			if isPending {
+				fmt.Printf("Pairing rejected by %s\n", conn.DeviceId)
+				e.Events.Emit("pair_rejected", conn.DeviceId)
+				return
+			}
 			fmt.Printf("Received unpair request from %s\n", conn.DeviceId)
 			e.Unpair(conn.DeviceId)
 		}
 	case "kdeconnect.ping":
-		fmt.Println("Received Ping! Sending response...")
-		conn.SendPacket("kdeconnect.ping", json.RawMessage("{}"))
+		var ping protocol.PingBody
+		json.Unmarshal(p.Body, &ping)
+		e.Events.Emit("ping_received", PingReceived{
+			DeviceId:   conn.DeviceId,
+			DeviceName: conn.RemoteIdentity.DeviceName,
+			Message:    ping.Message,
+		})
+		// Pings are one-shot notifications; echoing them back would make two
+		// clients ping each other forever.
+		fmt.Printf("Received ping from %s\n", conn.DeviceId)
 	case "kdeconnect.sftp":
 		var sftpBody protocol.SftpBody
-		if err := json.Unmarshal(p.Body, &sftpBody); err == nil {
-			if sftpBody.Port != 0 {
-				fmt.Printf("Received SFTP offer from %s: %+v\n", conn.DeviceId, sftpBody)
-				e.mu.Lock()
-				e.sftpOffers[conn.DeviceId] = sftpBody
-				e.mu.Unlock()
-				e.Events.Emit("sftp_offer", conn.DeviceId)
-			}
+		if decodeBody(conn.DeviceId, p, &sftpBody) && !sftpBody.StartBrowsing {
+			fmt.Printf("Received SFTP offer from %s: %v\n", conn.DeviceId, sftpBody)
+			e.mu.Lock()
+			e.sftpOffers[conn.DeviceId] = sftpOffer{body: sftpBody, received: time.Now()}
+			e.mu.Unlock()
+			e.Events.Emit("sftp_offer", conn.DeviceId)
+		}
+	case "kdeconnect.sftp.request":
+		var req protocol.SftpBody
+		if !decodeBody(conn.DeviceId, p, &req) {
+			return
+		}
+		if req.StartBrowsing {
+			e.handleSftpRequest(conn)
+		}
+	case "kdeconnect.systemvolume.request":
+		var req protocol.SystemVolumeBody
+		if !decodeBody(conn.DeviceId, p, &req) {
+			return
+		}
+		e.handleSystemVolumeRequest(conn, req)
+	case "kdeconnect.presenter":
+		var presenter protocol.PresenterBody
+		if !decodeBody(conn.DeviceId, p, &presenter) {
+			return
 		}
+		e.handlePresenter(conn, presenter)
+	case "kdeconnect.mousepad.request":
+		var req protocol.MousepadRequestBody
+		if !decodeBody(conn.DeviceId, p, &req) {
+			return
+		}
+		e.handleMousepadRequest(conn, req)
+	case "kdeconnect.lock.request", "kdeconnect.lock":
+		var lock protocol.LockBody
+		if !decodeBody(conn.DeviceId, p, &lock) {
+			return
+		}
+		if p.Type == "kdeconnect.lock.request" {
+			e.handleLockRequest(conn, lock)
+		} else if lock.IsLocked != nil {
+			e.Events.Emit("lock_state_changed", LockState{DeviceId: conn.DeviceId, Locked: *lock.IsLocked})
+		}
+	case "kdeconnect.notification":
+		e.handleNotification(conn, p)
 	}
 }
 
+// decodeBody unmarshals a packet's body into v and validates it if v knows
+// how. It logs and reports false for bodies that should be ignored.
+func decodeBody(deviceId string, p protocol.Packet, v interface{}) bool {
+	if err := json.Unmarshal(p.Body, v); err != nil {
+		fmt.Printf("Failed to unmarshal %s from %s: %v\n", p.Type, deviceId, err)
+		return false
+	}
+	if val, ok := v.(protocol.Validator); ok {
+		if err := val.Validate(); err != nil {
+			logging.Debugf("Ignoring invalid %s from %s: %v\n", p.Type, deviceId, err)
+			return false
+		}
+	}
+	return true
+}
+
+// Start brings up discovery, the server and Bluetooth. On first run they
+// start in the background once the certificate has been generated.
 func (e *Engine) Start() {
-	// Start Discovery
-	err := network.StartDiscovery(e.Identity)
-	if err != nil {
-		log.Printf("Error starting discovery: %v", err)
+	select {
+	case <-e.certReady:
+		e.start()
+	default:
+		go func() {
+			e.waitCert()
+			e.start()
+		}()
 	}
+}
 
-	// Listen Discovery
-	go network.ListenDiscovery(func(p protocol.Packet, addr *net.UDPAddr) {
-		if p.Type == "kdeconnect.identity" {
-			var idBody protocol.IdentityBody
-			if err := json.Unmarshal(p.Body, &idBody); err == nil {
-				if idBody.DeviceId != e.Identity.DeviceId {
-					e.addDiscoveredDevice(idBody, addr)
-				}
-			}
-		}
-	})
+func (e *Engine) start() {
+	if err := e.waitCert(); err != nil {
+		log.Printf("Not starting: %v", err)
+		return
+	}
 
-	// Start Server
+	// Start Server first, since moving off a taken port changes the
+	// identity discovery announces
 	e.mu.RLock()
 	server := &network.Server{
-		Cert:     e.Cert,
-		Port:     e.Identity.TcpPort,
-		Identity: e.Identity,
+		Cert:        e.Cert,
+		Port:        e.Identity.TcpPort,
+		Identity:    e.Identity,
+		IdentityFor: e.identityFor,
 		OnConnect: func(conn *network.Connection) {
 			e.handleNewConnection(conn)
 		},
 	}
+	e.btProvider.IdentityFor = e.identityFor
 	e.btProvider.OnConnect = func(conn *network.Connection) {
 		e.handleNewConnection(conn)
 	}
 	e.mu.RUnlock()
 
-	go func() {
-		if err := server.Start(); err != nil {
-			log.Printf("Server error: %v", err)
+	if err := e.listen(server); err != nil {
+		log.Printf("Server error: %v", err)
+		e.setServiceStatus("server", err, nil)
+		e.Events.Emit("server_error", err)
+	} else {
+		e.setServiceStatus("server", nil, func(st *Status) {
+			st.Listening = true
+			st.Port = server.Port
+		})
+		go server.Serve()
+	}
+
+	// Listen Discovery
+	err := network.ListenDiscovery(e.discoveryAllowed, func(p protocol.Packet, addr *net.UDPAddr) {
+		if p.Type == "kdeconnect.identity" {
+			var idBody protocol.IdentityBody
+			if err := json.Unmarshal(p.Body, &idBody); err == nil && idBody.Validate() == nil {
+				if idBody.DeviceId != e.Identity.DeviceId {
+					e.addDiscoveredDevice(idBody, addr)
+				}
+			}
 		}
-	}()
+	})
+	coexist := addrInUse(err)
+	if coexist {
+		log.Printf("Discovery port %d is held by another KDE Connect, finding devices through mDNS instead", network.UDP_PORT)
+		e.setServiceStatus("discovery", nil, func(st *Status) { st.Coexisting = true })
+	} else {
+		if err != nil {
+			log.Printf("Error listening for discovery: %v", err)
+		}
+		e.setServiceStatus("discovery", err, func(st *Status) { st.Discovering = true })
+	}
+
+	// Start Discovery. The other KDE Connect already answers mDNS for this
+	// machine, so while coexisting we only browse it.
+	err = network.StartDiscovery(e.Identity, e.discoveryAllowed, e.discoveryAuto, !coexist)
+	if err != nil {
+		log.Printf("Error starting discovery: %v", err)
+	}
+	e.setServiceStatus("broadcast", err, func(st *Status) { st.Broadcasting = true })
+	if coexist {
+		network.AnnounceToMDNSPeers(e.Identity, e.discoveryAllowed)
+	}
 
 	go func() {
 		if err := e.btProvider.Start(); err != nil {
 			log.Printf("Bluetooth error: %v", err)
 		}
 	}()
+
+	go e.watchSystemVolume()
+
+	go e.sweepSftpOffers()
 }
 
-func (e *Engine) handleNewConnection(conn *network.Connection) {
+// Stop ends the engine's background loops.
+func (e *Engine) Stop() {
+	e.stopOnce.Do(func() { close(e.stop) })
+}
+
+// handleNewConnection starts using a connection, unless it must be refused,
+// which it reports by returning false after closing it.
+func (e *Engine) handleNewConnection(conn *network.Connection) bool {
 	deviceId := conn.DeviceId
+	if !e.checkPeerCert(conn) {
+		go conn.Close()
+		return false
+	}
+	conn.Intercept = func(pType string, body interface{}) (interface{}, bool) {
+		return e.interceptSend(deviceId, pType, body)
+	}
+	conn.IdleTimeout = e.IdleTimeout()
+
+	fmt.Printf("Connected to %s over %s\n", deviceId, conn.Transport)
+
 	e.mu.Lock()
-	// If there is an existing connection, maybe close it or keep the newest one?
-	// KDE Connect usually prefers the newer one for LAN, but Bluetooth might be a backup.
-	e.activeConns[deviceId] = conn
+	var displaced *network.Connection
+	current, ok := e.activeConns[deviceId]
+	switch {
+	case !ok:
+		e.activeConns[deviceId] = conn
+	case !preferConn(current, conn):
+		// A Bluetooth link while LAN works; keep it in case LAN drops
+		displaced = e.standbyConns[deviceId]
+		e.standbyConns[deviceId] = conn
+	case current.Transport == network.TransportBluetooth && conn.Transport == network.TransportLAN:
+		e.activeConns[deviceId] = conn
+		displaced = e.standbyConns[deviceId]
+		e.standbyConns[deviceId] = current
+	default:
+		e.activeConns[deviceId] = conn
+		displaced = current
+	}
 	e.mu.Unlock()
+	if displaced != nil {
+		go displaced.Close()
+	}
 
 	// Also treat as discovered if it's new to us or address updated
 	remoteIP, _, _ := net.SplitHostPort(conn.Conn.RemoteAddr().String())
-	addr, _ := net.ResolveUDPAddr("udp", net.JoinHostPort(remoteIP, fmt.Sprintf("%d", conn.RemoteIdentity.TcpPort)))
-	e.addDiscoveredDevice(conn.RemoteIdentity, addr)
+	e.addDiscoveredDevice(conn.RemoteIdentity, resolveAddr(remoteIP, conn.RemoteIdentity.TcpPort))
 
+	ds := e.deviceStats(deviceId)
+	ds.connects.Add(1)
+	conn.OnSent = func(pType string) {
+		countPacket(&e.stats.packetsSent, pType)
+		countPacket(&ds.packetsSent, pType)
+	}
 	conn.OnPacket = func(p protocol.Packet) {
+		countPacket(&e.stats.packetsReceived, p.Type)
+		countPacket(&ds.packetsReceived, p.Type)
 		e.handlePacket(conn, p)
 	}
 	conn.OnDisconnect = func() {
@@ -281,9 +585,25 @@ func (e *Engine) handleNewConnection(conn *network.Connection) {
 		// Only delete if it's the SAME connection
 		if e.activeConns[deviceId] == conn {
 			delete(e.activeConns, deviceId)
+			if standby, ok := e.standbyConns[deviceId]; ok {
+				delete(e.standbyConns, deviceId)
+				e.activeConns[deviceId] = standby
+				fmt.Printf("Falling back to the %s connection to %s\n", standby.Transport, deviceId)
+			}
+		} else if e.standbyConns[deviceId] == conn {
+			delete(e.standbyConns, deviceId)
 		}
 		e.mu.Unlock()
 	}
+	e.syncContactsOnConnect(deviceId)
+	return true
+}
+
+// preferConn reports whether next should take over from current as a
+// device's active connection: LAN wins over Bluetooth, and otherwise the
+// newer connection wins.
+func preferConn(current, next *network.Connection) bool {
+	return next.Transport == network.TransportLAN || current.Transport == network.TransportBluetooth
 }
 
 func (e *Engine) IsPaired(deviceId string) bool {
@@ -300,11 +620,98 @@ func (e *Engine) IsDiscovered(deviceId string) bool {
 	return ok
 }
 
+// IsOnline reports whether the device is discovered or connected.
+func (e *Engine) IsOnline(deviceId string) bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	_, discovered := e.discoveredDevices[deviceId]
+	_, connected := e.activeConns[deviceId]
+	return discovered || connected
+}
+
 func (e *Engine) GetSftpOffer(deviceId string) (protocol.SftpBody, bool) {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
 	offer, ok := e.sftpOffers[deviceId]
-	return offer, ok
+	return offer.body, ok
+}
+
+// freshSftpOffer returns the device's offer if it is still young enough to reuse.
+func (e *Engine) freshSftpOffer(deviceId string) (protocol.SftpBody, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	offer, ok := e.sftpOffers[deviceId]
+	if !ok {
+		return protocol.SftpBody{}, false
+	}
+	if time.Since(offer.received) >= sftpOfferTTL {
+		delete(e.sftpOffers, deviceId)
+		return protocol.SftpBody{}, false
+	}
+	return offer.body, true
+}
+
+// sweepSftpOffers drops expired offers until the engine stops.
+func (e *Engine) sweepSftpOffers() {
+	t := time.NewTicker(sftpOfferTTL)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			e.expireSftpOffers()
+		case <-e.stop:
+			return
+		}
+	}
+}
+
+func (e *Engine) expireSftpOffers() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for id, offer := range e.sftpOffers {
+		if time.Since(offer.received) >= sftpOfferTTL {
+			delete(e.sftpOffers, id)
+		}
+	}
+}
+
+// DeviceSupports reports whether we may send packets of the given capability to
+// the device: we must advertise it as outgoing and the device as incoming.
+// Devices that advertised no capabilities at all are assumed to support it.
+func (e *Engine) DeviceSupports(deviceId, capability string) bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if !slices.Contains(e.Identity.OutgoingCapabilities, capability) {
+		return false
+	}
+	if !e.pluginEnabledLocked(deviceId, capability) {
+		return false
+	}
+
+	var identity protocol.IdentityBody
+	if conn, ok := e.activeConns[deviceId]; ok {
+		identity = conn.RemoteIdentity
+	} else if dev, ok := e.discoveredDevices[deviceId]; ok {
+		identity = dev.Identity
+	} else if info, ok := e.pairedDevices[deviceId]; ok {
+		identity = info.Identity
+	} else {
+		return false
+	}
+
+	if len(identity.IncomingCapabilities) == 0 {
+		return true
+	}
+	return slices.Contains(identity.IncomingCapabilities, capability)
+}
+
+// connectCall is a connection attempt that concurrent getOrConnect calls for
+// the same device share instead of each dialing.
+type connectCall struct {
+	done chan struct{}
+	conn *network.Connection
+	err  error
 }
 
 func (e *Engine) getOrConnect(deviceId string) (*network.Connection, error) {
@@ -316,50 +723,120 @@ func (e *Engine) getOrConnect(deviceId string) (*network.Connection, error) {
 		return conn, nil
 	}
 
+	e.mu.Lock()
+	if conn, ok := e.activeConns[deviceId]; ok {
+		e.mu.Unlock()
+		return conn, nil
+	}
+	if call, ok := e.connecting[deviceId]; ok {
+		e.mu.Unlock()
+		<-call.done
+		return call.conn, call.err
+	}
+	call := &connectCall{done: make(chan struct{})}
+	e.connecting[deviceId] = call
+	e.mu.Unlock()
+
+	call.conn, call.err = e.connect(deviceId)
+
+	e.mu.Lock()
+	delete(e.connecting, deviceId)
+	e.mu.Unlock()
+	close(call.done)
+	return call.conn, call.err
+}
+
+// connect dials the device at each address we know for it in turn.
+func (e *Engine) connect(deviceId string) (*network.Connection, error) {
 	e.mu.RLock()
-	dev, discovered := e.discoveredDevices[deviceId]
-	info, paired := e.pairedDevices[deviceId]
+	_, discovered := e.discoveredDevices[deviceId]
+	_, paired := e.pairedDevices[deviceId]
 	e.mu.RUnlock()
 
-	var ip string
-	var port int
-	if discovered {
-		ip = dev.Addr.IP.String()
-		port = dev.Identity.TcpPort
-	} else if paired {
-		ip = info.LastIP
-		port = info.LastPort
-	} else {
-		return nil, fmt.Errorf("device %s not found", deviceId)
+	if !discovered && !paired {
+		err := fmt.Errorf("%w: %s", ErrDeviceNotFound, deviceId)
+		e.emitConnectionError(deviceId, err)
+		return nil, err
 	}
 
-	if ip == "" || port == 0 {
-		fmt.Printf("Connection error for %s: IP='%s', Port=%d (discovered=%v, paired=%v)\n", deviceId, ip, port, discovered, paired)
-		return nil, fmt.Errorf("missing address for device %s", deviceId)
+	addrs := e.connectCandidates(deviceId)
+	if len(addrs) == 0 {
+		fmt.Printf("Connection error for %s: no usable address (discovered=%v, paired=%v)\n", deviceId, discovered, paired)
+		err := fmt.Errorf("%w: missing address for device %s", ErrDeviceNotFound, deviceId)
+		e.emitConnectionError(deviceId, err)
+		return nil, err
 	}
 
-	newConn, err := network.Connect(ip, port, e.Cert, e.Identity)
-	if err != nil {
+	// Try each address in turn; a phone that roamed between networks may
+	// still be reachable at an older one
+	var newConn *network.Connection
+	var err error
+	deadline := time.Now().Add(connectTotalTimeout)
+	for _, addr := range addrs {
+		timeout := min(connectAttemptTimeout, time.Until(deadline))
+		if timeout <= 0 {
+			break
+		}
+		e.deviceStats(deviceId).connectAttempts.Add(1)
+		newConn, err = e.dial(deviceId, addr.IP.String(), addr.Port, timeout)
+		if err == nil {
+			e.rememberAddr(deviceId, addr)
+			break
+		}
+		fmt.Printf("Connecting to %s at %s failed: %v\n", deviceId, addr, err)
+	}
+	if newConn == nil {
+		if err == nil {
+			err = fmt.Errorf("timed out connecting to %s", deviceId)
+		}
+		e.emitConnectionError(deviceId, err)
 		return nil, err
 	}
 
-	e.mu.Lock()
-	e.activeConns[deviceId] = newConn
-	e.mu.Unlock()
-
-	newConn.OnPacket = func(p protocol.Packet) {
-		e.handlePacket(newConn, p)
-	}
-	newConn.OnDisconnect = func() {
-		e.mu.Lock()
-		delete(e.activeConns, deviceId)
-		e.mu.Unlock()
+	if !e.handleNewConnection(newConn) {
+		err := fmt.Errorf("%w: %s must be paired again", ErrCertificateChanged, e.DeviceName(deviceId))
+		e.emitConnectionError(deviceId, err)
+		return nil, err
 	}
 	go newConn.StartLoop()
 
 	return newConn, nil
 }
 
+func (e *Engine) emitConnectionError(deviceId string, err error) {
+	e.recordConnectionError(deviceId, err)
+	name := e.DeviceName(deviceId)
+
+	var msg string
+	var netErr net.Error
+	if errors.Is(err, ErrDeviceNotFound) {
+		msg = fmt.Sprintf("Couldn't find %s: no known address", name)
+	} else if errors.As(err, &netErr) && netErr.Timeout() {
+		msg = fmt.Sprintf("Couldn't reach %s: connection timed out", name)
+	} else {
+		msg = fmt.Sprintf("Couldn't reach %s: %v", name, err)
+	}
+
+	e.Events.Emit("connection_error", ConnectionError{
+		DeviceId: deviceId,
+		Message:  msg,
+		Err:      err,
+	})
+}
+
+// DeviceName returns the display name of a known device, or its id.
+func (e *Engine) DeviceName(deviceId string) string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if dev, ok := e.discoveredDevices[deviceId]; ok && dev.Identity.DeviceName != "" {
+		return dev.Identity.DeviceName
+	}
+	if info, ok := e.pairedDevices[deviceId]; ok && info.Identity.DeviceName != "" {
+		return info.Identity.DeviceName
+	}
+	return deviceId
+}
+
 func (e *Engine) SendPacket(deviceId string, pType string, body interface{}) error {
 	conn, err := e.getOrConnect(deviceId)
 	if err != nil {
@@ -368,22 +845,40 @@ func (e *Engine) SendPacket(deviceId string, pType string, body interface{}) err
 	return conn.SendPacket(pType, body)
 }
 
-func (e *Engine) triggerSftpBrowse(deviceId string) error {
-	fmt.Printf("Sending SFTP browse request to %s...\n", deviceId)
+// sendDroppable sends a packet that later ones of its kind supersede, which
+// is dropped rather than failing when the device falls behind.
+func (e *Engine) sendDroppable(deviceId string, pType string, body interface{}) error {
+	conn, err := e.getOrConnect(deviceId)
+	if err != nil {
+		return err
+	}
+	return conn.SendDroppable(pType, body)
+}
 
-	return e.SendPacket(deviceId, "kdeconnect.sftp.request", protocol.SftpBody{
-		StartBrowsing: true,
-	})
+// SendPing sends a ping, optionally carrying a message the device displays.
+func (e *Engine) SendPing(deviceId, message string) error {
+	if !e.DeviceSupports(deviceId, "kdeconnect.ping") {
+		return fmt.Errorf("device %s does not support ping", deviceId)
+	}
+	return e.SendPacket(deviceId, "kdeconnect.ping", protocol.PingBody{Message: message})
 }
 
 func (e *Engine) MarkAsPaired(deviceId string) {
 	e.mu.Lock()
 	if dev, ok := e.discoveredDevices[deviceId]; ok {
-		e.pairedDevices[deviceId] = PairedDeviceInfo{
-			Identity: dev.Identity,
-			LastIP:   dev.Addr.IP.String(),
-			LastPort: dev.Addr.Port,
+		info := PairedDeviceInfo{Identity: dev.Identity}
+		// A Bluetooth connection has no IP address; keep the last one known
+		if dev.Addr != nil && !dev.Addr.IP.IsUnspecified() {
+			info.LastIP = dev.Addr.IP.String()
+			info.LastPort = dev.Addr.Port
+		} else if prev, ok := e.pairedDevices[deviceId]; ok {
+			info.LastIP = prev.LastIP
+			info.LastPort = prev.LastPort
+		}
+		if conn, ok := e.activeConns[deviceId]; ok {
+			info.Fingerprint = certFingerprint(conn.PeerCertificate())
 		}
+		e.pairedDevices[deviceId] = info
 	}
 	e.mu.Unlock()
 	e.SaveConfig()
@@ -400,6 +895,46 @@ func (e *Engine) GetPairedDevices() []PairedDeviceInfo {
 	return devices
 }
 
+// ConnectionInfo describes an active connection to a device.
+type ConnectionInfo struct {
+	DeviceId        string            `json:"deviceId"`
+	RemoteAddr      string            `json:"remoteAddr"`
+	Transport       network.Transport `json:"transport"`
+	Since           time.Time         `json:"since"`
+	ProtocolVersion int               `json:"protocolVersion"`
+}
+
+// GetActiveConnections lists the devices we have a connection to, by id.
+func (e *Engine) GetActiveConnections() []ConnectionInfo {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	conns := make([]ConnectionInfo, 0, len(e.activeConns))
+	for deviceId, conn := range e.activeConns {
+		info := ConnectionInfo{
+			DeviceId:        deviceId,
+			Transport:       conn.Transport,
+			Since:           conn.Since,
+			ProtocolVersion: conn.RemoteIdentity.ProtocolVersion,
+		}
+		if addr := conn.Conn.RemoteAddr(); addr != nil {
+			info.RemoteAddr = addr.String()
+		}
+		conns = append(conns, info)
+	}
+	slices.SortFunc(conns, func(a, b ConnectionInfo) int { return strings.Compare(a.DeviceId, b.DeviceId) })
+	return conns
+}
+
+func (e *Engine) GetDiscoveredDevices() []DiscoveredDevice {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	devices := make([]DiscoveredDevice, 0, len(e.discoveredDevices))
+	for _, dev := range e.discoveredDevices {
+		devices = append(devices, dev)
+	}
+	return devices
+}
+
 func (e *Engine) addDiscoveredDevice(identity protocol.IdentityBody, addr *net.UDPAddr) {
 	e.mu.Lock()
 	defer e.mu.Unlock() // Use defer to ensure unlock
@@ -408,39 +943,118 @@ func (e *Engine) addDiscoveredDevice(identity protocol.IdentityBody, addr *net.U
 		identity.TcpPort = 1716 // Default KDE Connect port
 	}
 
-	dev := DiscoveredDevice{Identity: identity, Addr: addr}
+	// Some discovery paths don't carry capabilities; keep the ones we know
+	if known, ok := e.discoveredDevices[identity.DeviceId]; ok && len(identity.IncomingCapabilities) == 0 && len(identity.OutgoingCapabilities) == 0 {
+		identity.IncomingCapabilities = known.Identity.IncomingCapabilities
+		identity.OutgoingCapabilities = known.Identity.OutgoingCapabilities
+	}
+
+	// The same device can be seen over UDP, mDNS and Bluetooth, so keep every
+	// usable address and prefer a LAN one over placeholders
+	if addr != nil {
+		addr = &net.UDPAddr{IP: addr.IP, Port: identity.TcpPort, Zone: addr.Zone}
+	}
+	candidates := mergeCandidates(e.discoveredDevices[identity.DeviceId].Candidates, addr)
+	if best := bestAddr(candidates); best != nil {
+		addr = best
+	} else if addr == nil {
+		addr = &net.UDPAddr{IP: net.IPv4zero, Port: identity.TcpPort}
+	}
+
+	dev := DiscoveredDevice{Identity: identity, Addr: addr, Candidates: candidates}
 	e.discoveredDevices[identity.DeviceId] = dev
 
 	// Update paired device info if it exists to persist last known IP
 	changed := false
 	if info, ok := e.pairedDevices[identity.DeviceId]; ok {
-		if info.LastIP != addr.IP.String() || info.LastPort != identity.TcpPort || info.Identity.DeviceName != identity.DeviceName {
+		if info.Identity.DeviceName != identity.DeviceName || !sameCapabilities(info.Identity, identity) {
+			info.Identity = identity
+			changed = true
+		}
+		// Don't forget a good address because the device showed up over Bluetooth
+		if !isPlaceholderAddr(addr) && (info.LastIP != addr.IP.String() || info.LastPort != identity.TcpPort) {
 			info.LastIP = addr.IP.String()
 			info.LastPort = identity.TcpPort
 			info.Identity = identity
-			e.pairedDevices[identity.DeviceId] = info
 			changed = true
 		}
+		if changed {
+			e.pairedDevices[identity.DeviceId] = info
+		}
 	}
 
 	if changed {
-		go e.SaveConfig() // Save in background
+		e.scheduleSave()
 	}
 
 	e.Events.Emit("device_discovered", dev)
 }
 
-func (e *Engine) Pair(deviceId string) error {
+func sameCapabilities(a, b protocol.IdentityBody) bool {
+	return slices.Equal(a.IncomingCapabilities, b.IncomingCapabilities) &&
+		slices.Equal(a.OutgoingCapabilities, b.OutgoingCapabilities)
+}
+
+// Pair sends a pair request. It returns the verification key the device will
+// show, so the user can compare the two before accepting on the device.
+func (e *Engine) Pair(deviceId string) (string, error) {
+	conn, err := e.getOrConnect(deviceId)
+	if err != nil {
+		return "", err
+	}
+
+	timestamp := time.Now().Unix()
 	e.mu.Lock()
-	e.pendingPairing[deviceId] = true
+	e.pendingPairing[deviceId] = timestamp
 	e.mu.Unlock()
 
-	return e.SendPacket(deviceId, "kdeconnect.pair", protocol.PairBody{
+	err = conn.SendPacket("kdeconnect.pair", protocol.PairBody{
 		Pair:      true,
+		Timestamp: timestamp,
+	})
+	if err != nil {
+		e.mu.Lock()
+		delete(e.pendingPairing, deviceId)
+		e.mu.Unlock()
+		return "", err
+	}
+	return e.verificationKey(conn, timestamp), nil
+}
+
+// CancelPairing retracts our outstanding pair request. It does nothing if no
+// request is pending, so it can't unpair an established pairing.
+func (e *Engine) CancelPairing(deviceId string) error {
+	e.mu.Lock()
+	_, isPending := e.pendingPairing[deviceId]
+	delete(e.pendingPairing, deviceId)
+	_, paired := e.pairedDevices[deviceId]
+	e.mu.Unlock()
+
+	if !isPending || paired {
+		return nil
+	}
+	return e.SendPacket(deviceId, "kdeconnect.pair", protocol.PairBody{
+		Pair:      false,
 		Timestamp: time.Now().Unix(),
 	})
 }
 
+// verificationKey derives the key both sides display from the two
+// certificates and the pair request's timestamp. It is empty when the peer
+// presented no certificate.
+func (e *Engine) verificationKey(conn *network.Connection, timestamp int64) string {
+	peerCert := conn.PeerCertificate()
+	if peerCert == nil {
+		return ""
+	}
+	myCert, err := x509.ParseCertificate(e.Cert.Certificate[0])
+	if err != nil {
+		return ""
+	}
+	key, _ := protocol.GetVerificationKey(myCert, peerCert, timestamp)
+	return key
+}
+
 func (e *Engine) Unpair(deviceId string) error {
 	e.mu.Lock()
 	_, ok := e.pairedDevices[deviceId]
@@ -449,8 +1063,11 @@ func (e *Engine) Unpair(deviceId string) error {
 		return fmt.Errorf("device not paired")
 	}
 	delete(e.pairedDevices, deviceId)
+	delete(e.lastPaths, deviceId)
 	e.mu.Unlock()
+	e.devStats.Delete(deviceId)
 
+	e.stopSftpServer(deviceId)
 	e.SaveConfig()
 	e.Events.Emit("pairing_changed", deviceId)
 
@@ -466,37 +1083,80 @@ func (e *Engine) Unpair(deviceId string) error {
 	return nil
 }
 
-func (e *Engine) AcceptPair(remoteIP string) {
+// ResetPairings unpairs every paired device.
+func (e *Engine) ResetPairings() {
 	e.mu.RLock()
-	var targetConn *network.Connection
-	for _, conn := range e.activeConns {
-		if ip, _, _ := net.SplitHostPort(conn.Conn.RemoteAddr().String()); ip == remoteIP {
-			targetConn = conn
-			break
-		}
+	ids := make([]string, 0, len(e.pairedDevices))
+	for id := range e.pairedDevices {
+		ids = append(ids, id)
 	}
 	e.mu.RUnlock()
 
-	if targetConn != nil {
-		err := targetConn.SendPacket("kdeconnect.pair", protocol.PairBody{
-			Pair:      true,
-			Timestamp: time.Now().Unix(),
-		})
-		if err != nil {
-			fmt.Printf("Error sending pair response: %v\n", err)
-		}
-	} else {
-		// If no active connection, we might need to initiate one?
-		// But usually we receive a pair request over a connection.
-		fmt.Printf("AcceptPair: No active connection found for %s\n", remoteIP)
+	for _, id := range ids {
+		e.Unpair(id)
+	}
+}
+
+// RegenerateIdentity unpairs all devices and persists a new deviceId and
+// certificate. The running server and discovery keep the old identity, so
+// the app must be restarted for it to take effect.
+func (e *Engine) RegenerateIdentity() error {
+	e.mu.RLock()
+	deviceName := e.Identity.DeviceName
+	e.mu.RUnlock()
+
+	identity, cert, certPEM, privPEM, err := generateIdentity(deviceName, e.certKeyType())
+	if err != nil {
+		return err
+	}
+
+	e.ResetPairings()
+
+	e.mu.Lock()
+	e.Identity = identity
+	e.Cert = cert
+	e.knownHosts = make(map[string]string)
+	e.mu.Unlock()
+
+	if err := e.SaveCertificate(certPEM, privPEM); err != nil {
+		return err
+	}
+	return e.SaveConfig()
+}
+
+// AcceptPair answers a pair request from the device over its connection,
+// whichever transport that is.
+func (e *Engine) AcceptPair(deviceId string) {
+	e.mu.RLock()
+	conn, ok := e.activeConns[deviceId]
+	e.mu.RUnlock()
+	if !ok {
+		// Pair requests arrive over a connection, so it has gone since
+		fmt.Printf("AcceptPair: No active connection to %s\n", deviceId)
+		return
+	}
+
+	err := conn.SendPacket("kdeconnect.pair", protocol.PairBody{
+		Pair:      true,
+		Timestamp: time.Now().Unix(),
+	})
+	if err != nil {
+		fmt.Printf("Error sending pair response: %v\n", err)
 	}
 }
 
+// GetDeviceByIP finds the device at ip, in any of the forms an IPv6 address
+// can be written.
 func (e *Engine) GetDeviceByIP(ip string) (DiscoveredDevice, bool) {
+	want := parseIP(ip)
+	if want == nil {
+		return DiscoveredDevice{}, false
+	}
+
 	e.mu.RLock()
 	defer e.mu.RUnlock()
 	for _, dev := range e.discoveredDevices {
-		if dev.Addr.IP.String() == ip {
+		if dev.Addr != nil && want.Equal(dev.Addr.IP) {
 			return dev, true
 		}
 	}
@@ -521,10 +1181,9 @@ func (e *Engine) ConnectSFTP(deviceId string) (*sftp.Client, error) {
 		e.mu.RUnlock()
 		if hasPd && pd.LastIP != "" {
 			fmt.Printf("Device %s not discovered, attempting last known address: %s:%d\n", deviceId, pd.LastIP, pd.LastPort)
-			addr, _ := net.ResolveUDPAddr("udp", net.JoinHostPort(pd.LastIP, fmt.Sprintf("%d", pd.LastPort)))
 			dev = DiscoveredDevice{
 				Identity: pd.Identity,
-				Addr:     addr,
+				Addr:     resolveAddr(pd.LastIP, pd.LastPort),
 			}
 		} else {
 			fmt.Printf("Device %s is paired but not yet discovered. Waiting for discovery...\n", deviceId)
@@ -540,7 +1199,8 @@ func (e *Engine) ConnectSFTP(deviceId string) (*sftp.Client, error) {
 					}
 				}
 			}
-			e.Events.On("device_discovered", dHandler)
+			h := e.Events.On("device_discovered", dHandler)
+			defer e.Events.Off(h)
 
 			select {
 			case dev = <-foundChan:
@@ -551,39 +1211,14 @@ func (e *Engine) ConnectSFTP(deviceId string) (*sftp.Client, error) {
 		}
 	}
 
-	// 1. Prepare to wait for offer
-	offerChan := make(chan protocol.SftpBody, 1)
-	var handler events.Listener
-	handler = func(data interface{}) {
-		id := data.(string)
-		if id == deviceId {
-			e.mu.RLock()
-			offer, ok := e.sftpOffers[deviceId]
-			e.mu.RUnlock()
-			if ok {
-				select {
-				case offerChan <- offer:
-				default:
-				}
-			}
+	offer, ok := e.freshSftpOffer(deviceId)
+	if !ok {
+		var err error
+		offer, err = e.requestSftpOffer(deviceId)
+		if err != nil {
+			return nil, err
 		}
 	}
-	e.Events.On("sftp_offer", handler)
-	defer e.Events.Off("sftp_offer", handler)
-
-	// 2. Send startBrowsing request
-	if err := e.triggerSftpBrowse(deviceId); err != nil {
-		return nil, err
-	}
-
-	fmt.Println("Waiting for SFTP offer...")
-	var offer protocol.SftpBody
-	select {
-	case offer = <-offerChan:
-		fmt.Printf("Got SFTP offer: %+v\n", offer)
-	case <-time.After(10 * time.Second):
-		return nil, fmt.Errorf("timeout waiting for SFTP offer")
-	}
 
 	if offer.ErrorMessage != "" {
 		return nil, fmt.Errorf("remote error: %s", offer.ErrorMessage)
@@ -593,21 +1228,26 @@ func (e *Engine) ConnectSFTP(deviceId string) (*sftp.Client, error) {
 		return nil, fmt.Errorf("no port provided in SFTP offer")
 	}
 
+	var presentedKey string
 	config := &ssh.ClientConfig{
 		User: offer.User,
 		Auth: []ssh.AuthMethod{
 			ssh.Password(offer.Password),
 		},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		HostKeyCallback: e.sftpHostKeyCallback(deviceId, &presentedKey),
 		Timeout:         10 * time.Second,
 	}
 
+	if isPlaceholderAddr(dev.Addr) {
+		return nil, fmt.Errorf("no network address for %s", deviceId)
+	}
 	addr := net.JoinHostPort(dev.Addr.IP.String(), fmt.Sprintf("%d", offer.Port))
 	fmt.Printf("Dialing SFTP at %s\n", addr)
 	client, err := ssh.Dial("tcp", addr, config)
 	if err != nil {
 		return nil, fmt.Errorf("ssh dial failed: %w", err)
 	}
+	e.pinSftpHostKey(deviceId, presentedKey)
 
 	sftpClient, err := sftp.NewClient(client)
 	if err != nil {
@@ -617,6 +1257,70 @@ func (e *Engine) ConnectSFTP(deviceId string) (*sftp.Client, error) {
 	return sftpClient, nil
 }
 
+// sftpHostKeyCallback verifies the SFTP server key against the one pinned for
+// the device (trust on first use). The presented key is stored in *presented
+// so it can be pinned once the connection succeeds.
+func (e *Engine) sftpHostKeyCallback(deviceId string, presented *string) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		keyStr := base64.StdEncoding.EncodeToString(key.Marshal())
+		*presented = keyStr
+
+		e.mu.RLock()
+		known, ok := e.knownHosts[deviceId]
+		e.mu.RUnlock()
+
+		if !ok || known == keyStr {
+			return nil
+		}
+
+		e.Events.Emit("security_warning", SecurityWarning{
+			DeviceId:     deviceId,
+			Message:      fmt.Sprintf("The SFTP host key of %s has changed (now %s). Someone may be intercepting the connection.", deviceId, ssh.FingerprintSHA256(key)),
+			PresentedKey: keyStr,
+		})
+		return fmt.Errorf("sftp host key mismatch for device %s", deviceId)
+	}
+}
+
+func (e *Engine) pinSftpHostKey(deviceId, key string) {
+	e.mu.Lock()
+	known, ok := e.knownHosts[deviceId]
+	if ok && known == key {
+		e.mu.Unlock()
+		return
+	}
+	e.knownHosts[deviceId] = key
+	e.mu.Unlock()
+	e.SaveConfig()
+}
+
+// TrustSftpHostKey replaces the pinned SFTP host key of a device, e.g. after
+// the user confirmed a security_warning.
+func (e *Engine) TrustSftpHostKey(deviceId, key string) {
+	e.pinSftpHostKey(deviceId, key)
+}
+
+func (e *Engine) requestSftpOffer(deviceId string) (protocol.SftpBody, error) {
+	if !e.DeviceSupports(deviceId, "kdeconnect.sftp.request") {
+		return protocol.SftpBody{}, fmt.Errorf("device %s does not support file browsing", deviceId)
+	}
+	fmt.Printf("Sending SFTP browse request to %s...\n", deviceId)
+
+	p, err := e.Request(deviceId, "kdeconnect.sftp.request", protocol.SftpBody{StartBrowsing: true}, "kdeconnect.sftp", 10*time.Second)
+	if err != nil {
+		return protocol.SftpBody{}, err
+	}
+	var offer protocol.SftpBody
+	if err := json.Unmarshal(p.Body, &offer); err != nil {
+		return protocol.SftpBody{}, fmt.Errorf("invalid SFTP offer: %w", err)
+	}
+	if err := offer.Validate(); err != nil {
+		return protocol.SftpBody{}, fmt.Errorf("invalid SFTP offer: %w", err)
+	}
+	fmt.Printf("Got SFTP offer: %v\n", offer)
+	return offer, nil
+}
+
 func getBluetoothAddress() string {
 	// macOS implementation
 	out, err := exec.Command("system_profiler", "SPBluetoothDataType").Output()
@@ -0,0 +1,812 @@
+package core
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/barishamil/kde-connect-fyne/internal/network"
+	"github.com/barishamil/kde-connect-fyne/internal/protocol"
+)
+
+// newTestEngine returns an engine that keeps its config in a temporary
+// directory, with its certificate ready.
+func newTestEngine(t *testing.T) *Engine {
+	t.Helper()
+	e, err := NewEngineWithConfigDir("Test Desktop", t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.waitCert(); err != nil {
+		t.Fatal(err)
+	}
+	// Write pending saves before the directory is removed
+	t.Cleanup(func() {
+		e.Stop()
+		e.FlushConfig()
+	})
+	return e
+}
+
+var testDevices atomic.Int64
+
+// testIdentity returns the identity of a new phone.
+func testIdentity() protocol.IdentityBody {
+	return protocol.IdentityBody{
+		DeviceId:        fmt.Sprintf("test_phone_%022d", testDevices.Add(1)),
+		DeviceName:      "Test Phone",
+		DeviceType:      "phone",
+		ProtocolVersion: 8,
+		TcpPort:         1716,
+	}
+}
+
+// fakeDevice is the phone's end of a connection handed to an engine. It
+// records the packets the engine sends it.
+type fakeDevice struct {
+	id       string
+	conn     *network.Connection
+	received chan protocol.Packet
+}
+
+// connectDevice connects the device to e over an in-memory connection.
+func connectDevice(t *testing.T, e *Engine, identity protocol.IdentityBody) *fakeDevice {
+	t.Helper()
+	return connectDeviceOver(t, e, identity, network.TransportLAN)
+}
+
+// connectDeviceOver is connectDevice with the connection posing as transport.
+func connectDeviceOver(t *testing.T, e *Engine, identity protocol.IdentityBody, transport network.Transport) *fakeDevice {
+	t.Helper()
+	conn, remote := network.PipeConnection(e.Identity, identity)
+	conn.Transport = transport
+	d := startDevice(t, e, identity, conn, remote)
+	if d == nil {
+		t.Fatalf("connection from %s refused", identity.DeviceId)
+	}
+	return d
+}
+
+// connectDeviceWithCert is connectDeviceOver with TLS, the device presenting
+// cert. It returns nil if e refuses the connection.
+func connectDeviceWithCert(t *testing.T, e *Engine, identity protocol.IdentityBody, cert *tls.Certificate, transport network.Transport) *fakeDevice {
+	t.Helper()
+	a, b := net.Pipe()
+	server := tls.Server(a, &tls.Config{
+		Certificates:           []tls.Certificate{*e.Cert},
+		ClientAuth:             tls.RequireAnyClientCert,
+		SessionTicketsDisabled: true,
+	})
+	client := tls.Client(b, &tls.Config{
+		Certificates:       []tls.Certificate{*cert},
+		InsecureSkipVerify: true,
+	})
+	errc := make(chan error, 1)
+	go func() { errc <- server.Handshake() }()
+	if err := client.Handshake(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	conn := network.NewConnection(server, identity.DeviceId, identity)
+	conn.Transport = transport
+	remote := network.NewConnection(client, e.Identity.DeviceId, e.Identity)
+	return startDevice(t, e, identity, conn, remote)
+}
+
+// startDevice hands conn to e, with remote as the device's end. It returns
+// nil if e refuses the connection.
+func startDevice(t *testing.T, e *Engine, identity protocol.IdentityBody, conn, remote *network.Connection) *fakeDevice {
+	d := &fakeDevice{id: identity.DeviceId, conn: remote, received: make(chan protocol.Packet, 64)}
+	remote.OnPacket = func(p protocol.Packet) { d.received <- p }
+	go remote.StartLoop()
+	t.Cleanup(func() { remote.Close() })
+
+	if !e.handleNewConnection(conn) {
+		return nil
+	}
+	go conn.StartLoop()
+	return d
+}
+
+// newCert returns a certificate for a device.
+func newCert(t *testing.T) *tls.Certificate {
+	t.Helper()
+	cert, _, _, err := protocol.GenerateCertificate("device", protocol.KeyTypeEC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.Leaf == nil {
+		cert.Leaf, _ = x509.ParseCertificate(cert.Certificate[0])
+	}
+	return &cert
+}
+
+// send sends a packet to the engine as the device.
+func (d *fakeDevice) send(t *testing.T, pType string, body interface{}) {
+	t.Helper()
+	if err := d.conn.SendPacket(pType, body); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// expect waits for the engine to send a packet of type pType, skipping any
+// others, and decodes its body into body if that is not nil.
+func (d *fakeDevice) expect(t *testing.T, pType string, body interface{}) protocol.Packet {
+	t.Helper()
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case p := <-d.received:
+			if p.Type != pType {
+				continue
+			}
+			if body != nil {
+				if err := json.Unmarshal(p.Body, body); err != nil {
+					t.Fatalf("decoding %s: %v", pType, err)
+				}
+			}
+			return p
+		case <-timeout:
+			t.Fatalf("no %s sent", pType)
+		}
+	}
+}
+
+// expectNone fails if the engine sends a packet of type pType within wait.
+func (d *fakeDevice) expectNone(t *testing.T, pType string, wait time.Duration) {
+	t.Helper()
+	timeout := time.After(wait)
+	for {
+		select {
+		case p := <-d.received:
+			if p.Type == pType {
+				t.Fatalf("unexpected %s sent: %s", pType, p.Body)
+			}
+		case <-timeout:
+			return
+		}
+	}
+}
+
+// sync waits until the engine has handled every packet the device sent so
+// far, which it does in order.
+func (d *fakeDevice) sync(t *testing.T, e *Engine) {
+	t.Helper()
+	synced := make(chan struct{}, 1)
+	h := e.Events.On("ping_received", func(data interface{}) {
+		if ping := data.(PingReceived); ping.DeviceId == d.id && ping.Message == "sync" {
+			select {
+			case synced <- struct{}{}:
+			default:
+			}
+		}
+	})
+	defer e.Events.Off(h)
+
+	d.send(t, "kdeconnect.ping", protocol.PingBody{Message: "sync"})
+	select {
+	case <-synced:
+	case <-time.After(2 * time.Second):
+		t.Fatal("engine did not handle the device's packets")
+	}
+}
+
+// watchEvent collects the data of the engine's name events until the test
+// ends.
+func watchEvent(t *testing.T, e *Engine, name string) chan interface{} {
+	ch := make(chan interface{}, 16)
+	h := e.Events.On(name, func(data interface{}) { ch <- data })
+	t.Cleanup(func() { e.Events.Off(h) })
+	return ch
+}
+
+func TestConnectSFTPRequestsFreshOffer(t *testing.T) {
+	e := newTestEngine(t)
+	phone := testIdentity()
+	d := connectDevice(t, e, phone)
+
+	e.mu.Lock()
+	e.pairedDevices[phone.DeviceId] = PairedDeviceInfo{Identity: phone}
+	e.sftpOffers[phone.DeviceId] = sftpOffer{
+		body:     protocol.SftpBody{Port: 1739, User: "kdeconnect", Password: "stale"},
+		received: time.Now().Add(-5 * time.Minute),
+	}
+	e.mu.Unlock()
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := e.ConnectSFTP(phone.DeviceId)
+		errc <- err
+	}()
+
+	var req protocol.SftpBody
+	d.expect(t, "kdeconnect.sftp.request", &req)
+	if !req.StartBrowsing {
+		t.Fatalf("request without startBrowsing: %+v", req)
+	}
+	// Fail the new offer so nothing is dialed
+	d.send(t, "kdeconnect.sftp", protocol.SftpBody{ErrorMessage: "no storage"})
+
+	select {
+	case err := <-errc:
+		if err == nil || !strings.Contains(err.Error(), "no storage") {
+			t.Fatalf("ConnectSFTP did not use the fresh offer: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ConnectSFTP did not return")
+	}
+}
+
+func TestPingIsNotEchoed(t *testing.T) {
+	e := newTestEngine(t)
+	phone := testIdentity()
+	d := connectDevice(t, e, phone)
+
+	received := make(chan PingReceived, 1)
+	h := e.Events.On("ping_received", func(data interface{}) {
+		received <- data.(PingReceived)
+	})
+	defer e.Events.Off(h)
+
+	d.send(t, "kdeconnect.ping", protocol.PingBody{Message: "hello"})
+	select {
+	case ping := <-received:
+		if ping.DeviceId != phone.DeviceId || ping.Message != "hello" {
+			t.Fatalf("wrong ping_received: %+v", ping)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no ping_received")
+	}
+	d.expectNone(t, "kdeconnect.ping", 200*time.Millisecond)
+}
+
+func TestHandlePairAndSftpPackets(t *testing.T) {
+	offer := protocol.SftpBody{Ip: "192.0.2.7", Port: 1739, User: "kdeconnect", Password: "secret", Path: "/storage/emulated/0"}
+	tests := []struct {
+		name  string
+		setup func(e *Engine, phone protocol.IdentityBody)
+		pType string
+		body  interface{}
+		// event must be emitted, with the device as its data where that
+		// is a device id
+		event  string
+		paired bool
+		offer  bool
+	}{
+		{
+			name:  "pair request",
+			pType: "kdeconnect.pair",
+			body:  protocol.PairBody{Pair: true, Timestamp: time.Now().Unix()},
+			event: "pair_request",
+		},
+		{
+			name: "pair accepted",
+			setup: func(e *Engine, phone protocol.IdentityBody) {
+				e.pendingPairing[phone.DeviceId] = time.Now().Unix()
+			},
+			pType:  "kdeconnect.pair",
+			body:   protocol.PairBody{Pair: true, Timestamp: time.Now().Unix()},
+			event:  "pairing_changed",
+			paired: true,
+		},
+		{
+			name: "unpair",
+			setup: func(e *Engine, phone protocol.IdentityBody) {
+				e.pairedDevices[phone.DeviceId] = PairedDeviceInfo{Identity: phone}
+			},
+			pType: "kdeconnect.pair",
+			body:  protocol.PairBody{Pair: false, Timestamp: time.Now().Unix()},
+			event: "pairing_changed",
+		},
+		{
+			name:  "sftp offer",
+			pType: "kdeconnect.sftp",
+			body:  offer,
+			event: "sftp_offer",
+			offer: true,
+		},
+		{
+			name:  "browse request is not an offer",
+			pType: "kdeconnect.sftp",
+			body:  protocol.SftpBody{StartBrowsing: true},
+		},
+	}
+
+	e := newTestEngine(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			phone := testIdentity()
+			d := connectDevice(t, e, phone)
+			if tt.setup != nil {
+				e.mu.Lock()
+				tt.setup(e, phone)
+				e.mu.Unlock()
+			}
+			var events chan interface{}
+			if tt.event != "" {
+				events = watchEvent(t, e, tt.event)
+			}
+
+			d.send(t, tt.pType, tt.body)
+			d.sync(t, e)
+
+			if events != nil {
+				select {
+				case data := <-events:
+					if id, ok := data.(string); ok && id != phone.DeviceId {
+						t.Errorf("%s for %s, want %s", tt.event, id, phone.DeviceId)
+					}
+					if req, ok := data.(PairRequest); ok && req.Identity.DeviceId != phone.DeviceId {
+						t.Errorf("pair_request for %s, want %s", req.Identity.DeviceId, phone.DeviceId)
+					}
+				case <-time.After(2 * time.Second):
+					t.Fatalf("no %s", tt.event)
+				}
+			}
+			if got := e.IsPaired(phone.DeviceId); got != tt.paired {
+				t.Errorf("paired = %v, want %v", got, tt.paired)
+			}
+			got, ok := e.GetSftpOffer(phone.DeviceId)
+			if ok != tt.offer {
+				t.Errorf("offer stored = %v, want %v", ok, tt.offer)
+			} else if ok && !reflect.DeepEqual(got, offer) {
+				t.Errorf("offer = %+v, want %+v", got, offer)
+			}
+		})
+	}
+}
+
+func TestPairRejected(t *testing.T) {
+	e := newTestEngine(t)
+	phone := testIdentity()
+	d := connectDevice(t, e, phone)
+	rejected := watchEvent(t, e, "pair_rejected")
+
+	if _, err := e.Pair(phone.DeviceId); err != nil {
+		t.Fatal(err)
+	}
+	var req protocol.PairBody
+	d.expect(t, "kdeconnect.pair", &req)
+	if !req.Pair {
+		t.Fatalf("pair request with pair false")
+	}
+
+	d.send(t, "kdeconnect.pair", protocol.PairBody{Pair: false, Timestamp: time.Now().Unix()})
+	select {
+	case id := <-rejected:
+		if id != phone.DeviceId {
+			t.Fatalf("pair_rejected for %v", id)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no pair_rejected")
+	}
+	if e.IsPaired(phone.DeviceId) {
+		t.Fatal("paired after the device rejected")
+	}
+	e.mu.RLock()
+	_, pending := e.pendingPairing[phone.DeviceId]
+	e.mu.RUnlock()
+	if pending {
+		t.Fatal("request still pending after the device rejected")
+	}
+	// A rejection is not an unpair, so nothing is sent back
+	d.expectNone(t, "kdeconnect.pair", 200*time.Millisecond)
+}
+
+// connected reports whether e has a connection to the device.
+func connected(e *Engine, deviceId string) bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	_, ok := e.activeConns[deviceId]
+	return ok
+}
+
+func TestIdleTimeoutDropsSilentDevice(t *testing.T) {
+	e := newTestEngine(t)
+	if err := e.SetIdleTimeout(100 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	phone := testIdentity()
+	d := connectDevice(t, e, phone)
+
+	// Packets keep it connected
+	for i := 0; i < 4; i++ {
+		time.Sleep(50 * time.Millisecond)
+		d.send(t, "kdeconnect.ping", protocol.PingBody{})
+	}
+	if !connected(e, phone.DeviceId) {
+		t.Fatal("dropped a device that kept sending")
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for connected(e, phone.DeviceId) {
+		if time.Now().After(deadline) {
+			t.Fatal("silent device not dropped")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestConnectSFTPRemovesListeners(t *testing.T) {
+	e := newTestEngine(t)
+	phone := testIdentity()
+	phone.IncomingCapabilities = []string{"kdeconnect.sftp.request"}
+	d := connectDevice(t, e, phone)
+	e.mu.Lock()
+	e.pairedDevices[phone.DeviceId] = PairedDeviceInfo{Identity: phone}
+	e.mu.Unlock()
+	baseline := e.Events.ListenerCount()
+
+	for i := 0; i < 50; i++ {
+		// Every other call waits for the device to be discovered first
+		e.mu.Lock()
+		delete(e.sftpOffers, phone.DeviceId)
+		if i%2 == 1 {
+			delete(e.discoveredDevices, phone.DeviceId)
+			// Discovery records the address; forget it so the call waits
+			e.pairedDevices[phone.DeviceId] = PairedDeviceInfo{Identity: phone}
+		}
+		e.mu.Unlock()
+
+		errc := make(chan error, 1)
+		go func() {
+			_, err := e.ConnectSFTP(phone.DeviceId)
+			errc <- err
+		}()
+
+		if i%2 == 1 {
+			for deadline := time.Now().Add(2 * time.Second); e.Events.ListenerCount() == baseline; {
+				if time.Now().After(deadline) {
+					t.Fatal("ConnectSFTP did not wait for discovery")
+				}
+				time.Sleep(time.Millisecond)
+			}
+			e.addDiscoveredDevice(phone, udpAddr("192.0.2.7", 1716))
+		}
+		d.expect(t, "kdeconnect.sftp.request", nil)
+		d.send(t, "kdeconnect.sftp", protocol.SftpBody{ErrorMessage: "no storage"})
+
+		select {
+		case err := <-errc:
+			if err == nil {
+				t.Fatal("ConnectSFTP succeeded without an offer")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("ConnectSFTP did not return")
+		}
+		if n := e.Events.ListenerCount(); n != baseline {
+			t.Fatalf("%d listeners left after call %d, want %d", n, i+1, baseline)
+		}
+	}
+
+	e.mu.RLock()
+	pending := len(e.requests)
+	e.mu.RUnlock()
+	if pending != 0 {
+		t.Errorf("%d requests left pending", pending)
+	}
+}
+
+func TestUnpairDropsStats(t *testing.T) {
+	e := newTestEngine(t)
+	phone := testIdentity()
+	d := connectDevice(t, e, phone)
+	e.mu.Lock()
+	e.pairedDevices[phone.DeviceId] = PairedDeviceInfo{Identity: phone}
+	e.mu.Unlock()
+
+	d.sync(t, e)
+	if e.DeviceStats(phone.DeviceId).PacketsReceived["kdeconnect.ping"] == 0 {
+		t.Fatal("ping not counted")
+	}
+	if err := e.Unpair(phone.DeviceId); err != nil {
+		t.Fatal(err)
+	}
+	// Sending the unpair request starts a new entry; the old counts must be gone
+	if n := e.DeviceStats(phone.DeviceId).PacketsReceived["kdeconnect.ping"]; n != 0 {
+		t.Fatalf("%d pings still counted after unpairing", n)
+	}
+}
+
+func TestCertGenerationRetries(t *testing.T) {
+	delay := certRetryDelay
+	certRetryDelay = 100 * time.Millisecond
+	t.Cleanup(func() { certRetryDelay = delay })
+
+	// An unsupported key type fails until it is fixed
+	t.Setenv("KDECONNECT_FYNE_KEY_TYPE", "dsa")
+	e, err := NewEngineWithConfigDir("Test Desktop", t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		e.Stop()
+		e.FlushConfig()
+	})
+	time.Sleep(20 * time.Millisecond)
+	os.Setenv("KDECONNECT_FYNE_KEY_TYPE", protocol.KeyTypeEC)
+	if err := e.waitCert(); err != nil {
+		t.Fatalf("certificate not generated on retry: %v", err)
+	}
+
+	// Giving up is reported
+	os.Setenv("KDECONNECT_FYNE_KEY_TYPE", "dsa")
+	certRetryDelay = time.Millisecond
+	e, err = NewEngineWithConfigDir("Test Desktop", t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(e.Stop)
+	if err := e.waitCert(); err == nil {
+		t.Fatal("no error after every attempt failed")
+	}
+	for deadline := time.Now().Add(2 * time.Second); e.Status().Errors["certificate"] == ""; {
+		if time.Now().After(deadline) {
+			t.Fatal("failure not reported in the status")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestConcurrentSendsDialOnce(t *testing.T) {
+	e := newTestEngine(t)
+	phone := testIdentity()
+	e.addDiscoveredDevice(phone, udpAddr("192.0.2.7", 1716))
+
+	received := make(chan protocol.Packet, 16)
+	var dials atomic.Int32
+	release := make(chan struct{})
+	e.dial = func(deviceId, ip string, port int, timeout time.Duration) (*network.Connection, error) {
+		dials.Add(1)
+		<-release
+		conn, remote := network.PipeConnection(e.Identity, phone)
+		remote.OnPacket = func(p protocol.Packet) { received <- p }
+		go remote.StartLoop()
+		t.Cleanup(func() { remote.Close() })
+		return conn, nil
+	}
+
+	const senders = 10
+	errs := make(chan error, senders)
+	for i := 0; i < senders; i++ {
+		go func() {
+			errs <- e.SendPacket(phone.DeviceId, "kdeconnect.ping", protocol.PingBody{})
+		}()
+	}
+	// Let the senders pile up on the first dial
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	for i := 0; i < senders; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := dials.Load(); n != 1 {
+		t.Fatalf("dialed %d times, want 1", n)
+	}
+	for i := 0; i < senders; i++ {
+		select {
+		case <-received:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%d of %d pings arrived", i, senders)
+		}
+	}
+}
+
+// transports returns the transports of the device's active and standby
+// connections, "" where there is none.
+func transports(e *Engine, deviceId string) (active, standby string) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if conn, ok := e.activeConns[deviceId]; ok {
+		active = conn.Transport.String()
+	}
+	if conn, ok := e.standbyConns[deviceId]; ok {
+		standby = conn.Transport.String()
+	}
+	return active, standby
+}
+
+func TestLANPreferredOverBluetooth(t *testing.T) {
+	lan, bt := network.TransportLAN, network.TransportBluetooth
+	for _, order := range [][]network.Transport{{lan, bt}, {bt, lan}} {
+		t.Run(order[0].String()+" then "+order[1].String(), func(t *testing.T) {
+			e := newTestEngine(t)
+			phone := testIdentity()
+			devices := make(map[network.Transport]*fakeDevice)
+			for _, transport := range order {
+				devices[transport] = connectDeviceOver(t, e, phone, transport)
+			}
+
+			if active, standby := transports(e, phone.DeviceId); active != "lan" || standby != "bluetooth" {
+				t.Fatalf("active %q, standby %q; want LAN active with Bluetooth on standby", active, standby)
+			}
+			if err := e.SendPing(phone.DeviceId, "over lan"); err != nil {
+				t.Fatal(err)
+			}
+			devices[lan].expect(t, "kdeconnect.ping", nil)
+			devices[bt].expectNone(t, "kdeconnect.ping", 100*time.Millisecond)
+		})
+	}
+}
+
+func TestStandbyPromotedWhenLANDrops(t *testing.T) {
+	e := newTestEngine(t)
+	phone := testIdentity()
+	lan := connectDeviceOver(t, e, phone, network.TransportLAN)
+	bt := connectDeviceOver(t, e, phone, network.TransportBluetooth)
+
+	lan.conn.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		active, standby := transports(e, phone.DeviceId)
+		if active == "bluetooth" && standby == "" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("active %q, standby %q after LAN dropped; want Bluetooth active", active, standby)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := e.SendPing(phone.DeviceId, "over bluetooth"); err != nil {
+		t.Fatal(err)
+	}
+	bt.expect(t, "kdeconnect.ping", nil)
+}
+
+func TestChangedCertRefused(t *testing.T) {
+	e := newTestEngine(t)
+	phone := testIdentity()
+	paired, other := newCert(t), newCert(t)
+	e.mu.Lock()
+	e.pairedDevices[phone.DeviceId] = PairedDeviceInfo{Identity: phone, Fingerprint: certFingerprint(paired.Leaf)}
+	e.mu.Unlock()
+	changed := watchEvent(t, e, "cert_changed")
+
+	if connectDeviceWithCert(t, e, phone, other, network.TransportLAN) != nil {
+		t.Fatal("connection with a changed certificate accepted")
+	}
+	select {
+	case data := <-changed:
+		ev := data.(CertChanged)
+		if ev.DeviceId != phone.DeviceId || ev.OldFingerprint != certFingerprint(paired.Leaf) || ev.NewFingerprint != certFingerprint(other.Leaf) {
+			t.Fatalf("wrong cert_changed: %+v", ev)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no cert_changed")
+	}
+	if connected(e, phone.DeviceId) {
+		t.Fatal("connected with a changed certificate")
+	}
+
+	if connectDeviceWithCert(t, e, phone, paired, network.TransportLAN) == nil {
+		t.Fatal("connection with the paired certificate refused")
+	}
+}
+
+func TestAutoPairNeedsSameCert(t *testing.T) {
+	allowed, other := newCert(t), newCert(t)
+	tests := []struct {
+		name string
+		cert *tls.Certificate
+		want bool
+	}{
+		{"allowed certificate", allowed, true},
+		{"other certificate", other, false},
+	}
+
+	e := newTestEngine(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			phone := testIdentity()
+			e.SetAutoPair(phone.DeviceId, certFingerprint(allowed.Leaf))
+			requests := watchEvent(t, e, "pair_request")
+
+			d := connectDeviceWithCert(t, e, phone, tt.cert, network.TransportLAN)
+			if d == nil {
+				t.Fatal("connection refused")
+			}
+			d.send(t, "kdeconnect.pair", protocol.PairBody{Pair: true, Timestamp: time.Now().Unix()})
+			select {
+			case data := <-requests:
+				req := data.(PairRequest)
+				if got := e.AutoPairAllowed(req.Identity.DeviceId, req.Fingerprint); got != tt.want {
+					t.Fatalf("AutoPairAllowed = %v, want %v", got, tt.want)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("no pair_request")
+			}
+		})
+	}
+	if e.AutoPairAllowed("unknown", "") {
+		t.Fatal("auto-pair allowed without a certificate")
+	}
+}
+
+func TestAcceptPairOverBluetooth(t *testing.T) {
+	e := newTestEngine(t)
+	requests := watchEvent(t, e, "pair_request")
+	// Bluetooth links have no usable address, so both look alike by address
+	phone, other := testIdentity(), testIdentity()
+	d := connectDeviceOver(t, e, phone, network.TransportBluetooth)
+	o := connectDeviceOver(t, e, other, network.TransportBluetooth)
+
+	d.send(t, "kdeconnect.pair", protocol.PairBody{Pair: true, Timestamp: time.Now().Unix()})
+	var req PairRequest
+	select {
+	case data := <-requests:
+		req = data.(PairRequest)
+	case <-time.After(2 * time.Second):
+		t.Fatal("no pair_request")
+	}
+	if req.Identity.DeviceId != phone.DeviceId {
+		t.Fatalf("pair_request from %s, want %s", req.Identity.DeviceId, phone.DeviceId)
+	}
+
+	e.AcceptPair(req.Identity.DeviceId)
+	e.MarkAsPaired(req.Identity.DeviceId)
+	var resp protocol.PairBody
+	d.expect(t, "kdeconnect.pair", &resp)
+	if !resp.Pair {
+		t.Fatal("pair response with pair false")
+	}
+	o.expectNone(t, "kdeconnect.pair", 100*time.Millisecond)
+	if !e.IsPaired(phone.DeviceId) || e.IsPaired(other.DeviceId) {
+		t.Fatalf("paired %v and %v, want only the requesting device", e.IsPaired(phone.DeviceId), e.IsPaired(other.DeviceId))
+	}
+}
+
+func TestPairOverBluetooth(t *testing.T) {
+	e := newTestEngine(t)
+	phone := testIdentity()
+	cert := newCert(t)
+	d := connectDeviceWithCert(t, e, phone, cert, network.TransportBluetooth)
+	if d == nil {
+		t.Fatal("connection refused")
+	}
+	changed := watchEvent(t, e, "pairing_changed")
+
+	key, err := e.Pair(phone.DeviceId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var req protocol.PairBody
+	d.expect(t, "kdeconnect.pair", &req)
+	if !req.Pair {
+		t.Fatal("pair request with pair false")
+	}
+	// The device shows the same key, from the certificate it got over TLS
+	ours, err := x509.ParseCertificate(e.Cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := protocol.GetVerificationKey(cert.Leaf, ours, req.Timestamp)
+	if key == "" || key != want {
+		t.Fatalf("verification key %q, device shows %q", key, want)
+	}
+
+	d.send(t, "kdeconnect.pair", protocol.PairBody{Pair: true, Timestamp: time.Now().Unix()})
+	select {
+	case <-changed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("no pairing_changed")
+	}
+	if !e.IsPaired(phone.DeviceId) {
+		t.Fatal("not paired after the device accepted")
+	}
+	if fp := e.PairedFingerprint(phone.DeviceId); fp != certFingerprint(cert.Leaf) {
+		t.Fatalf("pinned %q, want the device's certificate", fp)
+	}
+}
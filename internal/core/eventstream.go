@@ -0,0 +1,119 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Lines queued per event stream client; a client that falls this far behind
+// is dropped so Emit never waits on it.
+const (
+	eventStreamBuffer       = 64
+	eventStreamWriteTimeout = 5 * time.Second
+)
+
+type streamEvent struct {
+	Event string      `json:"event"`
+	Data  interface{} `json:"data"`
+}
+
+type eventStream struct {
+	mu      sync.Mutex
+	clients map[*streamClient]struct{}
+}
+
+type streamClient struct {
+	conn net.Conn
+	out  chan []byte
+	once sync.Once
+}
+
+// StartEventStream writes every engine event as a line of JSON,
+// {"event": ..., "data": ...}, to each client that connects to l, until l is
+// closed.
+func (e *Engine) StartEventStream(l net.Listener) {
+	s := &eventStream{clients: make(map[*streamClient]struct{})}
+	h := e.Events.OnAny(s.broadcast)
+	go func() {
+		s.serve(l)
+		e.Events.Off(h)
+	}()
+}
+
+func (s *eventStream) serve(l net.Listener) {
+	defer s.closeAll()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+
+		c := &streamClient{conn: conn, out: make(chan []byte, eventStreamBuffer)}
+		s.mu.Lock()
+		s.clients[c] = struct{}{}
+		s.mu.Unlock()
+
+		go s.writeLoop(c)
+		go func() {
+			// Clients only listen; reading tells us when they go away.
+			io.Copy(io.Discard, conn)
+			s.drop(c)
+		}()
+	}
+}
+
+func (s *eventStream) writeLoop(c *streamClient) {
+	for line := range c.out {
+		c.conn.SetWriteDeadline(time.Now().Add(eventStreamWriteTimeout))
+		if _, err := c.conn.Write(line); err != nil {
+			s.drop(c)
+			return
+		}
+	}
+}
+
+func (s *eventStream) broadcast(event string, data interface{}) {
+	line, err := json.Marshal(streamEvent{Event: event, Data: data})
+	if err != nil {
+		fmt.Printf("Event stream: failed to encode %s: %v\n", event, err)
+		return
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.clients {
+		select {
+		case c.out <- line:
+		default:
+			fmt.Printf("Event stream: dropping slow client %s\n", c.conn.RemoteAddr())
+			s.dropLocked(c)
+		}
+	}
+}
+
+func (s *eventStream) drop(c *streamClient) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dropLocked(c)
+}
+
+func (s *eventStream) dropLocked(c *streamClient) {
+	delete(s.clients, c)
+	c.once.Do(func() {
+		close(c.out)
+		c.conn.Close()
+	})
+}
+
+func (s *eventStream) closeAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.clients {
+		s.dropLocked(c)
+	}
+}
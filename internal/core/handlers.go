@@ -0,0 +1,63 @@
+package core
+
+import "encoding/json"
+
+// PacketHandler receives packets of a registered type. It runs on the
+// device's read loop goroutine, so it must not block: hand anything slow to
+// another goroutine. body is not reused and may be kept.
+type PacketHandler func(deviceId string, body json.RawMessage)
+
+// RegisterPacketHandler adds a handler for packetType, which lets code
+// embedding the engine implement plugins of its own. Handlers run in
+// registration order before the built-in handling, also for built-in types,
+// and only see packets from paired devices whose plugin isn't disabled.
+func (e *Engine) RegisterPacketHandler(packetType string, handler PacketHandler) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.packetHandlers == nil {
+		e.packetHandlers = make(map[string][]PacketHandler)
+	}
+	e.packetHandlers[packetType] = append(e.packetHandlers[packetType], handler)
+}
+
+func (e *Engine) dispatchPacketHandlers(deviceId, packetType string, body json.RawMessage) {
+	e.mu.RLock()
+	handlers := e.packetHandlers[packetType]
+	_, paired := e.pairedDevices[deviceId]
+	e.mu.RUnlock()
+
+	if !paired {
+		return
+	}
+	for _, handler := range handlers {
+		handler(deviceId, body)
+	}
+}
+
+// SendInterceptor sees an outgoing packet before it's marshaled. It returns
+// the body to send, which may be replaced, and whether to drop the packet.
+type SendInterceptor func(deviceId, pType string, body interface{}) (modified interface{}, drop bool)
+
+// AddSendInterceptor appends an interceptor for every packet sent to any
+// device. Interceptors run in the order they were added, each seeing the
+// previous one's body; the first to drop a packet stops the chain. They run
+// on the sending goroutine and must not block.
+func (e *Engine) AddSendInterceptor(interceptor SendInterceptor) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.sendInterceptors = append(e.sendInterceptors, interceptor)
+}
+
+func (e *Engine) interceptSend(deviceId, pType string, body interface{}) (interface{}, bool) {
+	e.mu.RLock()
+	interceptors := e.sendInterceptors
+	e.mu.RUnlock()
+
+	for _, intercept := range interceptors {
+		var drop bool
+		if body, drop = intercept(deviceId, pType, body); drop {
+			return nil, true
+		}
+	}
+	return body, false
+}
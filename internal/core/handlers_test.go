@@ -0,0 +1,95 @@
+package core
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/barishamil/kde-connect-fyne/internal/protocol"
+)
+
+func TestRegisteredPacketHandler(t *testing.T) {
+	e := newTestEngine(t)
+	type received struct {
+		deviceId string
+		body     json.RawMessage
+	}
+	got := make(chan received, 4)
+	e.RegisterPacketHandler("com.example.custom", func(deviceId string, body json.RawMessage) {
+		got <- received{deviceId, body}
+	})
+
+	paired := testIdentity()
+	stranger := testIdentity()
+	e.mu.Lock()
+	e.pairedDevices[paired.DeviceId] = PairedDeviceInfo{Identity: paired}
+	e.mu.Unlock()
+	dp := connectDevice(t, e, paired)
+	ds := connectDevice(t, e, stranger)
+
+	ds.send(t, "com.example.custom", map[string]string{"from": "stranger"})
+	ds.sync(t, e)
+	dp.send(t, "com.example.custom", map[string]string{"from": "paired"})
+	dp.sync(t, e)
+
+	select {
+	case r := <-got:
+		if r.deviceId != paired.DeviceId {
+			t.Fatalf("handler got a packet from %s", r.deviceId)
+		}
+		var body map[string]string
+		if err := json.Unmarshal(r.body, &body); err != nil || body["from"] != "paired" {
+			t.Fatalf("handler got body %s", r.body)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("handler not called")
+	}
+	if len(got) > 0 {
+		t.Fatalf("handler called %d more times", len(got))
+	}
+}
+
+func TestSendInterceptors(t *testing.T) {
+	e := newTestEngine(t)
+	phone := testIdentity()
+	d := connectDevice(t, e, phone)
+
+	e.AddSendInterceptor(func(deviceId, pType string, body interface{}) (interface{}, bool) {
+		if pType == "kdeconnect.ping" {
+			if ping := body.(protocol.PingBody); ping.Message == "secret" {
+				return protocol.PingBody{Message: "redacted"}, false
+			}
+		}
+		return body, false
+	})
+	e.AddSendInterceptor(func(deviceId, pType string, body interface{}) (interface{}, bool) {
+		return body, pType == "kdeconnect.clipboard"
+	})
+
+	if err := e.SendPacket(phone.DeviceId, "kdeconnect.clipboard", protocol.ClipboardBody{Content: "dropped"}); err != nil {
+		t.Fatalf("dropped send failed: %v", err)
+	}
+	if err := e.SendPing(phone.DeviceId, "secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Packets arrive in order, so a clipboard packet would come first
+	for {
+		select {
+		case p := <-d.received:
+			switch p.Type {
+			case "kdeconnect.clipboard":
+				t.Fatal("dropped packet was sent")
+			case "kdeconnect.ping":
+				var ping protocol.PingBody
+				json.Unmarshal(p.Body, &ping)
+				if ping.Message != "redacted" {
+					t.Fatalf("ping sent with %q, want the interceptor's body", ping.Message)
+				}
+				return
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("no ping sent")
+		}
+	}
+}
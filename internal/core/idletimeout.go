@@ -0,0 +1,28 @@
+package core
+
+import (
+	"fmt"
+	"time"
+)
+
+// IdleTimeout returns how long a connection may go without a packet before
+// it is dropped, or 0 if it never is.
+func (e *Engine) IdleTimeout() time.Duration {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.idleTimeout
+}
+
+// SetIdleTimeout changes how long a connection may stay silent, 0 turning it
+// off. It applies to new connections. KDE Connect has no heartbeat, so quiet
+// devices are dropped too and reconnect when discovered again.
+func (e *Engine) SetIdleTimeout(d time.Duration) error {
+	if d < 0 {
+		return fmt.Errorf("invalid idle timeout %v", d)
+	}
+	e.mu.Lock()
+	e.idleTimeout = d
+	e.mu.Unlock()
+	e.scheduleSave()
+	return nil
+}
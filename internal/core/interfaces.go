@@ -0,0 +1,42 @@
+package core
+
+import (
+	"slices"
+
+	"github.com/barishamil/kde-connect-fyne/internal/network"
+)
+
+// DiscoveryInterfaces returns the network interfaces discovery is limited to,
+// or nil if it runs on all but the virtual ones.
+func (e *Engine) DiscoveryInterfaces() []string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return slices.Clone(e.discoveryIfaces)
+}
+
+// SetDiscoveryInterfaces limits discovery to the named interfaces, which may
+// include virtual ones; none means all that aren't virtual. Broadcasting and
+// listening follow right away, mDNS after a restart.
+func (e *Engine) SetDiscoveryInterfaces(names []string) {
+	e.mu.Lock()
+	e.discoveryIfaces = slices.Sorted(slices.Values(names))
+	e.mu.Unlock()
+	e.scheduleSave()
+}
+
+// discoveryAuto reports whether discovery picks its interfaces itself, as
+// opposed to using the ones the user chose.
+func (e *Engine) discoveryAuto() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return len(e.discoveryIfaces) == 0
+}
+
+func (e *Engine) discoveryAllowed(iface string) bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if len(e.discoveryIfaces) == 0 {
+		return !network.IsVirtualInterface(iface)
+	}
+	return slices.Contains(e.discoveryIfaces, iface)
+}
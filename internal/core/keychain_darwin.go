@@ -0,0 +1,48 @@
+//go:build darwin
+
+package core
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+const (
+	keychainSupported = true
+	keychainService   = "kde-connect-fyne"
+	keychainAccount   = "private-key-encryption"
+)
+
+// keychainKey reads the 256-bit key from the macOS login keychain, creating
+// it if requested and missing.
+func keychainKey(create bool) ([]byte, error) {
+	out, err := exec.Command("security", "find-generic-password", "-s", keychainService, "-a", keychainAccount, "-w").Output()
+	if err == nil {
+		return hex.DecodeString(strings.TrimSpace(string(out)))
+	}
+	if !create {
+		return nil, fmt.Errorf("encryption key not found in keychain: %w", err)
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	// Commands go to security on stdin, since arguments can be read by any
+	// process on the machine
+	cmd := exec.Command("security", "-i")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %s -a %s -w %s\n", keychainService, keychainAccount, hex.EncodeToString(key)))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("failed to store key in keychain: %v (%s)", err, strings.TrimSpace(string(out)))
+	}
+	// security -i carries on past a failed command, so read the key back
+	stored, err := keychainKey(false)
+	if err != nil || !bytes.Equal(stored, key) {
+		return nil, fmt.Errorf("failed to store key in keychain")
+	}
+	return key, nil
+}
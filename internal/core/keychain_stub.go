@@ -0,0 +1,11 @@
+//go:build !darwin
+
+package core
+
+import "fmt"
+
+const keychainSupported = false
+
+func keychainKey(create bool) ([]byte, error) {
+	return nil, fmt.Errorf("keychain not supported on this platform")
+}
@@ -0,0 +1,100 @@
+package core
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// The private key can optionally be stored encrypted (key.pem.enc) with an
+// AES-256-GCM key kept in the OS keychain instead of as plain key.pem.
+
+func (e *Engine) encryptedKeyPath() string {
+	return filepath.Join(e.configDir, "key.pem.enc")
+}
+
+// KeyEncrypted reports whether the private key is stored encrypted at rest.
+func (e *Engine) KeyEncrypted() bool {
+	_, err := os.Stat(e.encryptedKeyPath())
+	return err == nil
+}
+
+// KeyEncryptionSupported reports whether an OS keychain is available.
+func KeyEncryptionSupported() bool {
+	return keychainSupported
+}
+
+// SetKeyEncryption moves the private key between key.pem and its encrypted form.
+func (e *Engine) SetKeyEncryption(enabled bool) error {
+	if enabled == e.KeyEncrypted() {
+		return nil
+	}
+
+	plainPath := filepath.Join(e.configDir, "key.pem")
+	if enabled {
+		privPEM, err := os.ReadFile(plainPath)
+		if err != nil {
+			return err
+		}
+		if err := e.saveEncryptedKey(privPEM); err != nil {
+			return err
+		}
+		return os.Remove(plainPath)
+	}
+
+	privPEM, err := e.loadEncryptedKey()
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(plainPath, privPEM, 0600); err != nil {
+		return err
+	}
+	return os.Remove(e.encryptedKeyPath())
+}
+
+func (e *Engine) saveEncryptedKey(privPEM []byte) error {
+	key, err := keychainKey(true)
+	if err != nil {
+		return err
+	}
+	gcm, err := newKeyCipher(key)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	return writeFileAtomic(e.encryptedKeyPath(), gcm.Seal(nonce, nonce, privPEM, nil), 0600)
+}
+
+func (e *Engine) loadEncryptedKey() ([]byte, error) {
+	data, err := os.ReadFile(e.encryptedKeyPath())
+	if err != nil {
+		return nil, err
+	}
+	key, err := keychainKey(false)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newKeyCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("encrypted key is truncated")
+	}
+	nonce, sealed := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, sealed, nil)
+}
+
+func newKeyCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,22 @@
+package core
+
+// LastPath returns the folder the file browser was last left in for the
+// device, or "" if there is none.
+func (e *Engine) LastPath(deviceId string) string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.lastPaths[deviceId]
+}
+
+// SetLastPath remembers p as the folder to open the device's files at next
+// time.
+func (e *Engine) SetLastPath(deviceId, p string) {
+	e.mu.Lock()
+	if e.lastPaths[deviceId] == p {
+		e.mu.Unlock()
+		return
+	}
+	e.lastPaths[deviceId] = p
+	e.mu.Unlock()
+	e.scheduleSave()
+}
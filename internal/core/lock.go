@@ -0,0 +1,51 @@
+package core
+
+import (
+	"fmt"
+
+	"github.com/barishamil/kde-connect-fyne/internal/network"
+	"github.com/barishamil/kde-connect-fyne/internal/protocol"
+)
+
+// LockState is emitted with lock_state_changed when a device reports whether
+// it is locked.
+type LockState struct {
+	DeviceId string
+	Locked   bool
+}
+
+func (e *Engine) handleLockRequest(conn *network.Connection, req protocol.LockBody) {
+	if !e.IsPaired(conn.DeviceId) {
+		fmt.Printf("Ignoring lock request from unpaired device %s\n", conn.DeviceId)
+		return
+	}
+
+	if req.SetLocked != nil {
+		if *req.SetLocked {
+			if err := lockScreen(); err != nil {
+				fmt.Printf("Failed to lock screen: %v\n", err)
+			}
+		} else {
+			// There is no way to unlock the session without the user's password
+			fmt.Printf("Ignoring unlock request from %s\n", conn.DeviceId)
+		}
+	}
+
+	if req.RequestLocked || req.SetLocked != nil {
+		locked, err := isScreenLocked()
+		if err != nil {
+			fmt.Printf("Failed to read lock state: %v\n", err)
+			return
+		}
+		conn.SendPacket("kdeconnect.lock", protocol.LockBody{IsLocked: &locked})
+	}
+}
+
+// LockRemote asks the device to lock its screen.
+func (e *Engine) LockRemote(deviceId string) error {
+	if !e.DeviceSupports(deviceId, "kdeconnect.lock.request") {
+		return fmt.Errorf("device %s does not support locking", deviceId)
+	}
+	locked := true
+	return e.SendPacket(deviceId, "kdeconnect.lock.request", protocol.LockBody{SetLocked: &locked})
+}
@@ -0,0 +1,45 @@
+//go:build darwin
+
+package core
+
+/*
+#cgo LDFLAGS: -framework CoreGraphics -framework CoreFoundation
+#include <CoreGraphics/CoreGraphics.h>
+#include <CoreFoundation/CoreFoundation.h>
+
+static int screenIsLocked() {
+	CFDictionaryRef session = CGSessionCopyCurrentDictionary();
+	if (session == NULL) {
+		return -1;
+	}
+	int locked = 0;
+	CFBooleanRef value = (CFBooleanRef)CFDictionaryGetValue(session, CFSTR("CGSSessionScreenIsLocked"));
+	if (value != NULL && CFBooleanGetValue(value)) {
+		locked = 1;
+	}
+	CFRelease(session);
+	return locked;
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// lockScreen sleeps the display, which locks the session when macOS is set
+// to require the password after sleep.
+func lockScreen() error {
+	return exec.Command("pmset", "displaysleepnow").Run()
+}
+
+func isScreenLocked() (bool, error) {
+	switch C.screenIsLocked() {
+	case -1:
+		return false, fmt.Errorf("no graphical session")
+	case 1:
+		return true, nil
+	}
+	return false, nil
+}
@@ -0,0 +1,13 @@
+//go:build !darwin
+
+package core
+
+import "fmt"
+
+func lockScreen() error {
+	return fmt.Errorf("screen locking not supported on this platform")
+}
+
+func isScreenLocked() (bool, error) {
+	return false, fmt.Errorf("screen lock state not supported on this platform")
+}
@@ -0,0 +1,95 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/barishamil/kde-connect-fyne/internal/protocol"
+)
+
+// configVersion is the schema version written by SaveConfig. Bump it and
+// append a migration whenever the config format changes.
+const configVersion = 1
+
+// configMigrations[i] upgrades a raw config from version i to i+1.
+var configMigrations = []func(raw map[string]json.RawMessage) error{
+	migratePairedDeviceInfo,
+}
+
+// migrateConfig upgrades config JSON to configVersion and reports whether
+// anything changed.
+func migrateConfig(data []byte) ([]byte, bool, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, false, err
+	}
+
+	version := 0
+	if v, ok := raw["version"]; ok {
+		if err := json.Unmarshal(v, &version); err != nil {
+			return nil, false, fmt.Errorf("invalid config version: %w", err)
+		}
+	}
+
+	if version > configVersion {
+		// Written by a newer build; load what we understand rather than
+		// failing, which would make NewEngine generate a new identity.
+		fmt.Printf("Config version %d is newer than supported version %d\n", version, configVersion)
+		return data, false, nil
+	}
+	if version == configVersion {
+		return data, false, nil
+	}
+
+	for ; version < configVersion; version++ {
+		if err := configMigrations[version](raw); err != nil {
+			return nil, false, fmt.Errorf("migrating config to version %d: %w", version+1, err)
+		}
+	}
+	raw["version"] = json.RawMessage(strconv.Itoa(configVersion))
+
+	data, err := json.Marshal(raw)
+	return data, true, err
+}
+
+// migratePairedDeviceInfo (v0 -> v1) converts pairedDevices entries stored as a
+// bare IdentityBody into PairedDeviceInfo. Unversioned configs may already
+// use the new shape, so each entry is checked individually.
+func migratePairedDeviceInfo(raw map[string]json.RawMessage) error {
+	devices, ok := raw["pairedDevices"]
+	if !ok || len(devices) == 0 || string(devices) == "null" {
+		return nil
+	}
+
+	var entries map[string]json.RawMessage
+	if err := json.Unmarshal(devices, &entries); err != nil {
+		return err
+	}
+
+	migrated := make(map[string]PairedDeviceInfo, len(entries))
+	for id, entry := range entries {
+		var info PairedDeviceInfo
+		if err := json.Unmarshal(entry, &info); err == nil && info.Identity.DeviceId != "" {
+			migrated[id] = info
+			continue
+		}
+
+		var identity protocol.IdentityBody
+		if err := json.Unmarshal(entry, &identity); err != nil {
+			return fmt.Errorf("paired device %s: %w", id, err)
+		}
+		port := identity.TcpPort
+		if port == 0 {
+			port = 1716
+		}
+		migrated[id] = PairedDeviceInfo{Identity: identity, LastPort: port}
+	}
+
+	data, err := json.Marshal(migrated)
+	if err != nil {
+		return err
+	}
+	raw["pairedDevices"] = data
+	return nil
+}
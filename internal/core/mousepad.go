@@ -0,0 +1,99 @@
+package core
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/barishamil/kde-connect-fyne/internal/protocol"
+)
+
+// Pointer moves to a device are merged and sent at most this often (~60Hz).
+const mouseMoveInterval = 16 * time.Millisecond
+
+// mouseThrottle accumulates pointer and scroll deltas for one device between
+// flushes. mu also orders sends, so a click never overtakes a pending move.
+type mouseThrottle struct {
+	mu       sync.Mutex
+	dx, dy   float64
+	scrollDx float64
+	scrollDy float64
+	timer    *time.Timer
+}
+
+func isPlainMove(req protocol.MousepadRequestBody) bool {
+	plain := req
+	plain.Dx, plain.Dy, plain.Scroll = 0, 0, false
+	return plain == protocol.MousepadRequestBody{}
+}
+
+// SendMousepadRequest sends remote input to the device. Pointer moves and
+// scrolls are coalesced; clicks and keys flush them and go out immediately.
+func (e *Engine) SendMousepadRequest(deviceId string, req protocol.MousepadRequestBody) error {
+	if !e.DeviceSupports(deviceId, "kdeconnect.mousepad.request") {
+		return fmt.Errorf("device %s does not accept remote input", deviceId)
+	}
+
+	t := e.mouseThrottle(deviceId)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if isPlainMove(req) {
+		if req.Scroll {
+			t.scrollDx += req.Dx
+			t.scrollDy += req.Dy
+		} else {
+			t.dx += req.Dx
+			t.dy += req.Dy
+		}
+		if t.timer == nil {
+			t.timer = time.AfterFunc(mouseMoveInterval, func() {
+				t.mu.Lock()
+				defer t.mu.Unlock()
+				if err := e.flushMouseLocked(deviceId, t); err != nil {
+					fmt.Printf("Failed to send pointer move to %s: %v\n", deviceId, err)
+				}
+			})
+		}
+		return nil
+	}
+
+	if err := e.flushMouseLocked(deviceId, t); err != nil {
+		return err
+	}
+	return e.SendPacket(deviceId, "kdeconnect.mousepad.request", req)
+}
+
+func (e *Engine) mouseThrottle(deviceId string) *mouseThrottle {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.mouseThrottles == nil {
+		e.mouseThrottles = make(map[string]*mouseThrottle)
+	}
+	t, ok := e.mouseThrottles[deviceId]
+	if !ok {
+		t = &mouseThrottle{}
+		e.mouseThrottles[deviceId] = t
+	}
+	return t
+}
+
+// flushMouseLocked sends the accumulated deltas. t.mu must be held.
+func (e *Engine) flushMouseLocked(deviceId string, t *mouseThrottle) error {
+	if t.timer != nil {
+		t.timer.Stop()
+		t.timer = nil
+	}
+	dx, dy, scrollDx, scrollDy := t.dx, t.dy, t.scrollDx, t.scrollDy
+	t.dx, t.dy, t.scrollDx, t.scrollDy = 0, 0, 0, 0
+
+	if dx != 0 || dy != 0 {
+		if err := e.sendDroppable(deviceId, "kdeconnect.mousepad.request", protocol.MousepadRequestBody{Dx: dx, Dy: dy}); err != nil {
+			return err
+		}
+	}
+	if scrollDx != 0 || scrollDy != 0 {
+		return e.sendDroppable(deviceId, "kdeconnect.mousepad.request", protocol.MousepadRequestBody{Dx: scrollDx, Dy: scrollDy, Scroll: true})
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"time"
+
+	"github.com/barishamil/kde-connect-fyne/internal/logging"
+	"github.com/barishamil/kde-connect-fyne/internal/network"
+	"github.com/barishamil/kde-connect-fyne/internal/protocol"
+)
+
+const (
+	// How many mirrored notifications are kept, across devices.
+	maxNotifications = 200
+	// App icons are small; bigger payloads aren't fetched.
+	maxNotificationIconSize = 1 << 20
+	notificationIconTimeout = 10 * time.Second
+)
+
+// Notification is a notification mirrored from a device.
+type Notification struct {
+	DeviceId string
+	protocol.NotificationBody
+	// Icon is the sending app's icon (usually PNG), or nil
+	Icon     []byte
+	Received time.Time
+	// Count is how many notifications with this app and title were grouped
+	// into this one.
+	Count int
+}
+
+func (e *Engine) handleNotification(conn *network.Connection, p protocol.Packet) {
+	if !e.IsPaired(conn.DeviceId) {
+		return
+	}
+
+	var body protocol.NotificationBody
+	if !decodeBody(conn.DeviceId, p, &body) {
+		return
+	}
+	if body.IsCancel {
+		e.removeNotification(conn.DeviceId, body.Id)
+		return
+	}
+
+	if looksLikePhoneNumber(body.Title) {
+		if name := e.ContactName(conn.DeviceId, body.Title); name != "" {
+			body.Title = name
+		}
+	}
+	n := Notification{DeviceId: conn.DeviceId, NotificationBody: body, Received: time.Now(), Count: 1}
+
+	e.mu.RLock()
+	n.Icon = e.notificationIcons[body.AppName]
+	e.mu.RUnlock()
+
+	if n.Icon != nil || p.PayloadTransferInfo == nil || p.PayloadSize <= 0 || p.PayloadSize > maxNotificationIconSize {
+		e.postNotification(n)
+		return
+	}
+
+	// Fetching the icon mustn't hold up the read loop
+	host, _, _ := net.SplitHostPort(conn.Conn.RemoteAddr().String())
+	peer := conn.PeerCertificate()
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), notificationIconTimeout)
+		defer cancel()
+
+		var buf bytes.Buffer
+		err := network.ReceivePayload(ctx, host, p.PayloadTransferInfo.Port, e.Cert, peer, p.PayloadSize, &buf)
+		if err != nil {
+			logging.Debugf("Failed to fetch notification icon for %s: %v\n", body.AppName, err)
+		} else {
+			e.RecordTransfer(0, int64(buf.Len()))
+			n.Icon = buf.Bytes()
+			e.mu.Lock()
+			e.notificationIcons[body.AppName] = n.Icon
+			e.mu.Unlock()
+		}
+		e.postNotification(n)
+	}()
+}
+
+// postNotification adds n, replacing an earlier version of it, and emits
+// notification_posted. Unless grouping is off, n also replaces a notification
+// from the same app with the same title, and counts it.
+func (e *Engine) postNotification(n Notification) {
+	e.mu.Lock()
+	e.notifications = slices.DeleteFunc(e.notifications, func(old Notification) bool {
+		if old.DeviceId != n.DeviceId {
+			return false
+		}
+		if old.Id == n.Id {
+			n.Count = old.Count
+			return true
+		}
+		if !e.ungrouped && n.Title != "" && old.AppName == n.AppName && old.Title == n.Title {
+			n.Count += old.Count
+			return true
+		}
+		return false
+	})
+	e.notifications = append(e.notifications, n)
+	if len(e.notifications) > maxNotifications {
+		e.notifications = slices.Delete(e.notifications, 0, len(e.notifications)-maxNotifications)
+	}
+	e.mu.Unlock()
+
+	e.Events.Emit("notification_posted", n)
+}
+
+// NotificationGrouping reports whether notifications from the same app with
+// the same title are shown as one.
+func (e *Engine) NotificationGrouping() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return !e.ungrouped
+}
+
+func (e *Engine) SetNotificationGrouping(enabled bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.ungrouped = !enabled
+}
+
+// removeNotification drops a notification dismissed on the device and emits
+// notification_removed with it.
+func (e *Engine) removeNotification(deviceId, id string) {
+	var removed []Notification
+	e.mu.Lock()
+	e.notifications = slices.DeleteFunc(e.notifications, func(n Notification) bool {
+		if n.DeviceId == deviceId && n.Id == id {
+			removed = append(removed, n)
+			return true
+		}
+		return false
+	})
+	e.mu.Unlock()
+
+	for _, n := range removed {
+		e.Events.Emit("notification_removed", n)
+	}
+}
+
+// ReplyToNotification sends message through the inline reply action of a
+// notification whose RequestReplyId is replyId.
+func (e *Engine) ReplyToNotification(deviceId, replyId, message string) error {
+	if replyId == "" {
+		return errors.New("notification can't be replied to")
+	}
+	if !e.DeviceSupports(deviceId, "kdeconnect.notification.reply") {
+		return fmt.Errorf("device %s does not support notification replies", deviceId)
+	}
+	return e.SendPacket(deviceId, "kdeconnect.notification.reply", protocol.NotificationReplyBody{
+		RequestReplyId: replyId,
+		Message:        message,
+	})
+}
+
+// TriggerNotificationAction presses the button labelled action on a
+// notification.
+func (e *Engine) TriggerNotificationAction(deviceId, notifId, action string) error {
+	if !e.DeviceSupports(deviceId, "kdeconnect.notification.action") {
+		return fmt.Errorf("device %s does not support notification actions", deviceId)
+	}
+	return e.SendPacket(deviceId, "kdeconnect.notification.action", protocol.NotificationActionBody{
+		Key:    notifId,
+		Action: action,
+	})
+}
+
+// Notifications returns the mirrored notifications, newest first.
+func (e *Engine) Notifications() []Notification {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	list := slices.Clone(e.notifications)
+	slices.Reverse(list)
+	return list
+}
@@ -0,0 +1,47 @@
+package core
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// OpenWithApp returns the application chosen for files like name, or "" to
+// use the system default.
+func (e *Engine) OpenWithApp(name string) string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.openWith[strings.ToLower(filepath.Ext(name))]
+}
+
+// SetOpenWithApp remembers app for files with the same extension as name. An
+// empty app goes back to the system default.
+func (e *Engine) SetOpenWithApp(name, app string) {
+	ext := strings.ToLower(filepath.Ext(name))
+	if ext == "" {
+		return
+	}
+
+	e.mu.Lock()
+	if app == "" {
+		delete(e.openWith, ext)
+	} else {
+		e.openWith[ext] = app
+	}
+	e.mu.Unlock()
+	e.scheduleSave()
+}
+
+// OpenWithApps lists the applications chosen for any file type so far.
+func (e *Engine) OpenWithApps() []string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	var apps []string
+	for _, app := range e.openWith {
+		if !slices.Contains(apps, app) {
+			apps = append(apps, app)
+		}
+	}
+	slices.Sort(apps)
+	return apps
+}
@@ -0,0 +1,113 @@
+package core
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/barishamil/kde-connect-fyne/internal/network"
+	"github.com/barishamil/kde-connect-fyne/internal/protocol"
+)
+
+// pluginOf maps a capability or packet type to the plugin it belongs to,
+// e.g. kdeconnect.lock.request -> kdeconnect.lock.
+func pluginOf(capability string) string {
+	rest, ok := strings.CutPrefix(capability, "kdeconnect.")
+	if !ok {
+		return capability
+	}
+	name, _, _ := strings.Cut(rest, ".")
+	return "kdeconnect." + name
+}
+
+// Identity and pairing are the protocol itself and can't be switched off.
+func isCorePlugin(plugin string) bool {
+	return plugin == "kdeconnect.identity" || plugin == "kdeconnect.pair"
+}
+
+// Plugins lists the plugins this build supports that can be toggled per
+// device.
+func Plugins() []string {
+	var plugins []string
+	for _, capability := range slices.Concat(incomingCapabilities, outgoingCapabilities) {
+		plugin := pluginOf(capability)
+		if !isCorePlugin(plugin) && !slices.Contains(plugins, plugin) {
+			plugins = append(plugins, plugin)
+		}
+	}
+	slices.Sort(plugins)
+	return plugins
+}
+
+// PluginEnabled reports whether the plugin owning capability (a capability,
+// packet type or plugin name) is enabled for the device.
+func (e *Engine) PluginEnabled(deviceId, capability string) bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.pluginEnabledLocked(deviceId, capability)
+}
+
+func (e *Engine) pluginEnabledLocked(deviceId, capability string) bool {
+	plugin := pluginOf(capability)
+	if isCorePlugin(plugin) {
+		return true
+	}
+	enabled, ok := e.pluginSettings[deviceId][plugin]
+	return !ok || enabled
+}
+
+// SetPluginEnabled turns a plugin on or off for one device. The device is
+// disconnected so it picks up the new capabilities when it reconnects.
+func (e *Engine) SetPluginEnabled(deviceId, plugin string, enabled bool) {
+	plugin = pluginOf(plugin)
+
+	e.mu.Lock()
+	if enabled {
+		delete(e.pluginSettings[deviceId], plugin)
+		if len(e.pluginSettings[deviceId]) == 0 {
+			delete(e.pluginSettings, deviceId)
+		}
+	} else {
+		if e.pluginSettings[deviceId] == nil {
+			e.pluginSettings[deviceId] = make(map[string]bool)
+		}
+		e.pluginSettings[deviceId][plugin] = false
+	}
+	conns := []*network.Connection{e.activeConns[deviceId], e.standbyConns[deviceId]}
+	e.mu.Unlock()
+
+	e.scheduleSave()
+	for _, conn := range conns {
+		if conn != nil {
+			conn.Close()
+		}
+	}
+}
+
+// identityFor returns our identity as advertised to one device, without the
+// capabilities of plugins disabled for it.
+func (e *Engine) identityFor(deviceId string) protocol.IdentityBody {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	disabled := func(capability string) bool {
+		return !e.pluginEnabledLocked(deviceId, capability)
+	}
+	identity := e.Identity
+	identity.IncomingCapabilities = slices.DeleteFunc(slices.Clone(identity.IncomingCapabilities), disabled)
+	identity.OutgoingCapabilities = slices.DeleteFunc(slices.Clone(identity.OutgoingCapabilities), disabled)
+	return identity
+}
+
+// acceptsPacket reports whether we handle packets of pType from the device:
+// it must be an incoming capability we advertise to it, or have a handler
+// registered for it in a plugin that isn't disabled.
+func (e *Engine) acceptsPacket(deviceId, pType string) bool {
+	if slices.Contains(e.identityFor(deviceId).IncomingCapabilities, pType) {
+		return true
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	_, registered := e.packetHandlers[pType]
+	return registered && e.pluginEnabledLocked(deviceId, pType)
+}
@@ -0,0 +1,127 @@
+package core
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/barishamil/kde-connect-fyne/internal/network"
+	"github.com/barishamil/kde-connect-fyne/internal/protocol"
+)
+
+// presenterState tracks the laser pointer position as fractions of the screen.
+// The pointer is drawn in an overlay above every window, leaving the system
+// cursor where it is.
+type presenterState struct {
+	active bool
+	x, y   float64
+	idle   *time.Timer // hides the pointer once events stop arriving
+}
+
+// presenterIdleTimeout hides the pointer if the device stops sending without
+// a stop event, as it does when the app is closed mid-gesture.
+const presenterIdleTimeout = 2 * time.Second
+
+// KDE Connect special key codes sent by the mousepad and presenter plugins.
+const (
+	specialKeyBackspace = 1
+	specialKeyTab       = 2
+	specialKeyLeft      = 4
+	specialKeyUp        = 5
+	specialKeyRight     = 6
+	specialKeyDown      = 7
+	specialKeyPageUp    = 8
+	specialKeyPageDown  = 9
+	specialKeyHome      = 10
+	specialKeyEnd       = 11
+	specialKeyReturn    = 12
+	specialKeyDelete    = 13
+	specialKeyEscape    = 14
+	specialKeyF5        = 25
+)
+
+func (e *Engine) handlePresenter(conn *network.Connection, body protocol.PresenterBody) {
+	if !e.IsPaired(conn.DeviceId) {
+		return
+	}
+
+	if body.Stop {
+		e.hidePresenter()
+		return
+	}
+
+	e.mu.Lock()
+	if !e.presenter.active {
+		// Start every gesture from the middle of the screen
+		e.presenter.active = true
+		e.presenter.x, e.presenter.y = 0.5, 0.5
+	}
+	e.presenter.x = min(max(e.presenter.x+body.Dx, 0), 1)
+	e.presenter.y = min(max(e.presenter.y+body.Dy, 0), 1)
+	x, y := e.presenter.x, e.presenter.y
+	if e.presenter.idle == nil {
+		e.presenter.idle = time.AfterFunc(presenterIdleTimeout, e.hidePresenter)
+	} else {
+		e.presenter.idle.Reset(presenterIdleTimeout)
+	}
+	e.mu.Unlock()
+
+	if err := showPresenterPointer(x, y); err != nil {
+		fmt.Printf("Failed to show presenter pointer: %v\n", err)
+	}
+}
+
+// hidePresenter ends the gesture and takes the pointer off the screen.
+func (e *Engine) hidePresenter() {
+	e.mu.Lock()
+	e.presenter.active = false
+	if e.presenter.idle != nil {
+		e.presenter.idle.Stop()
+	}
+	e.mu.Unlock()
+	hidePresenterPointer()
+}
+
+// Mouse buttons a mousepad request can click.
+const (
+	mouseLeft = iota
+	mouseRight
+	mouseMiddle
+)
+
+// keyModifiers are the modifier keys held with a mousepad key press.
+type keyModifiers struct {
+	shift, ctrl, alt, super bool
+}
+
+// handleMousepadRequest turns a device's remote input into local pointer and
+// keyboard events. The presenter plugin sends its slide navigation this way
+// too, as special keys.
+func (e *Engine) handleMousepadRequest(conn *network.Connection, req protocol.MousepadRequestBody) {
+	if !e.IsPaired(conn.DeviceId) {
+		return
+	}
+
+	mods := keyModifiers{shift: req.Shift, ctrl: req.Ctrl, alt: req.Alt, super: req.Super}
+	var err error
+	switch {
+	case req.SpecialKey != 0:
+		err = pressSpecialKey(req.SpecialKey, mods)
+	case req.Key != "":
+		err = typeKey(req.Key, mods)
+	case req.SingleClick:
+		err = clickPointer(mouseLeft, 1)
+	case req.DoubleClick:
+		err = clickPointer(mouseLeft, 2)
+	case req.RightClick:
+		err = clickPointer(mouseRight, 1)
+	case req.MiddleClick:
+		err = clickPointer(mouseMiddle, 1)
+	case req.Scroll:
+		err = scrollPointer(req.Dx, req.Dy)
+	case req.Dx != 0 || req.Dy != 0:
+		err = movePointerBy(req.Dx, req.Dy)
+	}
+	if err != nil {
+		fmt.Printf("Failed to apply remote input from %s: %v\n", conn.DeviceId, err)
+	}
+}
@@ -0,0 +1,157 @@
+//go:build darwin
+
+package core
+
+/*
+#cgo LDFLAGS: -framework CoreGraphics
+#include <CoreGraphics/CoreGraphics.h>
+#include <math.h>
+
+static CGPoint pointerLocation(void) {
+	CGEventRef event = CGEventCreate(NULL);
+	CGPoint p = CGEventGetLocation(event);
+	CFRelease(event);
+	return p;
+}
+
+static void postAndRelease(CGEventRef event) {
+	CGEventPost(kCGHIDEventTap, event);
+	CFRelease(event);
+}
+
+static void movePointerBy(double dx, double dy) {
+	CGPoint p = pointerLocation();
+	CGRect bounds = CGDisplayBounds(CGMainDisplayID());
+	p.x = fmin(fmax(p.x + dx, CGRectGetMinX(bounds)), CGRectGetMaxX(bounds) - 1);
+	p.y = fmin(fmax(p.y + dy, CGRectGetMinY(bounds)), CGRectGetMaxY(bounds) - 1);
+	postAndRelease(CGEventCreateMouseEvent(NULL, kCGEventMouseMoved, p, kCGMouseButtonLeft));
+}
+
+// button is 0 for left, 1 for right and 2 for middle.
+static void clickPointer(int button, int count) {
+	CGEventType downType = kCGEventLeftMouseDown, upType = kCGEventLeftMouseUp;
+	CGMouseButton b = kCGMouseButtonLeft;
+	if (button == 1) {
+		downType = kCGEventRightMouseDown;
+		upType = kCGEventRightMouseUp;
+		b = kCGMouseButtonRight;
+	} else if (button == 2) {
+		downType = kCGEventOtherMouseDown;
+		upType = kCGEventOtherMouseUp;
+		b = kCGMouseButtonCenter;
+	}
+
+	CGPoint p = pointerLocation();
+	for (int i = 1; i <= count; i++) {
+		CGEventRef down = CGEventCreateMouseEvent(NULL, downType, p, b);
+		CGEventRef up = CGEventCreateMouseEvent(NULL, upType, p, b);
+		CGEventSetIntegerValueField(down, kCGMouseEventClickState, i);
+		CGEventSetIntegerValueField(up, kCGMouseEventClickState, i);
+		postAndRelease(down);
+		postAndRelease(up);
+	}
+}
+
+static void scrollPointer(int dx, int dy) {
+	postAndRelease(CGEventCreateScrollWheelEvent(NULL, kCGScrollEventUnitPixel, 2, dy, dx));
+}
+
+static void postKey(int keyCode, CGEventFlags flags) {
+	CGEventRef down = CGEventCreateKeyboardEvent(NULL, (CGKeyCode)keyCode, true);
+	CGEventRef up = CGEventCreateKeyboardEvent(NULL, (CGKeyCode)keyCode, false);
+	CGEventSetFlags(down, flags);
+	CGEventSetFlags(up, flags);
+	postAndRelease(down);
+	postAndRelease(up);
+}
+
+static void postText(const UniChar *chars, int n, CGEventFlags flags) {
+	CGEventRef down = CGEventCreateKeyboardEvent(NULL, 0, true);
+	CGEventRef up = CGEventCreateKeyboardEvent(NULL, 0, false);
+	CGEventKeyboardSetUnicodeString(down, n, chars);
+	CGEventKeyboardSetUnicodeString(up, n, chars);
+	CGEventSetFlags(down, flags);
+	CGEventSetFlags(up, flags);
+	postAndRelease(down);
+	postAndRelease(up);
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"unicode/utf16"
+	"unsafe"
+)
+
+// macOS virtual key codes for the KDE Connect special keys we support.
+var darwinKeyCodes = map[int]int{
+	specialKeyBackspace: 51,
+	specialKeyTab:       48,
+	specialKeyLeft:      123,
+	specialKeyUp:        126,
+	specialKeyRight:     124,
+	specialKeyDown:      125,
+	specialKeyPageUp:    116,
+	specialKeyPageDown:  121,
+	specialKeyHome:      115,
+	specialKeyEnd:       119,
+	specialKeyReturn:    36,
+	specialKeyDelete:    117,
+	specialKeyEscape:    53,
+	specialKeyF5:        96,
+}
+
+// Event injection below requires the Accessibility permission.
+
+func movePointerBy(dx, dy float64) error {
+	C.movePointerBy(C.double(dx), C.double(dy))
+	return nil
+}
+
+func clickPointer(button, count int) error {
+	C.clickPointer(C.int(button), C.int(count))
+	return nil
+}
+
+func scrollPointer(dx, dy float64) error {
+	C.scrollPointer(C.int(dx), C.int(dy))
+	return nil
+}
+
+// eventFlags maps the modifiers to macOS ones; super is Command.
+func (m keyModifiers) eventFlags() C.CGEventFlags {
+	var flags C.CGEventFlags
+	if m.shift {
+		flags |= C.kCGEventFlagMaskShift
+	}
+	if m.ctrl {
+		flags |= C.kCGEventFlagMaskControl
+	}
+	if m.alt {
+		flags |= C.kCGEventFlagMaskAlternate
+	}
+	if m.super {
+		flags |= C.kCGEventFlagMaskCommand
+	}
+	return flags
+}
+
+func pressSpecialKey(key int, mods keyModifiers) error {
+	code, ok := darwinKeyCodes[key]
+	if !ok {
+		return fmt.Errorf("unsupported special key %d", key)
+	}
+	C.postKey(C.int(code), mods.eventFlags())
+	return nil
+}
+
+// typeKey types the text of key, which may be more than one character.
+func typeKey(key string, mods keyModifiers) error {
+	chars := utf16.Encode([]rune(key))
+	if len(chars) == 0 {
+		return nil
+	}
+	C.postText((*C.UniChar)(unsafe.Pointer(&chars[0])), C.int(len(chars)), mods.eventFlags())
+	return nil
+}
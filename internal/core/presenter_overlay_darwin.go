@@ -0,0 +1,65 @@
+//go:build darwin
+
+package core
+
+/*
+#cgo CFLAGS: -x objective-c -fobjc-arc
+#cgo LDFLAGS: -framework Cocoa
+#import <Cocoa/Cocoa.h>
+
+static const CGFloat pointerSize = 24;
+static NSWindow *pointerWindow;
+
+// The overlay is a borderless window above everything else, clicks passing
+// through it, holding a translucent red dot.
+static void createPointerWindow(void) {
+	NSWindow *w = [[NSWindow alloc] initWithContentRect:NSMakeRect(0, 0, pointerSize, pointerSize)
+		styleMask:NSWindowStyleMaskBorderless backing:NSBackingStoreBuffered defer:NO];
+	w.opaque = NO;
+	w.backgroundColor = [NSColor clearColor];
+	w.hasShadow = NO;
+	w.ignoresMouseEvents = YES;
+	w.releasedWhenClosed = NO;
+	w.level = NSScreenSaverWindowLevel;
+	w.collectionBehavior = NSWindowCollectionBehaviorCanJoinAllSpaces |
+		NSWindowCollectionBehaviorStationary | NSWindowCollectionBehaviorFullScreenAuxiliary;
+
+	NSView *dot = [[NSView alloc] initWithFrame:NSMakeRect(0, 0, pointerSize, pointerSize)];
+	dot.wantsLayer = YES;
+	dot.layer.backgroundColor = [NSColor colorWithSRGBRed:1 green:0 blue:0 alpha:0.7].CGColor;
+	dot.layer.cornerRadius = pointerSize / 2;
+	w.contentView = dot;
+	pointerWindow = w;
+}
+
+// x and y are fractions of the main screen from its top left. AppKit is
+// only used on the main thread, which the GUI's event loop runs.
+static void showPointer(double x, double y) {
+	dispatch_async(dispatch_get_main_queue(), ^{
+		if (pointerWindow == nil) {
+			createPointerWindow();
+		}
+		NSRect screen = [NSScreen screens].firstObject.frame;
+		[pointerWindow setFrameOrigin:NSMakePoint(
+			NSMinX(screen) + x * NSWidth(screen) - pointerSize / 2,
+			NSMaxY(screen) - y * NSHeight(screen) - pointerSize / 2)];
+		[pointerWindow orderFrontRegardless];
+	});
+}
+
+static void hidePointer(void) {
+	dispatch_async(dispatch_get_main_queue(), ^{
+		[pointerWindow orderOut:nil];
+	});
+}
+*/
+import "C"
+
+func showPresenterPointer(x, y float64) error {
+	C.showPointer(C.double(x), C.double(y))
+	return nil
+}
+
+func hidePresenterPointer() {
+	C.hidePointer()
+}
@@ -0,0 +1,31 @@
+//go:build !darwin
+
+package core
+
+import "fmt"
+
+func showPresenterPointer(x, y float64) error {
+	return fmt.Errorf("presenter pointer not supported on this platform")
+}
+
+func hidePresenterPointer() {}
+
+func movePointerBy(dx, dy float64) error {
+	return fmt.Errorf("pointer injection not supported on this platform")
+}
+
+func clickPointer(button, count int) error {
+	return fmt.Errorf("pointer injection not supported on this platform")
+}
+
+func scrollPointer(dx, dy float64) error {
+	return fmt.Errorf("pointer injection not supported on this platform")
+}
+
+func pressSpecialKey(key int, mods keyModifiers) error {
+	return fmt.Errorf("key injection not supported on this platform")
+}
+
+func typeKey(key string, mods keyModifiers) error {
+	return fmt.Errorf("key injection not supported on this platform")
+}
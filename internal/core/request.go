@@ -0,0 +1,60 @@
+package core
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/barishamil/kde-connect-fyne/internal/protocol"
+)
+
+// pendingRequest waits for the next packet of respType from a device.
+type pendingRequest struct {
+	deviceId string
+	respType string
+	resp     chan protocol.Packet
+}
+
+// Request sends a reqType packet to the device and waits for its next
+// respType packet. Built-in handling of the response still runs as usual.
+func (e *Engine) Request(deviceId, reqType string, body interface{}, respType string, timeout time.Duration) (protocol.Packet, error) {
+	req := &pendingRequest{deviceId: deviceId, respType: respType, resp: make(chan protocol.Packet, 1)}
+	e.mu.Lock()
+	e.requests = append(e.requests, req)
+	e.mu.Unlock()
+	defer e.removeRequest(req)
+
+	if err := e.SendPacket(deviceId, reqType, body); err != nil {
+		return protocol.Packet{}, err
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case p := <-req.resp:
+		return p, nil
+	case <-timer.C:
+		return protocol.Packet{}, fmt.Errorf("timeout waiting for %s", respType)
+	}
+}
+
+func (e *Engine) removeRequest(req *pendingRequest) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.requests = slices.DeleteFunc(e.requests, func(r *pendingRequest) bool {
+		return r == req
+	})
+}
+
+// resolveRequests hands p to the requests waiting for it.
+func (e *Engine) resolveRequests(deviceId string, p protocol.Packet) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.requests = slices.DeleteFunc(e.requests, func(r *pendingRequest) bool {
+		if r.deviceId != deviceId || r.respType != p.Type {
+			return false
+		}
+		r.resp <- p
+		return true
+	})
+}
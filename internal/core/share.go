@@ -0,0 +1,63 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/barishamil/kde-connect-fyne/internal/network"
+	"github.com/barishamil/kde-connect-fyne/internal/protocol"
+)
+
+// SendFile shares a local file with the device. onProgress receives the bytes
+// sent so far and the total; cancelling ctx aborts the transfer.
+func (e *Engine) SendFile(ctx context.Context, deviceId, path string, onProgress func(sent, total int64)) error {
+	if !e.DeviceSupports(deviceId, "kdeconnect.share.request") {
+		return fmt.Errorf("device %s does not accept files", deviceId)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", filepath.Base(path))
+	}
+
+	conn, err := e.getOrConnect(deviceId)
+	if err != nil {
+		return err
+	}
+
+	srv, err := network.ListenPayload(e.Cert, conn.PeerCertificate())
+	if err != nil {
+		return err
+	}
+
+	body := protocol.ShareRequestBody{
+		Filename:     filepath.Base(path),
+		LastModified: info.ModTime().UnixMilli(),
+	}
+	if err := conn.SendPacketWithPayload("kdeconnect.share.request", body, info.Size(), srv.Port); err != nil {
+		srv.Close()
+		return err
+	}
+
+	var total int64
+	defer func() {
+		e.RecordTransfer(total, 0)
+	}()
+	return srv.Serve(ctx, f, func(sent int64) {
+		total = sent
+		if onProgress != nil {
+			onProgress(sent, info.Size())
+		}
+	})
+}
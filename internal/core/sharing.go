@@ -0,0 +1,147 @@
+package core
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/barishamil/kde-connect-fyne/internal/network"
+	"github.com/barishamil/kde-connect-fyne/internal/protocol"
+)
+
+// SharedFolders returns the folders paired devices may browse.
+func (e *Engine) SharedFolders() []string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return slices.Clone(e.sharedFolders)
+}
+
+// AddSharedFolder lets paired devices browse dir. Devices already browsing
+// see the change when they next ask to browse.
+func (e *Engine) AddSharedFolder(dir string) {
+	dir = filepath.Clean(dir)
+	e.mu.Lock()
+	if slices.Contains(e.sharedFolders, dir) {
+		e.mu.Unlock()
+		return
+	}
+	e.sharedFolders = append(e.sharedFolders, dir)
+	e.mu.Unlock()
+	e.scheduleSave()
+}
+
+// RemoveSharedFolder stops sharing dir. Running SFTP servers keep serving
+// the folders they started with, so they're stopped; devices get the folders
+// still shared when they next ask to browse.
+func (e *Engine) RemoveSharedFolder(dir string) {
+	dir = filepath.Clean(dir)
+	e.mu.Lock()
+	e.sharedFolders = slices.DeleteFunc(e.sharedFolders, func(d string) bool {
+		return d == dir
+	})
+	var running []string
+	for deviceId := range e.sftpServers {
+		running = append(running, deviceId)
+	}
+	e.mu.Unlock()
+	e.scheduleSave()
+
+	for _, deviceId := range running {
+		e.stopSftpServer(deviceId)
+	}
+}
+
+// sharedFolderNames names each available shared folder after its base name,
+// numbering duplicates.
+func sharedFolderNames(dirs []string) []network.SharedFolder {
+	var folders []network.SharedFolder
+	used := make(map[string]bool)
+	for _, dir := range dirs {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			continue
+		}
+		base := filepath.Base(dir)
+		if base == "/" || base == "." {
+			base = "Files"
+		}
+		name := base
+		for i := 2; used[name]; i++ {
+			name = fmt.Sprintf("%s (%d)", base, i)
+		}
+		used[name] = true
+		folders = append(folders, network.SharedFolder{Name: name, Path: dir})
+	}
+	return folders
+}
+
+// handleSftpRequest answers a device's request to browse our files with an
+// offer for a fresh SFTP server, replacing any earlier one for the device.
+func (e *Engine) handleSftpRequest(conn *network.Connection) {
+	deviceId := conn.DeviceId
+	if !e.IsPaired(deviceId) {
+		return
+	}
+
+	offer, err := e.startSftpServer(conn)
+	if err != nil {
+		fmt.Printf("Not offering SFTP to %s: %v\n", deviceId, err)
+		offer = protocol.SftpBody{ErrorMessage: err.Error()}
+	}
+	if err := conn.SendPacket("kdeconnect.sftp", offer); err != nil {
+		fmt.Printf("Failed to send SFTP offer to %s: %v\n", deviceId, err)
+	}
+}
+
+func (e *Engine) startSftpServer(conn *network.Connection) (protocol.SftpBody, error) {
+	dirs := e.SharedFolders()
+	if len(dirs) == 0 {
+		return protocol.SftpBody{}, fmt.Errorf("no folder is shared")
+	}
+	folders := sharedFolderNames(dirs)
+	if len(folders) == 0 {
+		return protocol.SftpBody{}, fmt.Errorf("no shared folder is available")
+	}
+
+	remote, ok := conn.Conn.RemoteAddr().(*net.TCPAddr)
+	if !ok {
+		return protocol.SftpBody{}, fmt.Errorf("unsupported transport")
+	}
+
+	e.stopSftpServer(conn.DeviceId)
+	srv, err := network.NewSFTPServer(folders, remote.IP)
+	if err != nil {
+		return protocol.SftpBody{}, err
+	}
+	if err := srv.Start(); err != nil {
+		return protocol.SftpBody{}, err
+	}
+
+	e.mu.Lock()
+	e.sftpServers[conn.DeviceId] = srv
+	e.mu.Unlock()
+
+	offer := protocol.SftpBody{
+		Port:     srv.Port,
+		User:     srv.User,
+		Password: srv.Password,
+		Path:     "/",
+	}
+	for _, folder := range folders {
+		offer.MultiPaths = append(offer.MultiPaths, "/"+folder.Name)
+		offer.PathNames = append(offer.PathNames, folder.Name)
+	}
+	fmt.Printf("Serving %d shared folders to %s over SFTP on port %d\n", len(folders), conn.DeviceId, srv.Port)
+	return offer, nil
+}
+
+func (e *Engine) stopSftpServer(deviceId string) {
+	e.mu.Lock()
+	srv, ok := e.sftpServers[deviceId]
+	delete(e.sftpServers, deviceId)
+	e.mu.Unlock()
+	if ok {
+		srv.Stop()
+	}
+}
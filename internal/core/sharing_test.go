@@ -0,0 +1,40 @@
+package core
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/barishamil/kde-connect-fyne/internal/network"
+)
+
+func TestRemoveSharedFolderStopsServers(t *testing.T) {
+	e := newTestEngine(t)
+	dir := t.TempDir()
+	e.AddSharedFolder(dir)
+
+	srv, err := network.NewSFTPServer(sharedFolderNames(e.SharedFolders()), net.IPv4(127, 0, 0, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	phone := testIdentity()
+	e.mu.Lock()
+	e.sftpServers[phone.DeviceId] = srv
+	e.mu.Unlock()
+
+	e.RemoveSharedFolder(dir)
+
+	e.mu.RLock()
+	_, running := e.sftpServers[phone.DeviceId]
+	e.mu.RUnlock()
+	if running {
+		t.Fatal("server still registered after its folder was unshared")
+	}
+	if conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", srv.Port)); err == nil {
+		conn.Close()
+		t.Fatal("server still accepting connections after its folder was unshared")
+	}
+}
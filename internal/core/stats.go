@@ -0,0 +1,123 @@
+package core
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a snapshot of the engine's counters since it was created.
+type Stats struct {
+	Discovered int `json:"discovered"`
+	Paired     int `json:"paired"`
+	Active     int `json:"active"`
+	// Bytes moved by file transfers and payloads, not packets
+	BytesSent       int64            `json:"bytesSent"`
+	BytesReceived   int64            `json:"bytesReceived"`
+	PacketsSent     map[string]int64 `json:"packetsSent"`
+	PacketsReceived map[string]int64 `json:"packetsReceived"`
+	Uptime          time.Duration    `json:"uptime"`
+}
+
+type engineStats struct {
+	started         time.Time
+	bytesSent       atomic.Int64
+	bytesReceived   atomic.Int64
+	packetsSent     sync.Map // packet type -> *atomic.Int64
+	packetsReceived sync.Map
+}
+
+func countPacket(m *sync.Map, pType string) {
+	c, ok := m.Load(pType)
+	if !ok {
+		c, _ = m.LoadOrStore(pType, new(atomic.Int64))
+	}
+	c.(*atomic.Int64).Add(1)
+}
+
+func packetCounts(m *sync.Map) map[string]int64 {
+	counts := make(map[string]int64)
+	m.Range(func(k, v interface{}) bool {
+		counts[k.(string)] = v.(*atomic.Int64).Load()
+		return true
+	})
+	return counts
+}
+
+// RecordTransfer adds bytes moved outside the engine, such as SFTP
+// downloads, to the transfer totals.
+func (e *Engine) RecordTransfer(sent, received int64) {
+	e.stats.bytesSent.Add(sent)
+	e.stats.bytesReceived.Add(received)
+}
+
+func (e *Engine) Stats() Stats {
+	e.mu.RLock()
+	st := Stats{
+		Discovered: len(e.discoveredDevices),
+		Paired:     len(e.pairedDevices),
+		Active:     len(e.activeConns),
+	}
+	e.mu.RUnlock()
+
+	st.BytesSent = e.stats.bytesSent.Load()
+	st.BytesReceived = e.stats.bytesReceived.Load()
+	st.PacketsSent = packetCounts(&e.stats.packetsSent)
+	st.PacketsReceived = packetCounts(&e.stats.packetsReceived)
+	st.Uptime = time.Since(e.stats.started)
+	return st
+}
+
+// DeviceStats are the counters kept for one device since the engine started.
+type DeviceStats struct {
+	PacketsSent     map[string]int64 `json:"packetsSent"`
+	PacketsReceived map[string]int64 `json:"packetsReceived"`
+	// ConnectAttempts counts outgoing connection attempts, Connects every
+	// connection established, in either direction.
+	ConnectAttempts int64     `json:"connectAttempts"`
+	Connects        int64     `json:"connects"`
+	LastError       string    `json:"lastError,omitempty"`
+	LastErrorTime   time.Time `json:"lastErrorTime,omitempty"`
+}
+
+type deviceStats struct {
+	packetsSent     sync.Map
+	packetsReceived sync.Map
+	connectAttempts atomic.Int64
+	connects        atomic.Int64
+
+	mu          sync.Mutex
+	lastError   string
+	lastErrorAt time.Time
+}
+
+func (e *Engine) deviceStats(deviceId string) *deviceStats {
+	ds, ok := e.devStats.Load(deviceId)
+	if !ok {
+		ds, _ = e.devStats.LoadOrStore(deviceId, new(deviceStats))
+	}
+	return ds.(*deviceStats)
+}
+
+func (e *Engine) recordConnectionError(deviceId string, err error) {
+	ds := e.deviceStats(deviceId)
+	ds.mu.Lock()
+	ds.lastError = err.Error()
+	ds.lastErrorAt = time.Now()
+	ds.mu.Unlock()
+}
+
+func (e *Engine) DeviceStats(deviceId string) DeviceStats {
+	ds := e.deviceStats(deviceId)
+	st := DeviceStats{
+		PacketsSent:     packetCounts(&ds.packetsSent),
+		PacketsReceived: packetCounts(&ds.packetsReceived),
+		ConnectAttempts: ds.connectAttempts.Load(),
+		Connects:        ds.connects.Load(),
+	}
+	ds.mu.Lock()
+	st.LastError = ds.lastError
+	st.LastErrorTime = ds.lastErrorAt
+	ds.mu.Unlock()
+	return st
+}
@@ -0,0 +1,53 @@
+package core
+
+// Status reports which of the engine's network services are up, so users can
+// tell why nothing is being found.
+type Status struct {
+	// Initializing is set while the certificate for a new identity is
+	// being generated; nothing else starts until it is ready
+	Initializing bool
+	// Broadcasting is set while our identity is announced on the LAN
+	Broadcasting bool
+	// Discovering is set while the UDP discovery port is bound
+	Discovering bool
+	// Coexisting is set when another KDE Connect on this machine holds the
+	// discovery port; devices are then found through mDNS, and this one
+	// isn't registered there
+	Coexisting bool
+	// Listening is set while the TCP server accepts connections on Port
+	Listening bool
+	Port      int
+	// Errors from services that failed to start, by service
+	Errors map[string]string
+}
+
+// Status returns the state of the engine's network services. It changes
+// with status_changed events.
+func (e *Engine) Status() Status {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	st := e.status
+	st.Errors = make(map[string]string, len(e.status.Errors))
+	for k, v := range e.status.Errors {
+		st.Errors[k] = v
+	}
+	return st
+}
+
+// setServiceStatus records whether a service started and emits
+// status_changed.
+func (e *Engine) setServiceStatus(service string, err error, set func(*Status)) {
+	e.mu.Lock()
+	if e.status.Errors == nil {
+		e.status.Errors = make(map[string]string)
+	}
+	if err != nil {
+		e.status.Errors[service] = err.Error()
+	} else {
+		delete(e.status.Errors, service)
+		set(&e.status)
+	}
+	e.mu.Unlock()
+
+	e.Events.Emit("status_changed", e.Status())
+}
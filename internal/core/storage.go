@@ -5,7 +5,9 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"time"
 
+	"github.com/barishamil/kde-connect-fyne/internal/network"
 	"github.com/barishamil/kde-connect-fyne/internal/protocol"
 )
 
@@ -13,122 +15,250 @@ type PairedDeviceInfo struct {
 	Identity protocol.IdentityBody `json:"identity"`
 	LastIP   string                `json:"lastIP"`
 	LastPort int                   `json:"lastPort"`
+	// Fingerprint pins the hex SHA-256 of the certificate the device paired
+	// with
+	Fingerprint string `json:"fingerprint,omitempty"`
 }
 
 type Config struct {
+	Version       int                         `json:"version"`
 	Identity      protocol.IdentityBody       `json:"identity"`
 	PairedDevices map[string]PairedDeviceInfo `json:"pairedDevices"`
+	// KnownHosts pins each device's SFTP host key (base64 wire format)
+	KnownHosts map[string]string `json:"knownHosts,omitempty"`
+	// PluginSettings holds per-device plugin overrides; plugins not listed
+	// are enabled.
+	PluginSettings map[string]map[string]bool `json:"pluginSettings,omitempty"`
+	// OpenWith maps lowercase file extensions to the application files of
+	// that type are opened with.
+	OpenWith map[string]string `json:"openWith,omitempty"`
+	// LastPaths is the folder each device's files were last browsed in.
+	LastPaths map[string]string `json:"lastPaths,omitempty"`
+	// AutoPair maps the devices whose pair requests are accepted without
+	// asking to the certificate fingerprint they must present.
+	AutoPair map[string]string `json:"autoPair,omitempty"`
+	// SharedFolders are the local folders paired devices may browse over
+	// SFTP; none turns browsing off.
+	SharedFolders []string `json:"sharedFolders,omitempty"`
+	// DiscoveryInterfaces restricts discovery to these network interfaces;
+	// none means all.
+	DiscoveryInterfaces []string `json:"discoveryInterfaces,omitempty"`
+	// MinTLSVersion is "1.2" or "1.3"; empty means 1.2.
+	MinTLSVersion string `json:"minTLSVersion,omitempty"`
+	// IdleTimeoutSeconds drops connections silent for this long; 0 never
+	// does.
+	IdleTimeoutSeconds int `json:"idleTimeoutSeconds,omitempty"`
+	// KeyType is the key new certificates are generated with, "rsa" or
+	// "ec"; empty means RSA. $KDECONNECT_FYNE_KEY_TYPE overrides it.
+	KeyType string `json:"keyType,omitempty"`
 }
 
+// GetConfigDir returns the default config directory: $KDECONNECT_FYNE_CONFIG_DIR
+// if set, otherwise kde-connect-fyne under $XDG_CONFIG_HOME or ~/.config.
 func GetConfigDir() string {
-	home, _ := os.UserHomeDir()
-	dir := filepath.Join(home, ".config", "kde-connect-fyne")
+	dir := os.Getenv("KDECONNECT_FYNE_CONFIG_DIR")
+	if dir == "" {
+		base := os.Getenv("XDG_CONFIG_HOME")
+		if base == "" {
+			home, _ := os.UserHomeDir()
+			base = filepath.Join(home, ".config")
+		}
+		dir = filepath.Join(base, "kde-connect-fyne")
+	}
 	os.MkdirAll(dir, 0700)
 	return dir
 }
 
+// ConfigDir returns the directory the engine persists its state in.
+func (e *Engine) ConfigDir() string {
+	return e.configDir
+}
+
+// writeFileAtomic writes to a temp file in the same directory and renames it
+// over path, so readers never see a partially written file.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if err := os.Chmod(tmpName, perm); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	return nil
+}
+
 func (e *Engine) SaveConfig() error {
-	dir := GetConfigDir()
+	// Serialize saves so an older snapshot can't overwrite a newer one
+	e.saveMu.Lock()
+	defer e.saveMu.Unlock()
+
+	dir := e.configDir
 
 	e.mu.RLock()
+	identity := e.Identity
+	if e.fixedPort {
+		identity.TcpPort = e.savedPort
+	}
 	config := Config{
-		Identity:      e.Identity,
-		PairedDevices: e.pairedDevices,
+		Version:             configVersion,
+		Identity:            identity,
+		PairedDevices:       e.pairedDevices,
+		KnownHosts:          e.knownHosts,
+		PluginSettings:      e.pluginSettings,
+		OpenWith:            e.openWith,
+		LastPaths:           e.lastPaths,
+		AutoPair:            e.autoPair,
+		SharedFolders:       e.sharedFolders,
+		DiscoveryInterfaces: e.discoveryIfaces,
+		MinTLSVersion:       e.minTLSVersion,
+		IdleTimeoutSeconds:  int(e.idleTimeout / time.Second),
+		KeyType:             e.keyType,
 	}
-	e.mu.RUnlock()
-
+	// Marshal under the lock since the maps are shared with the engine
 	data, err := json.MarshalIndent(config, "", "  ")
+	e.mu.RUnlock()
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(filepath.Join(dir, "config.json"), data, 0600)
+	return writeFileAtomic(filepath.Join(dir, "config.json"), data, 0600)
+}
+
+// scheduleSave coalesces bursts of changes (e.g. discovery updates) into at
+// most one write per second. The state is read when the save runs, so no
+// update is lost.
+func (e *Engine) scheduleSave() {
+	e.saveTimerMu.Lock()
+	defer e.saveTimerMu.Unlock()
+	if e.saveTimer == nil {
+		e.saveTimer = time.AfterFunc(time.Second, func() {
+			e.FlushConfig()
+		})
+	}
+}
+
+// FlushConfig writes a pending scheduled save immediately. Call it on shutdown.
+func (e *Engine) FlushConfig() error {
+	e.saveTimerMu.Lock()
+	pending := e.saveTimer != nil
+	if pending {
+		e.saveTimer.Stop()
+		e.saveTimer = nil
+	}
+	e.saveTimerMu.Unlock()
+
+	if !pending {
+		return nil
+	}
+	return e.SaveConfig()
 }
 
 func (e *Engine) LoadConfig() error {
-	dir := GetConfigDir()
+	dir := e.configDir
 	data, err := os.ReadFile(filepath.Join(dir, "config.json"))
 	if err != nil {
 		return err
 	}
 
-	// Use a temporary structure to catch the raw JSON of paired devices
-	var raw struct {
-		Identity      protocol.IdentityBody `json:"identity"`
-		PairedDevices json.RawMessage       `json:"pairedDevices"`
+	data, migrated, err := migrateConfig(data)
+	if err != nil {
+		return err
 	}
-	if err := json.Unmarshal(data, &raw); err != nil {
+
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
 		return err
 	}
 
 	e.mu.Lock()
-	e.Identity = raw.Identity
-	if e.pairedDevices == nil {
-		e.pairedDevices = make(map[string]PairedDeviceInfo)
+	e.Identity = config.Identity
+	if config.KnownHosts != nil {
+		e.knownHosts = config.KnownHosts
 	}
-	e.mu.Unlock()
-
-	if len(raw.PairedDevices) == 0 {
-		return nil
+	if config.PluginSettings != nil {
+		e.pluginSettings = config.PluginSettings
 	}
-
-	// Try unmarshaling as new format
-	var newFormat map[string]PairedDeviceInfo
-	if err := json.Unmarshal(raw.PairedDevices, &newFormat); err == nil {
-		// Verify it's actually the new format (identity field must not be empty if map not empty)
-		isNew := true
-		for _, v := range newFormat {
-			if v.Identity.DeviceId == "" {
-				isNew = false
-				break
-			}
-		}
-		if isNew && len(newFormat) > 0 {
-			e.mu.Lock()
-			// Ensure defaults for loaded devices
-			for k, v := range newFormat {
-				if v.LastPort == 0 {
-					v.LastPort = 1716
-				}
-				newFormat[k] = v
-			}
-			e.pairedDevices = newFormat
-			e.mu.Unlock()
-			return nil
-		}
+	if config.OpenWith != nil {
+		e.openWith = config.OpenWith
 	}
-
-	// Fallback to old format
-	var oldFormat map[string]protocol.IdentityBody
-	if err := json.Unmarshal(raw.PairedDevices, &oldFormat); err == nil {
-		e.mu.Lock()
-		for k, v := range oldFormat {
-			port := v.TcpPort
-			if port == 0 {
-				port = 1716
-			}
-			e.pairedDevices[k] = PairedDeviceInfo{Identity: v, LastPort: port}
+	if config.LastPaths != nil {
+		e.lastPaths = config.LastPaths
+	}
+	if config.AutoPair != nil {
+		e.autoPair = config.AutoPair
+	}
+	e.sharedFolders = config.SharedFolders
+	e.discoveryIfaces = config.DiscoveryInterfaces
+	e.minTLSVersion = config.MinTLSVersion
+	e.idleTimeout = time.Duration(max(config.IdleTimeoutSeconds, 0)) * time.Second
+	network.SetMinTLSVersion(tlsVersion(e.minTLSVersion))
+	e.keyType = config.KeyType
+	e.pairedDevices = make(map[string]PairedDeviceInfo)
+	for k, v := range config.PairedDevices {
+		// Ensure defaults for loaded devices
+		if v.LastPort == 0 {
+			v.LastPort = 1716
 		}
-		e.mu.Unlock()
+		e.pairedDevices[k] = v
 	}
+	e.mu.Unlock()
 
+	if migrated {
+		return e.SaveConfig()
+	}
 	return nil
 }
 
 func (e *Engine) SaveCertificate(certPEM, privPEM []byte) error {
-	dir := GetConfigDir()
-	if err := os.WriteFile(filepath.Join(dir, "cert.pem"), certPEM, 0600); err != nil {
+	dir := e.configDir
+	if err := writeFileAtomic(filepath.Join(dir, "cert.pem"), certPEM, 0600); err != nil {
 		return err
 	}
-	return os.WriteFile(filepath.Join(dir, "key.pem"), privPEM, 0600)
+	if e.KeyEncrypted() {
+		return e.saveEncryptedKey(privPEM)
+	}
+	return writeFileAtomic(filepath.Join(dir, "key.pem"), privPEM, 0600)
 }
 
 func (e *Engine) LoadCertificate() (*tls.Certificate, error) {
-	dir := GetConfigDir()
-	cert, err := tls.LoadX509KeyPair(
-		filepath.Join(dir, "cert.pem"),
-		filepath.Join(dir, "key.pem"),
-	)
+	dir := e.configDir
+	certPEM, err := os.ReadFile(filepath.Join(dir, "cert.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	var privPEM []byte
+	if e.KeyEncrypted() {
+		privPEM, err = e.loadEncryptedKey()
+	} else {
+		privPEM, err = os.ReadFile(filepath.Join(dir, "key.pem"))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, privPEM)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,113 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestConcurrentSaveConfigStaysParseable(t *testing.T) {
+	e := newTestEngine(t)
+	path := filepath.Join(e.ConfigDir(), "config.json")
+
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 10 {
+				id := fmt.Sprintf("device_%d_%d", i, j)
+				e.mu.Lock()
+				e.pairedDevices[id] = PairedDeviceInfo{Identity: testIdentity(), LastIP: "192.0.2.1"}
+				e.mu.Unlock()
+				if err := e.SaveConfig(); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	for reading := true; reading; {
+		select {
+		case <-done:
+			reading = false
+		default:
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var config Config
+		if err := json.Unmarshal(data, &config); err != nil {
+			t.Fatalf("config.json unparseable during saves: %v", err)
+		}
+	}
+
+	var config Config
+	data, _ := os.ReadFile(path)
+	if err := json.Unmarshal(data, &config); err != nil {
+		t.Fatal(err)
+	}
+	if len(config.PairedDevices) != 200 {
+		t.Fatalf("saved %d paired devices, want 200", len(config.PairedDevices))
+	}
+}
+
+func TestListenPortNotSaved(t *testing.T) {
+	e := newTestEngine(t)
+	saved := e.Identity.TcpPort
+
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+	if err := e.SetListenPort(port); err != nil {
+		t.Fatal(err)
+	}
+	if e.Identity.TcpPort != port {
+		t.Fatalf("listening on %d, want %d", e.Identity.TcpPort, port)
+	}
+	if err := e.SaveConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	var config Config
+	data, _ := os.ReadFile(filepath.Join(e.ConfigDir(), "config.json"))
+	if err := json.Unmarshal(data, &config); err != nil {
+		t.Fatal(err)
+	}
+	if config.Identity.TcpPort != saved {
+		t.Fatalf("saved port %d, want %d", config.Identity.TcpPort, saved)
+	}
+}
+
+func TestTransferHistoryCap(t *testing.T) {
+	e := newTestEngine(t)
+	var records []TransferRecord
+	for i := range maxTransferHistory + 5 {
+		records = append(records, TransferRecord{Name: fmt.Sprintf("%d.jpg", i), Direction: "download", Status: "Completed"})
+	}
+	if err := e.SaveTransferHistory(records); err != nil {
+		t.Fatal(err)
+	}
+
+	got := e.TransferHistory()
+	if len(got) != maxTransferHistory {
+		t.Fatalf("%d transfers kept, want %d", len(got), maxTransferHistory)
+	}
+	// The oldest are dropped
+	if got[0].Name != "5.jpg" || got[len(got)-1].Name != records[len(records)-1].Name {
+		t.Fatalf("kept %s to %s, want the newest", got[0].Name, got[len(got)-1].Name)
+	}
+}
@@ -0,0 +1,106 @@
+package core
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/barishamil/kde-connect-fyne/internal/network"
+	"github.com/barishamil/kde-connect-fyne/internal/protocol"
+)
+
+// We expose the system output as a single sink.
+const systemVolumeSink = "default"
+
+func systemVolumeSinkList() ([]protocol.SystemVolumeSink, error) {
+	volume, muted, err := getSystemVolume()
+	if err != nil {
+		return nil, err
+	}
+	return []protocol.SystemVolumeSink{{
+		Name:        systemVolumeSink,
+		Description: "System Output",
+		Muted:       muted,
+		Volume:      volume,
+		MaxVolume:   100,
+		Enabled:     true,
+	}}, nil
+}
+
+func (e *Engine) handleSystemVolumeRequest(conn *network.Connection, req protocol.SystemVolumeBody) {
+	// Only paired devices may control our audio
+	if !e.IsPaired(conn.DeviceId) {
+		fmt.Printf("Ignoring system volume request from unpaired device %s\n", conn.DeviceId)
+		return
+	}
+
+	if req.RequestSinks {
+		sinks, err := systemVolumeSinkList()
+		if err != nil {
+			fmt.Printf("Failed to read system volume: %v\n", err)
+			sinks = []protocol.SystemVolumeSink{}
+		}
+		conn.SendPacket("kdeconnect.systemvolume", protocol.SystemVolumeBody{SinkList: sinks})
+		return
+	}
+
+	if req.Name != "" && req.Name != systemVolumeSink {
+		return
+	}
+	if req.Volume != nil {
+		if err := setSystemVolume(*req.Volume); err != nil {
+			fmt.Printf("Failed to set system volume: %v\n", err)
+		}
+	}
+	if req.Muted != nil {
+		if err := setSystemMuted(*req.Muted); err != nil {
+			fmt.Printf("Failed to set system mute: %v\n", err)
+		}
+	}
+}
+
+// watchSystemVolume polls the local output volume and pushes changes to
+// connected paired devices, so their sliders follow the desktop, until the
+// engine stops.
+func (e *Engine) watchSystemVolume() {
+	lastVolume, lastMuted, err := getSystemVolume()
+	if err != nil {
+		fmt.Printf("System volume unavailable: %v\n", err)
+		return
+	}
+
+	t := time.NewTicker(2 * time.Second)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+		case <-e.stop:
+			return
+		}
+
+		volume, muted, err := getSystemVolume()
+		if err != nil || (volume == lastVolume && muted == lastMuted) {
+			continue
+		}
+		lastVolume, lastMuted = volume, muted
+
+		e.mu.RLock()
+		conns := make([]*network.Connection, 0, len(e.activeConns))
+		for id, conn := range e.activeConns {
+			if _, paired := e.pairedDevices[id]; paired {
+				conns = append(conns, conn)
+			}
+		}
+		e.mu.RUnlock()
+
+		for _, conn := range conns {
+			if !e.DeviceSupports(conn.DeviceId, "kdeconnect.systemvolume") {
+				continue
+			}
+			conn.SendPacket("kdeconnect.systemvolume", protocol.SystemVolumeBody{
+				Name:   systemVolumeSink,
+				Volume: &volume,
+				Muted:  &muted,
+			})
+		}
+	}
+}
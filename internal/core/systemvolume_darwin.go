@@ -0,0 +1,45 @@
+//go:build darwin
+
+package core
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+func getSystemVolume() (int, bool, error) {
+	// Output looks like "output volume:50, input volume:75, alert volume:100, output muted:false"
+	out, err := exec.Command("osascript", "-e", "get volume settings").Output()
+	if err != nil {
+		return 0, false, err
+	}
+
+	volume, muted := -1, false
+	for _, part := range strings.Split(strings.TrimSpace(string(out)), ", ") {
+		key, value, _ := strings.Cut(part, ":")
+		switch key {
+		case "output volume":
+			// "missing value" when the output device has no volume control
+			if v, err := strconv.Atoi(value); err == nil {
+				volume = v
+			}
+		case "output muted":
+			muted = value == "true"
+		}
+	}
+	if volume < 0 {
+		return 0, false, fmt.Errorf("output volume not available")
+	}
+	return volume, muted, nil
+}
+
+func setSystemVolume(volume int) error {
+	volume = max(0, min(volume, 100))
+	return exec.Command("osascript", "-e", fmt.Sprintf("set volume output volume %d", volume)).Run()
+}
+
+func setSystemMuted(muted bool) error {
+	return exec.Command("osascript", "-e", fmt.Sprintf("set volume output muted %t", muted)).Run()
+}
@@ -0,0 +1,17 @@
+//go:build !darwin
+
+package core
+
+import "fmt"
+
+func getSystemVolume() (int, bool, error) {
+	return 0, false, fmt.Errorf("system volume control not supported on this platform")
+}
+
+func setSystemVolume(volume int) error {
+	return fmt.Errorf("system volume control not supported on this platform")
+}
+
+func setSystemMuted(muted bool) error {
+	return fmt.Errorf("system volume control not supported on this platform")
+}
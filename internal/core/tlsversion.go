@@ -0,0 +1,39 @@
+package core
+
+import (
+	"crypto/tls"
+	"fmt"
+
+	"github.com/barishamil/kde-connect-fyne/internal/network"
+)
+
+func tlsVersion(name string) uint16 {
+	if name == "1.3" {
+		return tls.VersionTLS13
+	}
+	return tls.VersionTLS12
+}
+
+// MinTLSVersion returns the oldest TLS version accepted, "1.2" or "1.3".
+func (e *Engine) MinTLSVersion() string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if e.minTLSVersion == "" {
+		return "1.2"
+	}
+	return e.minTLSVersion
+}
+
+// SetMinTLSVersion changes the oldest TLS version accepted. It applies to new
+// connections; devices stuck on TLS 1.2 can't connect while it is "1.3".
+func (e *Engine) SetMinTLSVersion(name string) error {
+	if name != "1.2" && name != "1.3" {
+		return fmt.Errorf("unsupported TLS version %q", name)
+	}
+	e.mu.Lock()
+	e.minTLSVersion = name
+	e.mu.Unlock()
+	network.SetMinTLSVersion(tlsVersion(name))
+	e.scheduleSave()
+	return nil
+}
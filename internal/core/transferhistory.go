@@ -0,0 +1,49 @@
+package core
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// maxTransferHistory is how many finished transfers are kept across restarts.
+const maxTransferHistory = 100
+
+// TransferRecord is a finished transfer as kept in the transfer history.
+type TransferRecord struct {
+	Name      string    `json:"name"`
+	Device    string    `json:"device,omitempty"`
+	Direction string    `json:"direction"` // "download" or "upload"
+	Size      int64     `json:"size,omitempty"`
+	Status    string    `json:"status"`
+	Time      time.Time `json:"time"`
+	LocalPath string    `json:"localPath,omitempty"`
+}
+
+func (e *Engine) transferHistoryPath() string {
+	return filepath.Join(e.configDir, "transfers.json")
+}
+
+// TransferHistory returns the saved transfers, oldest first.
+func (e *Engine) TransferHistory() []TransferRecord {
+	var records []TransferRecord
+	data, err := os.ReadFile(e.transferHistoryPath())
+	if err == nil {
+		json.Unmarshal(data, &records)
+	}
+	return records
+}
+
+// SaveTransferHistory replaces the saved transfers with records, oldest
+// first, keeping only the newest maxTransferHistory.
+func (e *Engine) SaveTransferHistory(records []TransferRecord) error {
+	if len(records) > maxTransferHistory {
+		records = records[len(records)-maxTransferHistory:]
+	}
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(e.transferHistoryPath(), data, 0600)
+}
@@ -4,51 +4,166 @@ import "sync"
 
 type Listener func(data interface{})
 
+// AnyListener receives every event along with its name.
+type AnyListener func(event string, data interface{})
+
+// Handle identifies a registered listener so it can be removed with Off.
+type Handle uint64
+
+type entry struct {
+	handle   Handle
+	listener Listener
+	sub      *subscriber
+}
+
+type anyEntry struct {
+	handle   Handle
+	listener AnyListener
+	sub      *subscriber
+}
+
+// subscriber calls one listener with its events one at a time, in the order
+// they were emitted, so a slow listener only holds up itself. Its goroutine
+// exits whenever the queue runs dry.
+type subscriber struct {
+	mu      sync.Mutex
+	queue   []func()
+	running bool
+}
+
+func (s *subscriber) dispatch(call func()) {
+	s.mu.Lock()
+	s.queue = append(s.queue, call)
+	if s.running {
+		s.mu.Unlock()
+		return
+	}
+	s.running = true
+	s.mu.Unlock()
+	go s.run()
+}
+
+func (s *subscriber) run() {
+	for {
+		s.mu.Lock()
+		if len(s.queue) == 0 {
+			s.running = false
+			s.mu.Unlock()
+			return
+		}
+		call := s.queue[0]
+		s.queue[0] = nil
+		s.queue = s.queue[1:]
+		s.mu.Unlock()
+		call()
+	}
+}
+
 type EventEmitter struct {
 	mu        sync.RWMutex
-	listeners map[string][]Listener
+	listeners map[string][]entry
+	any       []anyEntry
+	next      Handle
 }
 
 func NewEventEmitter() *EventEmitter {
 	return &EventEmitter{
-		listeners: make(map[string][]Listener),
+		listeners: make(map[string][]entry),
 	}
 }
 
 // On registers a callback for a specific event name.
-func (e *EventEmitter) On(event string, listener Listener) {
+func (e *EventEmitter) On(event string, listener Listener) Handle {
 	e.mu.Lock()
 	defer e.mu.Unlock()
-	e.listeners[event] = append(e.listeners[event], listener)
+	e.next++
+	e.listeners[event] = append(e.listeners[event], entry{e.next, listener, &subscriber{}})
+	return e.next
 }
 
-// Off removes a callback for a specific event name.
-func (e *EventEmitter) Off(event string, listener Listener) {
-	// Function pointer comparison in Go is not reliable for closures.
-	// For now, this is a placeholder or we can just skip it if not strictly needed.
+// OnAny registers a callback for every event.
+func (e *EventEmitter) OnAny(listener AnyListener) Handle {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.next++
+	e.any = append(e.any, anyEntry{e.next, listener, &subscriber{}})
+	return e.next
+}
+
+// Off removes the listener registered under handle. Removing one that is
+// already gone does nothing.
+func (e *EventEmitter) Off(handle Handle) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for event, entries := range e.listeners {
+		for i, en := range entries {
+			if en.handle == handle {
+				// Copy so an Emit iterating the old slice isn't affected
+				rest := make([]entry, 0, len(entries)-1)
+				rest = append(rest, entries[:i]...)
+				rest = append(rest, entries[i+1:]...)
+				if len(rest) == 0 {
+					delete(e.listeners, event)
+				} else {
+					e.listeners[event] = rest
+				}
+				return
+			}
+		}
+	}
+	for i, en := range e.any {
+		if en.handle == handle {
+			rest := make([]anyEntry, 0, len(e.any)-1)
+			rest = append(rest, e.any[:i]...)
+			e.any = append(rest, e.any[i+1:]...)
+			return
+		}
+	}
+}
+
+// ListenerCount returns how many listeners are registered, wildcard ones
+// included.
+func (e *EventEmitter) ListenerCount() int {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	n := len(e.any)
+	for _, entries := range e.listeners {
+		n += len(entries)
+	}
+	return n
 }
 
 // Once registers a callback that will be called at most once.
-func (e *EventEmitter) Once(event string, listener Listener) {
+func (e *EventEmitter) Once(event string, listener Listener) Handle {
 	var once sync.Once
-	var wrapper Listener
-	wrapper = func(data interface{}) {
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.next++
+	handle := e.next
+	e.listeners[event] = append(e.listeners[event], entry{handle, func(data interface{}) {
 		once.Do(func() {
+			e.Off(handle)
 			listener(data)
-			// Ideally we'd remove 'wrapper' here if we had a way to identify it
 		})
-	}
-	e.On(event, wrapper)
+	}, &subscriber{}})
+	return handle
 }
 
-// Emit triggers all listeners registered for the event name in separate goroutines.
+// Emit triggers all listeners registered for the event name, and all
+// wildcard listeners, without waiting for them. Each listener sees events in
+// the order they were emitted.
 func (e *EventEmitter) Emit(event string, data interface{}) {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
 
-	if listeners, ok := e.listeners[event]; ok {
-		for _, listener := range listeners {
-			go listener(data)
-		}
+	for _, en := range e.listeners[event] {
+		listener := en.listener
+		en.sub.dispatch(func() { listener(data) })
+	}
+	for _, en := range e.any {
+		listener := en.listener
+		en.sub.dispatch(func() { listener(event, data) })
 	}
 }
@@ -0,0 +1,65 @@
+package events
+
+import (
+	"testing"
+	"time"
+)
+
+func TestListenerSeesEventsInOrder(t *testing.T) {
+	e := NewEventEmitter()
+	const n = 1000
+	got := make(chan int, n)
+	e.On("progress", func(data interface{}) { got <- data.(int) })
+
+	// A blocked listener must not hold up the others
+	block := make(chan struct{})
+	defer close(block)
+	e.On("progress", func(interface{}) { <-block })
+
+	for i := 0; i < n; i++ {
+		e.Emit("progress", i)
+	}
+	for i := 0; i < n; i++ {
+		select {
+		case v := <-got:
+			if v != i {
+				t.Fatalf("event %d delivered as number %d", v, i)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("only %d of %d events delivered", i, n)
+		}
+	}
+}
+
+func TestOnAnyReceivesEveryEvent(t *testing.T) {
+	e := NewEventEmitter()
+	type event struct {
+		name string
+		data interface{}
+	}
+	got := make(chan event, 8)
+	h := e.OnAny(func(name string, data interface{}) { got <- event{name, data} })
+
+	want := []event{{"device_discovered", "a"}, {"pair_request", 2}, {"sftp_offer", nil}}
+	for _, ev := range want {
+		e.Emit(ev.name, ev.data)
+	}
+	for _, w := range want {
+		select {
+		case ev := <-got:
+			if ev != w {
+				t.Fatalf("got %+v, want %+v", ev, w)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("no %s", w.name)
+		}
+	}
+
+	e.Off(h)
+	e.Emit("device_lost", "a")
+	select {
+	case ev := <-got:
+		t.Fatalf("removed listener got %+v", ev)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,72 @@
+// Package lang looks up the UI's strings in the user's language. Strings
+// live in embedded locales/<lang>.json files keyed by name; a string missing
+// from a translation falls back to English.
+package lang
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+//go:embed locales/*.json
+var locales embed.FS
+
+const fallbackLanguage = "en"
+
+var (
+	fallback = load(fallbackLanguage)
+	strs     = load(Detect())
+)
+
+func load(language string) map[string]string {
+	data, err := locales.ReadFile("locales/" + language + ".json")
+	if err != nil {
+		return nil
+	}
+	var m map[string]string
+	if err := json.Unmarshal(data, &m); err != nil {
+		fmt.Printf("lang: invalid %s translation: %v\n", language, err)
+		return nil
+	}
+	return m
+}
+
+// Detect returns the language the environment asks for, from $LC_ALL,
+// $LC_MESSAGES or $LANG in that order, e.g. "de" for de_DE.UTF-8. It is
+// English if none is set or the locale is C/POSIX.
+func Detect() string {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		locale := os.Getenv(name)
+		if locale == "" {
+			continue
+		}
+		language, _, _ := strings.Cut(locale, "_")
+		language, _, _ = strings.Cut(language, ".")
+		language = strings.ToLower(language)
+		if language == "c" || language == "posix" {
+			break
+		}
+		return language
+	}
+	return fallbackLanguage
+}
+
+// T returns the string for key in the current language, or key itself if no
+// language has it.
+func T(key string) string {
+	if s, ok := strs[key]; ok {
+		return s
+	}
+	if s, ok := fallback[key]; ok {
+		return s
+	}
+	return key
+}
+
+// Tf formats the string for key with args, as fmt.Sprintf.
+func Tf(key string, args ...interface{}) string {
+	return fmt.Sprintf(T(key), args...)
+}
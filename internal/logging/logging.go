@@ -0,0 +1,17 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+)
+
+// DebugEnabled turns on verbose, potentially sensitive output. It is set by
+// the KDECONNECT_FYNE_DEBUG environment variable.
+var DebugEnabled = os.Getenv("KDECONNECT_FYNE_DEBUG") != ""
+
+// Debugf prints like fmt.Printf when debug logging is enabled.
+func Debugf(format string, args ...interface{}) {
+	if DebugEnabled {
+		fmt.Printf(format, args...)
+	}
+}
@@ -8,9 +8,11 @@ import (
 )
 
 type BluetoothLinkProvider struct {
-	Identity  protocol.IdentityBody
-	Cert      *tls.Certificate
-	OnConnect func(conn *Connection)
+	Identity protocol.IdentityBody
+	Cert     *tls.Certificate
+	// IdentityFor, if set, picks the identity sent to a given remote device
+	IdentityFor func(remoteDeviceId string) protocol.IdentityBody
+	OnConnect   func(conn *Connection)
 }
 
 func NewBluetoothLinkProvider(id protocol.IdentityBody, cert *tls.Certificate) *BluetoothLinkProvider {
@@ -19,18 +19,13 @@ static void inline_set_callbacks() {
 import "C"
 
 import (
-	"bufio"
-	"crypto/tls"
-	"crypto/x509"
-	"encoding/json"
 	"fmt"
 	"io"
 	"net"
+	"os"
 	"sync"
 	"time"
 	"unsafe"
-
-	"github.com/barishamil/kde-connect-fyne/internal/protocol"
 )
 
 var (
@@ -39,16 +34,119 @@ var (
 )
 
 type btConn struct {
-	id     int
-	readRd *io.PipeReader
-	readWr *io.PipeWriter
+	id        int
+	data      chan []byte
+	pending   []byte
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	mu            sync.Mutex
+	readDeadline  time.Time
+	writeDeadline time.Time
+	// deadlineSet is closed and replaced whenever the read deadline changes
+	// so a blocked Read picks up the new value.
+	deadlineSet chan struct{}
+}
+
+func newBtConn(id int) *btConn {
+	return &btConn{
+		id:          id,
+		data:        make(chan []byte, 16),
+		closed:      make(chan struct{}),
+		deadlineSet: make(chan struct{}),
+	}
+}
+
+// deadlineTimer returns a channel that fires at deadline, or nil for no
+// deadline. The returned stop func must be called when done.
+func deadlineTimer(deadline time.Time) (<-chan time.Time, func() bool, error) {
+	if deadline.IsZero() {
+		return nil, func() bool { return false }, nil
+	}
+	d := time.Until(deadline)
+	if d <= 0 {
+		return nil, nil, os.ErrDeadlineExceeded
+	}
+	timer := time.NewTimer(d)
+	return timer.C, timer.Stop, nil
 }
 
 func (c *btConn) Read(b []byte) (n int, err error) {
-	return c.readRd.Read(b)
+	for len(c.pending) == 0 {
+		c.mu.Lock()
+		deadline := c.readDeadline
+		deadlineSet := c.deadlineSet
+		c.mu.Unlock()
+
+		timeout, stop, err := deadlineTimer(deadline)
+		if err != nil {
+			return 0, err
+		}
+
+		select {
+		case chunk := <-c.data:
+			c.pending = chunk
+		case <-c.closed:
+			stop()
+			return 0, io.EOF
+		case <-timeout:
+			return 0, os.ErrDeadlineExceeded
+		case <-deadlineSet:
+			// Deadline moved; re-evaluate it
+		}
+		stop()
+	}
+	n = copy(b, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
 }
 
 func (c *btConn) Write(b []byte) (n int, err error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	select {
+	case <-c.closed:
+		return 0, net.ErrClosed
+	default:
+	}
+
+	c.mu.Lock()
+	deadline := c.writeDeadline
+	c.mu.Unlock()
+
+	if deadline.IsZero() {
+		return c.write(b)
+	}
+
+	timeout, stop, err := deadlineTimer(deadline)
+	if err != nil {
+		return 0, err
+	}
+	defer stop()
+
+	type result struct {
+		n   int
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		n, err := c.write(b)
+		done <- result{n, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.n, r.err
+	case <-timeout:
+		// The native write can't be interrupted and the stream is now in an
+		// unknown state, so give up on the channel entirely.
+		c.Close()
+		return 0, os.ErrDeadlineExceeded
+	}
+}
+
+func (c *btConn) write(b []byte) (int, error) {
 	res := C.writeToChannel(C.int(c.id), (*C.uint8_t)(unsafe.Pointer(&b[0])), C.int(len(b)))
 	if res != 0 {
 		return 0, io.EOF
@@ -57,25 +155,45 @@ func (c *btConn) Write(b []byte) (n int, err error) {
 }
 
 func (c *btConn) Close() error {
-	C.closeChannel(C.int(c.id))
-	return c.readWr.Close()
+	c.closeOnce.Do(func() {
+		C.closeChannel(C.int(c.id))
+		close(c.closed)
+
+		btConnsMu.Lock()
+		delete(btConns, c.id)
+		btConnsMu.Unlock()
+	})
+	return nil
 }
 
-func (c *btConn) LocalAddr() net.Addr                { return &net.TCPAddr{IP: net.IPv4zero, Port: 0} }
-func (c *btConn) RemoteAddr() net.Addr               { return &net.TCPAddr{IP: net.IPv4zero, Port: 0} }
-func (c *btConn) SetDeadline(t time.Time) error      { return nil }
-func (c *btConn) SetReadDeadline(t time.Time) error  { return nil }
-func (c *btConn) SetWriteDeadline(t time.Time) error { return nil }
+func (c *btConn) LocalAddr() net.Addr  { return &net.TCPAddr{IP: net.IPv4zero, Port: 0} }
+func (c *btConn) RemoteAddr() net.Addr { return &net.TCPAddr{IP: net.IPv4zero, Port: 0} }
+
+func (c *btConn) SetDeadline(t time.Time) error {
+	c.SetReadDeadline(t)
+	return c.SetWriteDeadline(t)
+}
+
+func (c *btConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.readDeadline = t
+	close(c.deadlineSet)
+	c.deadlineSet = make(chan struct{})
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *btConn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.writeDeadline = t
+	c.mu.Unlock()
+	return nil
+}
 
 //export goConnectionCallback
 func goConnectionCallback(channelID C.int) {
 	id := int(channelID)
-	rd, wr := io.Pipe()
-	conn := &btConn{
-		id:     id,
-		readRd: rd,
-		readWr: wr,
-	}
+	conn := newBtConn(id)
 
 	btConnsMu.Lock()
 	btConns[id] = conn
@@ -86,60 +204,18 @@ func goConnectionCallback(channelID C.int) {
 	if globalBluetoothProvider != nil && globalBluetoothProvider.OnConnect != nil {
 		go func() {
 			defer conn.Close()
-			reader := bufio.NewReader(conn)
 
-			// 1. Read their Identity (Plain)
-			line, err := reader.ReadBytes('\n')
+			nc, err := performHandshake(conn, globalBluetoothProvider.Cert, globalBluetoothProvider.Identity, globalBluetoothProvider.IdentityFor, RoleAcceptor)
 			if err != nil {
-				fmt.Printf("Go: Bluetooth failed to read identity: %v\n", err)
+				fmt.Printf("Go: Bluetooth handshake failed: %v\n", err)
 				return
 			}
+			nc.Transport = TransportBluetooth
 
-			var p protocol.Packet
-			var remoteIdentity protocol.IdentityBody
-			if err := json.Unmarshal(line, &p); err != nil {
-				fmt.Printf("Go: Bluetooth invalid identity packet: %v\n", err)
-				return
-			}
-			if err := json.Unmarshal(p.Body, &remoteIdentity); err != nil {
-				fmt.Printf("Go: Bluetooth invalid identity body: %v\n", err)
-				return
-			}
-
-			tlsConfig := &tls.Config{
-				Certificates:       []tls.Certificate{*globalBluetoothProvider.Cert},
-				ClientAuth:         tls.RequestClientCert,
-				InsecureSkipVerify: true,
-				MinVersion:         tls.VersionTLS12,
-				VerifyPeerCertificate: func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
-					return nil // Trust any client certificate
-				},
-			}
-
-			// Reverse TLS: If we are the bridge on macOS, we act as the server for the incoming RFCOMM channel
-			// But KDE Connect sometimes reverses these roles. Let's try to match the Server logic.
-			bufferedConn := &BufferedConn{conn, reader}
-			tlsConn := tls.Client(bufferedConn, tlsConfig)
-
-			err = tlsConn.Handshake()
-			if err != nil {
-				fmt.Printf("Go: Bluetooth TLS Handshake failed: %v\n", err)
-				return
-			}
-
-			// 2. Send our identity packet inside TLS
-			packetBody, _ := json.Marshal(globalBluetoothProvider.Identity)
-			idPacket := protocol.Packet{
-				Id:   time.Now().UnixMilli(),
-				Type: "kdeconnect.identity",
-				Body: packetBody,
-			}
-			idData, _ := json.Marshal(idPacket)
-			idData = append(idData, '\n')
-			tlsConn.Write(idData)
-
-			nc := NewConnection(tlsConn, remoteIdentity.DeviceId, remoteIdentity)
 			globalBluetoothProvider.OnConnect(nc)
+
+			// Block here like the LAN server so the channel stays open
+			nc.StartLoop()
 		}()
 	}
 }
@@ -153,7 +229,10 @@ func goDataCallback(channelID C.int, data *C.uint8_t, length C.int) {
 
 	if ok {
 		buf := C.GoBytes(unsafe.Pointer(data), length)
-		conn.readWr.Write(buf)
+		select {
+		case conn.data <- buf:
+		case <-conn.closed:
+		}
 	}
 }
 
@@ -1,37 +1,165 @@
 package network
 
 import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net"
+	"slices"
 	"sync"
 	"time"
 
 	"github.com/barishamil/kde-connect-fyne/internal/protocol"
 )
 
+// DefaultIdleTimeout is the IdleTimeout of new connections. It is off:
+// devices stay silent for hours and the protocol has no heartbeat to keep a
+// connection busy. TCP keepalives, which net enables by default, still tear
+// down half-open LAN connections; the engine's idle timeout setting turns it
+// on.
+const DefaultIdleTimeout time.Duration = 0
+
+// Outgoing packets wait in a queue of sendQueueSize for the connection's
+// writer. A device that takes longer than writeTimeout to accept a packet is
+// considered gone, and Close waits up to closeFlushTimeout for queued
+// packets to be written.
+const (
+	sendQueueSize     = 256
+	writeTimeout      = 30 * time.Second
+	closeFlushTimeout = 2 * time.Second
+)
+
+// maxPacketSize bounds a single incoming packet. Payloads such as files
+// travel on their own connections, so packets stay small.
+const maxPacketSize = 16 << 20
+
+var errPacketTooLarge = fmt.Errorf("packet larger than %d bytes", maxPacketSize)
+
+var (
+	// ErrSendQueueFull means the device has stopped reading and the packet
+	// was not queued.
+	ErrSendQueueFull = errors.New("send queue full, device is not reading")
+	ErrClosed        = errors.New("connection closed")
+)
+
+// Transport is how a connection reaches the device.
+type Transport int
+
+const (
+	TransportLAN Transport = iota
+	TransportBluetooth
+)
+
+func (t Transport) String() string {
+	if t == TransportBluetooth {
+		return "bluetooth"
+	}
+	return "lan"
+}
+
+func (t Transport) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
 type Connection struct {
 	Conn           net.Conn
 	DeviceId       string
 	RemoteIdentity protocol.IdentityBody
+	Transport      Transport
+	Since          time.Time // when the connection was established
 	OnPacket       func(p protocol.Packet)
 	OnDisconnect   func()
+	// Intercept, if set, sees every outgoing packet before it's marshaled and
+	// may replace its body or drop it (the send then succeeds without writing).
+	Intercept func(pType string, body interface{}) (interface{}, bool)
+	// OnSent is called after each packet is written.
+	OnSent func(pType string)
+	// IdleTimeout tears the connection down when no packet arrives for this
+	// long. Zero disables it.
+	IdleTimeout time.Duration
+
+	mu         sync.Mutex
+	queue      []queuedPacket
+	ready      chan struct{} // signalled when a packet is queued
+	done       chan struct{} // closed by Close
+	writerDone chan struct{}
+	closeOnce  sync.Once
+}
 
-	mu sync.Mutex
+type queuedPacket struct {
+	pType     string
+	data      *bytes.Buffer
+	droppable bool
 }
 
 func NewConnection(conn net.Conn, deviceId string, remoteIdentity protocol.IdentityBody) *Connection {
-	return &Connection{
+	c := &Connection{
 		Conn:           conn,
 		DeviceId:       deviceId,
 		RemoteIdentity: remoteIdentity,
+		Since:          time.Now(),
+		IdleTimeout:    DefaultIdleTimeout,
+		ready:          make(chan struct{}, 1),
+		done:           make(chan struct{}),
+		writerDone:     make(chan struct{}),
+	}
+	go c.writeLoop()
+	return c
+}
+
+// PeerCertificate returns the certificate the remote presented during the TLS
+// handshake, or nil if there is none (e.g. a non-TLS connection).
+func (c *Connection) PeerCertificate() *x509.Certificate {
+	tlsConn, ok := c.Conn.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+	peerCerts := tlsConn.ConnectionState().PeerCertificates
+	if len(peerCerts) == 0 {
+		return nil
+	}
+	return peerCerts[0]
+}
+
+// packetReader fails reads once more than remaining bytes have been read,
+// so a peer can't make the decoder buffer an endless packet.
+type packetReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (r *packetReader) Read(b []byte) (int, error) {
+	if r.remaining <= 0 {
+		return 0, errPacketTooLarge
+	}
+	if int64(len(b)) > r.remaining {
+		b = b[:r.remaining]
 	}
+	n, err := r.r.Read(b)
+	r.remaining -= int64(n)
+	return n, err
 }
 
 func (c *Connection) StartLoop() {
-	decoder := json.NewDecoder(c.Conn)
+	reader := &packetReader{r: c.Conn, remaining: maxPacketSize}
+	decoder := json.NewDecoder(reader)
 	for {
+		if c.IdleTimeout > 0 {
+			c.Conn.SetReadDeadline(time.Now().Add(c.IdleTimeout))
+		}
+		// The decoder may already hold the start of this packet, so one can
+		// run up to twice the limit
+		reader.remaining = maxPacketSize
 		var p protocol.Packet
 		if err := decoder.Decode(&p); err != nil {
+			if errors.Is(err, errPacketTooLarge) {
+				fmt.Printf("Dropping connection to %s: %v\n", c.DeviceId, err)
+			}
+			c.Close()
 			if c.OnDisconnect != nil {
 				c.OnDisconnect()
 			}
@@ -43,31 +171,158 @@ func (c *Connection) StartLoop() {
 	}
 }
 
+// outgoingPacket is protocol.Packet with the body not yet marshaled, so a
+// packet is encoded in one pass. The fields must match protocol.Packet.
+type outgoingPacket struct {
+	Id                  int64                         `json:"id"`
+	Type                string                        `json:"type"`
+	Body                interface{}                   `json:"body"`
+	PayloadSize         int64                         `json:"payloadSize,omitempty"`
+	PayloadTransferInfo *protocol.PayloadTransferInfo `json:"payloadTransferInfo,omitempty"`
+}
+
+var sendBuffers = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+
+// SendPacket queues a packet for the connection's writer. It only fails if
+// the packet can't be encoded or queued; a failed write closes the connection.
 func (c *Connection) SendPacket(pType string, body interface{}) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	return c.send(pType, body, false, nil)
+}
 
-	bodyJSON, err := json.Marshal(body)
-	if err != nil {
-		return err
+// SendDroppable queues a packet that later ones make obsolete, such as
+// pointer movement. When the queue is full the oldest such packet is dropped
+// to make room rather than failing.
+func (c *Connection) SendDroppable(pType string, body interface{}) error {
+	return c.send(pType, body, true, nil)
+}
+
+// SendPacketWithPayload sends a packet announcing a payload of payloadSize
+// bytes that the remote can fetch from port.
+func (c *Connection) SendPacketWithPayload(pType string, body interface{}, payloadSize int64, port int) error {
+	return c.send(pType, body, false, func(p *outgoingPacket) {
+		p.PayloadSize = payloadSize
+		p.PayloadTransferInfo = &protocol.PayloadTransferInfo{Port: port}
+	})
+}
+
+func (c *Connection) send(pType string, body interface{}, droppable bool, decorate func(*outgoingPacket)) error {
+	if c.Intercept != nil {
+		var drop bool
+		if body, drop = c.Intercept(pType, body); drop {
+			return nil
+		}
 	}
 
-	packet := protocol.Packet{
+	packet := outgoingPacket{
 		Id:   time.Now().UnixMilli(),
 		Type: pType,
-		Body: bodyJSON,
+		Body: body,
+	}
+	if decorate != nil {
+		decorate(&packet)
 	}
 
-	data, err := json.Marshal(packet)
-	if err != nil {
+	buf := sendBuffers.Get().(*bytes.Buffer)
+	buf.Reset()
+	// Encode adds the newline that ends a packet
+	if err := json.NewEncoder(buf).Encode(packet); err != nil {
+		sendBuffers.Put(buf)
 		return err
 	}
-	data = append(data, '\n')
+	return c.enqueue(queuedPacket{pType: pType, data: buf, droppable: droppable})
+}
+
+func (c *Connection) enqueue(p queuedPacket) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	select {
+	case <-c.done:
+		sendBuffers.Put(p.data)
+		return ErrClosed
+	default:
+	}
 
-	_, err = c.Conn.Write(data)
-	return err
+	if len(c.queue) >= sendQueueSize {
+		i := -1
+		if p.droppable {
+			i = slices.IndexFunc(c.queue, func(q queuedPacket) bool { return q.droppable })
+		}
+		if i < 0 {
+			sendBuffers.Put(p.data)
+			return fmt.Errorf("%s: %w", p.pType, ErrSendQueueFull)
+		}
+		sendBuffers.Put(c.queue[i].data)
+		c.queue = slices.Delete(c.queue, i, i+1)
+	}
+	c.queue = append(c.queue, p)
+
+	select {
+	case c.ready <- struct{}{}:
+	default:
+	}
+	return nil
 }
 
+// writeLoop writes queued packets in order until the connection is closed,
+// then flushes what is left.
+func (c *Connection) writeLoop() {
+	defer close(c.writerDone)
+	for {
+		select {
+		case <-c.ready:
+			if !c.flush() {
+				c.stop()
+				c.Conn.Close()
+				return
+			}
+		case <-c.done:
+			c.flush()
+			return
+		}
+	}
+}
+
+// flush writes everything queued, and reports false if a write failed.
+func (c *Connection) flush() bool {
+	for {
+		c.mu.Lock()
+		if len(c.queue) == 0 {
+			c.mu.Unlock()
+			return true
+		}
+		p := c.queue[0]
+		c.queue[0] = queuedPacket{}
+		c.queue = c.queue[1:]
+		c.mu.Unlock()
+
+		c.Conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		_, err := c.Conn.Write(p.data.Bytes())
+		sendBuffers.Put(p.data)
+		if err != nil {
+			fmt.Printf("Write to %s failed: %v\n", c.DeviceId, err)
+			return false
+		}
+		if c.OnSent != nil {
+			c.OnSent(p.pType)
+		}
+	}
+}
+
+// stop makes further sends fail and tells the writer to finish.
+func (c *Connection) stop() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+}
+
+// Close stops the writer, giving it a moment to write packets already
+// queued (such as an unpair sent right before), and closes the connection.
 func (c *Connection) Close() error {
+	c.stop()
+	select {
+	case <-c.writerDone:
+	case <-time.After(closeFlushTimeout):
+	}
 	return c.Conn.Close()
 }
@@ -0,0 +1,53 @@
+package network
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/barishamil/kde-connect-fyne/internal/protocol"
+)
+
+func TestPacketTooLarge(t *testing.T) {
+	a, b := net.Pipe()
+	defer b.Close()
+	c := NewConnection(a, "phone", protocol.IdentityBody{DeviceId: "phone"})
+	packets := make(chan protocol.Packet, 4)
+	disconnected := make(chan struct{})
+	c.OnPacket = func(p protocol.Packet) { packets <- p }
+	c.OnDisconnect = func() { close(disconnected) }
+	go c.StartLoop()
+
+	go func() {
+		// One that fits, then one that never ends within the limit
+		b.Write([]byte(`{"id":1,"type":"kdeconnect.ping","body":{}}` + "\n"))
+		b.Write([]byte(`{"id":2,"type":"kdeconnect.ping","body":{"message":"`))
+		chunk := bytes.Repeat([]byte{'a'}, 64<<10)
+		for written := 0; written <= 2*maxPacketSize; written += len(chunk) {
+			if _, err := b.Write(chunk); err != nil {
+				return
+			}
+		}
+		b.Write([]byte(`"}}` + "\n"))
+	}()
+
+	select {
+	case p := <-packets:
+		if p.Id != 1 {
+			t.Fatalf("got packet %d first", p.Id)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("packet within the limit not delivered")
+	}
+	select {
+	case <-disconnected:
+	case <-time.After(10 * time.Second):
+		t.Fatal("connection kept reading an oversized packet")
+	}
+	select {
+	case p := <-packets:
+		t.Fatalf("oversized packet %d delivered", p.Id)
+	default:
+	}
+}
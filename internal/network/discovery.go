@@ -1,6 +1,7 @@
 package network
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -13,7 +14,11 @@ import (
 
 const UDP_PORT = 1716
 
-func StartDiscovery(id protocol.IdentityBody) error {
+// mdnsBrowseInterval is how long each mDNS browse runs before starting over,
+// so devices that come back are sent our identity again.
+const mdnsBrowseInterval = time.Minute
+
+func identityPacket(id protocol.IdentityBody) []byte {
 	packetBody, _ := json.Marshal(id)
 	packet := protocol.Packet{
 		Id:   time.Now().UnixMilli(),
@@ -22,43 +27,31 @@ func StartDiscovery(id protocol.IdentityBody) error {
 	}
 
 	data, _ := json.Marshal(packet)
-	data = append(data, '\n')
-
-	// 1. Start mDNS Responder
-	go func() {
-		// Service name should be the deviceId
-		server, err := zeroconf.Register(
-			id.DeviceId,
-			"_kdeconnect._udp",
-			"local.",
-			id.TcpPort,
-			[]string{
-				"id=" + id.DeviceId,
-				"name=" + id.DeviceName,
-				"type=" + id.DeviceType,
-				"protocol=" + fmt.Sprintf("%d", id.ProtocolVersion),
-			},
-			nil,
-		)
-		if err != nil {
-			log.Printf("mDNS Error: %v", err)
-			return
-		}
-		defer server.Shutdown()
+	return append(data, '\n')
+}
 
-		// Keep alive
-		select {}
-	}()
+// StartDiscovery announces id over UDP broadcast, and over mDNS if mdns is
+// set, on the interfaces allow accepts. auto reports whether those were left
+// to be picked automatically, in which case addresses in virtual ranges are
+// skipped too. Broadcast targets are worked out again on every round, so
+// interface and selection changes are picked up; the mDNS responder keeps the
+// interfaces it started with.
+func StartDiscovery(id protocol.IdentityBody, allow func(iface string) bool, auto func() bool, mdns bool) error {
+	data := identityPacket(id)
 
-	// 2. Start UDP Broadcast
-	broadcasts, err := getBroadcastAddresses()
-	if err != nil {
-		// Fallback to global broadcast if getting specific ones fails
-		broadcasts = []string{"255.255.255.255"}
+	// 1. Start mDNS Responder
+	if mdns {
+		go registerMDNS(id, allow)
 	}
 
+	// 2. Start UDP Broadcast
 	go func() {
 		for {
+			broadcasts, err := getBroadcastAddresses(allow, auto())
+			if err != nil {
+				// Fallback to global broadcast if getting specific ones fails
+				broadcasts = []string{"255.255.255.255"}
+			}
 			for _, ip := range broadcasts {
 				addr, err := net.ResolveUDPAddr("udp4", net.JoinHostPort(ip, fmt.Sprintf("%d", UDP_PORT)))
 				if err != nil {
@@ -79,62 +72,175 @@ func StartDiscovery(id protocol.IdentityBody) error {
 	return nil
 }
 
-func getBroadcastAddresses() ([]string, error) {
+// AnnounceToMDNSPeers browses mDNS for KDE Connect devices and sends each
+// one id over UDP, so it connects back over TCP. This finds devices when
+// another KDE Connect on this machine holds the discovery port and their
+// broadcasts can't be received.
+func AnnounceToMDNSPeers(id protocol.IdentityBody, allow func(iface string) bool) {
+	data := identityPacket(id)
+	go func() {
+		for {
+			browseMDNS(id.DeviceId, allow, data)
+		}
+	}()
+}
+
+func browseMDNS(self string, allow func(iface string) bool, data []byte) {
+	ctx, cancel := context.WithTimeout(context.Background(), mdnsBrowseInterval)
+	defer cancel()
+
+	resolver, err := zeroconf.NewResolver()
+	if err == nil {
+		entries := make(chan *zeroconf.ServiceEntry)
+		if err = resolver.Browse(ctx, "_kdeconnect._udp", "local.", entries); err == nil {
+			for entry := range entries {
+				if entry.Instance != self {
+					announceTo(entry, allow, data)
+				}
+			}
+			return
+		}
+	}
+	log.Printf("mDNS browse error: %v", err)
+	<-ctx.Done()
+}
+
+func announceTo(entry *zeroconf.ServiceEntry, allow func(iface string) bool, data []byte) {
+	for _, ip := range entry.AddrIPv4 {
+		if !allow(interfaceFor(ip)) {
+			continue
+		}
+		conn, err := net.DialUDP("udp4", nil, &net.UDPAddr{IP: ip, Port: entry.Port})
+		if err != nil {
+			continue
+		}
+		_, _ = conn.Write(data)
+		conn.Close()
+	}
+}
+
+func registerMDNS(id protocol.IdentityBody, allow func(iface string) bool) {
+	var mdnsIfaces []net.Interface
+	if ifaces, err := net.Interfaces(); err == nil {
+		for _, iface := range ifaces {
+			if allow(iface.Name) {
+				mdnsIfaces = append(mdnsIfaces, iface)
+			}
+		}
+	}
+
+	// Service name should be the deviceId
+	server, err := zeroconf.Register(
+		id.DeviceId,
+		"_kdeconnect._udp",
+		"local.",
+		id.TcpPort,
+		[]string{
+			"id=" + id.DeviceId,
+			"name=" + id.DeviceName,
+			"type=" + id.DeviceType,
+			"protocol=" + fmt.Sprintf("%d", id.ProtocolVersion),
+		},
+		mdnsIfaces,
+	)
+	if err != nil {
+		log.Printf("mDNS Error: %v", err)
+		return
+	}
+	defer server.Shutdown()
+
+	// Keep alive
+	select {}
+}
+
+func getBroadcastAddresses(allow func(iface string) bool, auto bool) ([]string, error) {
 	var broadcasts []string
 	ifaces, err := net.Interfaces()
 	if err != nil {
 		return nil, err
 	}
 
+	skipped := false
 	for _, iface := range ifaces {
 		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagBroadcast == 0 {
 			continue
 		}
+		if !allow(iface.Name) {
+			skipped = true
+			continue
+		}
 		addrs, err := iface.Addrs()
 		if err != nil {
 			continue
 		}
 		for _, addr := range addrs {
-			ipnet, ok := addr.(*net.IPNet)
-			if !ok || ipnet.IP.To4() == nil {
-				continue
-			}
-			ip := ipnet.IP.To4()
-			mask := ipnet.Mask
-			broadcast := make(net.IP, len(ip))
-			for i := 0; i < len(ip); i++ {
-				broadcast[i] = ip[i] | ^mask[i]
+			if ipnet, ok := addr.(*net.IPNet); ok {
+				if broadcast := broadcastAddress(ipnet, auto); broadcast != nil {
+					broadcasts = append(broadcasts, broadcast.String())
+				}
 			}
-			broadcasts = append(broadcasts, broadcast.String())
 		}
 	}
-	// Also include the global broadcast
-	broadcasts = append(broadcasts, "255.255.255.255")
+	// Also include the global broadcast, unless that could reach an
+	// interface that isn't allowed
+	if !skipped {
+		broadcasts = append(broadcasts, "255.255.255.255")
+	}
 	return broadcasts, nil
 }
 
-func ListenDiscovery(handler func(protocol.Packet, *net.UDPAddr)) {
+// broadcastAddress returns the IPv4 broadcast address of ipnet, or nil if it
+// isn't IPv4 or, when interfaces are picked automatically, is in a virtual
+// range. An interface the user chose is used whatever its addresses.
+func broadcastAddress(ipnet *net.IPNet, auto bool) net.IP {
+	ip := ipnet.IP.To4()
+	if ip == nil || auto && isVirtualAddress(ip) {
+		return nil
+	}
+	mask := ipnet.Mask
+	if len(mask) == net.IPv6len {
+		mask = mask[12:]
+	}
+	broadcast := make(net.IP, len(ip))
+	for i := 0; i < len(ip); i++ {
+		broadcast[i] = ip[i] | ^mask[i]
+	}
+	return broadcast
+}
+
+// ListenDiscovery binds the discovery port and passes received packets to
+// handler in the background. Packets are dropped unless they come from the
+// subnet of an interface allow accepts; the socket itself has to stay bound
+// to all interfaces to receive broadcasts.
+func ListenDiscovery(allow func(iface string) bool, handler func(protocol.Packet, *net.UDPAddr)) error {
 	addr, err := net.ResolveUDPAddr("udp4", fmt.Sprintf(":%d", UDP_PORT))
 	if err != nil {
-		return
+		return err
 	}
 
 	conn, err := net.ListenUDP("udp4", addr)
 	if err != nil {
-		return
+		return err
 	}
-	defer conn.Close()
 
-	buf := make([]byte, 2048)
-	for {
-		n, remoteAddr, err := conn.ReadFromUDP(buf)
-		if err != nil {
-			continue
-		}
+	go func() {
+		defer conn.Close()
+
+		buf := make([]byte, 2048)
+		for {
+			n, remoteAddr, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				continue
+			}
+			if !allow(interfaceFor(remoteAddr.IP)) {
+				continue
+			}
 
-		var p protocol.Packet
-		if err := json.Unmarshal(buf[:n], &p); err == nil {
-			handler(p, remoteAddr)
+			var p protocol.Packet
+			if err := json.Unmarshal(buf[:n], &p); err == nil {
+				handler(p, remoteAddr)
+			}
 		}
-	}
+	}()
+	return nil
 }
@@ -0,0 +1,34 @@
+package network
+
+import (
+	"net"
+	"testing"
+)
+
+func TestBroadcastAddress(t *testing.T) {
+	tests := []struct {
+		cidr string
+		auto bool
+		want string
+	}{
+		{"192.168.1.20/24", true, "192.168.1.255"},
+		{"10.1.2.3/8", false, "10.255.255.255"},
+		// Docker's bridge and link-local are skipped only when automatic
+		{"172.17.0.1/16", true, ""},
+		{"172.17.0.1/16", false, "172.17.255.255"},
+		{"169.254.10.2/16", true, ""},
+		{"169.254.10.2/16", false, "169.254.255.255"},
+		{"fe80::1/64", false, ""},
+	}
+	for _, tt := range tests {
+		ip, ipnet, err := net.ParseCIDR(tt.cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ipnet.IP = ip
+		got := broadcastAddress(ipnet, tt.auto)
+		if (got == nil && tt.want != "") || (got != nil && got.String() != tt.want) {
+			t.Errorf("broadcastAddress(%s, auto %v) = %v, want %q", tt.cidr, tt.auto, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package network
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/barishamil/kde-connect-fyne/internal/protocol"
+)
+
+func FuzzReadIdentity(f *testing.F) {
+	for _, seed := range []string{
+		`{"id":1,"type":"kdeconnect.identity","body":{"deviceId":"phone","deviceName":"Phone","deviceType":"phone","protocolVersion":8,"tcpPort":1716}}` + "\n",
+		`{"id":1,"type":"kdeconnect.identity","body":{"deviceId":"phone"}}` + "\n" + `{"id":2}`,
+		`{"id":1,"type":"kdeconnect.identity","body":{"deviceId":"","tcpPort":99999}}` + "\n",
+		`{"id":1,"type":"kdeconnect.identity","body":"phone"}` + "\n",
+		"\n",
+		`{"id":1`,
+	} {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		r := bytes.NewReader(data)
+		identity, err := readIdentity(r)
+		if err != nil {
+			return
+		}
+		if err := identity.Validate(); err != nil {
+			t.Fatalf("invalid identity returned: %v", err)
+		}
+		// Nothing past the identity line is consumed
+		line := bytes.IndexByte(data, '\n')
+		if line < 0 || r.Len() != len(data)-line-1 {
+			t.Fatalf("read %d bytes of %q", len(data)-r.Len(), data)
+		}
+	})
+}
+
+// readerConn is a net.Conn that reads from r and discards what is written.
+type readerConn struct {
+	r io.Reader
+}
+
+func (c readerConn) Read(b []byte) (int, error)       { return c.r.Read(b) }
+func (c readerConn) Write(b []byte) (int, error)      { return len(b), nil }
+func (c readerConn) Close() error                     { return nil }
+func (c readerConn) LocalAddr() net.Addr              { return &net.TCPAddr{} }
+func (c readerConn) RemoteAddr() net.Addr             { return &net.TCPAddr{} }
+func (c readerConn) SetDeadline(time.Time) error      { return nil }
+func (c readerConn) SetReadDeadline(time.Time) error  { return nil }
+func (c readerConn) SetWriteDeadline(time.Time) error { return nil }
+
+func FuzzStartLoop(f *testing.F) {
+	for _, seed := range []string{
+		`{"id":1,"type":"kdeconnect.ping","body":{}}` + "\n",
+		`{"id":1,"type":"kdeconnect.ping","body":{}}{"id":2,"type":"kdeconnect.ping","body":{"message":"hi"}}`,
+		`{"id":1,"type":"kdeconnect.share.request","body":{"filename":"a"},"payloadSize":10,"payloadTransferInfo":{"port":1739}}` + "\n" + `{"id":`,
+		`{"id":"1"}` + "\n",
+		" \n\t",
+		`[{"id":1}]`,
+	} {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		c := NewConnection(readerConn{bytes.NewReader(data)}, "phone", protocol.IdentityBody{DeviceId: "phone"})
+		var packets []protocol.Packet
+		disconnected := false
+		c.OnPacket = func(p protocol.Packet) { packets = append(packets, p) }
+		c.OnDisconnect = func() { disconnected = true }
+		// Returns once the data runs out
+		c.StartLoop()
+
+		if !disconnected {
+			t.Fatal("no disconnect at the end of the data")
+		}
+		// Whatever was delivered is a packet that encodes again
+		for _, p := range packets {
+			if _, err := json.Marshal(p); err != nil {
+				t.Fatalf("delivered packet %+v doesn't encode: %v", p, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,202 @@
+package network
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/barishamil/kde-connect-fyne/internal/protocol"
+)
+
+// HandshakeRole says which side opened the underlying connection.
+type HandshakeRole int
+
+const (
+	// RoleInitiator: we opened the connection. We send our plain identity
+	// first and, as KDE Connect uses reverse TLS, act as the TLS server.
+	RoleInitiator HandshakeRole = iota
+	// RoleAcceptor: the remote opened the connection. We read its plain
+	// identity first and act as the TLS client.
+	RoleAcceptor
+)
+
+// minTLSVersion is the oldest TLS version negotiated, TLS 1.2 while unset.
+var minTLSVersion atomic.Uint32
+
+// SetMinTLSVersion sets the oldest TLS version new connections accept. TLS
+// 1.3 is always offered; TLS 1.2 is only needed by older Android builds.
+// A handshake that fails is not retried at TLS 1.2: anyone on the path could
+// force that downgrade. The default minimum of TLS 1.2 already settles on 1.3
+// with every peer that supports it.
+func SetMinTLSVersion(version uint16) {
+	minTLSVersion.Store(uint32(version))
+}
+
+func MinTLSVersion() uint16 {
+	if v := uint16(minTLSVersion.Load()); v != 0 {
+		return v
+	}
+	return tls.VersionTLS12
+}
+
+// sessionCache lets reconnections to a device resume the TLS session instead
+// of running a full handshake.
+var sessionCache = tls.NewLRUClientSessionCache(64)
+
+// deviceSessionCache files sessions under the device instead of the address
+// tls keys them by, as devices connect to us from a new port every time.
+type deviceSessionCache string
+
+func (c deviceSessionCache) Get(string) (*tls.ClientSessionState, bool) {
+	return sessionCache.Get(string(c))
+}
+
+func (c deviceSessionCache) Put(_ string, cs *tls.ClientSessionState) {
+	sessionCache.Put(string(c), cs)
+}
+
+var (
+	sharedTLSMu      sync.Mutex
+	sharedTLSConfig  *tls.Config
+	sharedTLSCert    *tls.Certificate
+	sharedTLSVersion uint16
+)
+
+// newTLSConfig returns the config for connections using cert. It is shared,
+// so session tickets we issue as TLS server stay valid across connections,
+// and is only rebuilt when the certificate or minimum version changes.
+// Callers must Clone it before changing anything.
+func newTLSConfig(cert *tls.Certificate) *tls.Config {
+	sharedTLSMu.Lock()
+	defer sharedTLSMu.Unlock()
+
+	version := MinTLSVersion()
+	if sharedTLSConfig != nil && sharedTLSCert == cert && sharedTLSVersion == version {
+		return sharedTLSConfig
+	}
+	sharedTLSConfig = &tls.Config{
+		Certificates:       []tls.Certificate{*cert},
+		ClientAuth:         tls.RequireAnyClientCert, // Only used in the TLS server role
+		ClientSessionCache: sessionCache,
+		InsecureSkipVerify: true,
+		MinVersion:         version,
+		MaxVersion:         tls.VersionTLS13,
+		VerifyPeerCertificate: func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+			return nil // Trust any certificate (Self-signed)
+		},
+	}
+	sharedTLSCert = cert
+	sharedTLSVersion = version
+	return sharedTLSConfig
+}
+
+// performHandshake runs the plain identity exchange, the reverse TLS
+// handshake and the secure identity exchange over rawConn. When accepting,
+// identityFor (if non-nil) replaces myIdentity once the remote is known. The
+// caller owns rawConn and must close it on error.
+func performHandshake(rawConn net.Conn, cert *tls.Certificate, myIdentity protocol.IdentityBody, identityFor func(string) protocol.IdentityBody, role HandshakeRole) (*Connection, error) {
+	var remoteIdentity protocol.IdentityBody
+	var tlsConn *tls.Conn
+
+	switch role {
+	case RoleInitiator:
+		// 1. Send our Identity (Plain)
+		if err := sendIdentity(rawConn, myIdentity); err != nil {
+			return nil, fmt.Errorf("failed to send plain identity: %v", err)
+		}
+		// Server mode because Android acts as Client on connections it accepts
+		tlsConn = tls.Server(rawConn, newTLSConfig(cert))
+	case RoleAcceptor:
+		// 1. Read their Identity (Plain)
+		identity, err := readIdentity(rawConn)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read plain identity: %v", err)
+		}
+		remoteIdentity = identity
+		if identityFor != nil {
+			myIdentity = identityFor(remoteIdentity.DeviceId)
+		}
+		// Client mode because Android acts as Server on connections it opens
+		config := newTLSConfig(cert).Clone()
+		config.ClientSessionCache = deviceSessionCache(remoteIdentity.DeviceId)
+		tlsConn = tls.Client(rawConn, config)
+	default:
+		return nil, fmt.Errorf("unknown handshake role %d", role)
+	}
+
+	if err := tlsConn.Handshake(); err != nil {
+		return nil, fmt.Errorf("tls handshake failed: %v", err)
+	}
+
+	// 2. Send our Identity (Encrypted)
+	if err := sendIdentity(tlsConn, myIdentity); err != nil {
+		return nil, fmt.Errorf("failed to send encrypted identity: %v", err)
+	}
+
+	// 3. Read their Identity (Encrypted). Protocol v8 repeats it inside TLS;
+	// when initiating we haven't seen a plain identity, so it's always needed.
+	if role == RoleInitiator || remoteIdentity.ProtocolVersion >= 8 {
+		identity, err := readIdentity(tlsConn)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read secure identity: %v", err)
+		}
+		remoteIdentity = identity
+	}
+
+	return NewConnection(tlsConn, remoteIdentity.DeviceId, remoteIdentity), nil
+}
+
+func sendIdentity(conn net.Conn, identity protocol.IdentityBody) error {
+	packetBody, _ := json.Marshal(identity)
+	packet := protocol.Packet{
+		Id:   time.Now().UnixMilli(),
+		Type: "kdeconnect.identity",
+		Body: packetBody,
+	}
+	data, _ := json.Marshal(packet)
+	data = append(data, '\n')
+	_, err := conn.Write(data)
+	return err
+}
+
+// maxIdentitySize bounds the identity line, which is read before the peer is
+// authenticated.
+const maxIdentitySize = 64 << 10
+
+// readIdentity reads a single identity packet line. It reads byte by byte so
+// nothing after the newline is consumed from the connection.
+func readIdentity(r io.Reader) (protocol.IdentityBody, error) {
+	var line []byte
+	buf := make([]byte, 1)
+	for {
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return protocol.IdentityBody{}, err
+		}
+		if buf[0] == '\n' {
+			break
+		}
+		if len(line) >= maxIdentitySize {
+			return protocol.IdentityBody{}, fmt.Errorf("identity packet larger than %d bytes", maxIdentitySize)
+		}
+		line = append(line, buf[0])
+	}
+
+	var p protocol.Packet
+	if err := json.Unmarshal(line, &p); err != nil {
+		return protocol.IdentityBody{}, fmt.Errorf("invalid identity packet: %v", err)
+	}
+	var identity protocol.IdentityBody
+	if err := json.Unmarshal(p.Body, &identity); err != nil {
+		return protocol.IdentityBody{}, fmt.Errorf("invalid identity body: %v", err)
+	}
+	if err := identity.Validate(); err != nil {
+		return protocol.IdentityBody{}, fmt.Errorf("invalid identity: %v", err)
+	}
+	return identity, nil
+}
@@ -0,0 +1,162 @@
+package network
+
+import (
+	"crypto/tls"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/barishamil/kde-connect-fyne/internal/protocol"
+)
+
+func handshakeIdentity(id string) protocol.IdentityBody {
+	return protocol.IdentityBody{
+		DeviceId:        id,
+		DeviceName:      id,
+		DeviceType:      "phone",
+		ProtocolVersion: 8,
+		TcpPort:         1716,
+	}
+}
+
+// runPeer plays a device on raw that supports TLS versions min to max. role
+// is the device's own role: as RoleInitiator it opened the connection.
+func runPeer(raw net.Conn, cert *tls.Certificate, identity protocol.IdentityBody, role HandshakeRole, min, max uint16) error {
+	config := &tls.Config{
+		Certificates:       []tls.Certificate{*cert},
+		ClientAuth:         tls.RequireAnyClientCert,
+		InsecureSkipVerify: true,
+		MinVersion:         min,
+		MaxVersion:         max,
+	}
+	var conn *tls.Conn
+	if role == RoleInitiator {
+		if err := sendIdentity(raw, identity); err != nil {
+			return err
+		}
+		conn = tls.Server(raw, config)
+	} else {
+		if _, err := readIdentity(raw); err != nil {
+			return err
+		}
+		conn = tls.Client(raw, config)
+	}
+	if err := conn.Handshake(); err != nil {
+		return err
+	}
+	if err := sendIdentity(conn, identity); err != nil {
+		return err
+	}
+	_, err := readIdentity(conn)
+	return err
+}
+
+// tcpPair returns both ends of a loopback TCP connection.
+func tcpPair(t *testing.T) (net.Conn, net.Conn) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		c, _ := l.Accept()
+		accepted <- c
+	}()
+	a, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := <-accepted
+	if b == nil {
+		t.Fatal("accept failed")
+	}
+	t.Cleanup(func() {
+		a.Close()
+		b.Close()
+	})
+	return a, b
+}
+
+func TestHandshakeTLSVersions(t *testing.T) {
+	desktop := testCert(t, "desktop")
+	phone := testCert(t, "phone")
+	t.Cleanup(func() { SetMinTLSVersion(tls.VersionTLS12) })
+
+	tests := []struct {
+		name    string
+		min     uint16 // ours
+		peerMin uint16
+		peerMax uint16
+		want    uint16 // 0 if the handshake must fail
+	}{
+		{"1.3-only peer", tls.VersionTLS12, tls.VersionTLS13, tls.VersionTLS13, tls.VersionTLS13},
+		{"1.2-only peer", tls.VersionTLS12, tls.VersionTLS12, tls.VersionTLS12, tls.VersionTLS12},
+		{"1.3 required, 1.3-only peer", tls.VersionTLS13, tls.VersionTLS13, tls.VersionTLS13, tls.VersionTLS13},
+		// Not retried at 1.2
+		{"1.3 required, 1.2-only peer", tls.VersionTLS13, tls.VersionTLS12, tls.VersionTLS12, 0},
+	}
+	for _, tt := range tests {
+		// Reverse TLS swaps the TLS roles, so try both ends of the connection
+		for _, role := range []HandshakeRole{RoleInitiator, RoleAcceptor} {
+			name := tt.name + ", initiating"
+			peerRole := RoleAcceptor
+			if role == RoleAcceptor {
+				name = tt.name + ", accepting"
+				peerRole = RoleInitiator
+			}
+			t.Run(name, func(t *testing.T) {
+				SetMinTLSVersion(tt.min)
+				ours, theirs := tcpPair(t)
+				peerErr := make(chan error, 1)
+				go func() {
+					err := runPeer(theirs, phone, handshakeIdentity("phone"), peerRole, tt.peerMin, tt.peerMax)
+					if err != nil {
+						theirs.Close()
+					}
+					peerErr <- err
+				}()
+
+				c, err := performHandshake(ours, desktop, handshakeIdentity("desktop"), nil, role)
+				if tt.want == 0 {
+					if err == nil {
+						t.Fatal("handshake succeeded")
+					}
+					ours.Close()
+					<-peerErr
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := <-peerErr; err != nil {
+					t.Fatalf("peer: %v", err)
+				}
+				if c.DeviceId != "phone" {
+					t.Errorf("DeviceId = %q, want phone", c.DeviceId)
+				}
+				if v := c.Conn.(*tls.Conn).ConnectionState().Version; v != tt.want {
+					t.Errorf("negotiated %s, want %s", tls.VersionName(v), tls.VersionName(tt.want))
+				}
+			})
+		}
+	}
+}
+
+func TestReadIdentityTooLarge(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	go func() {
+		defer b.Close()
+		line := make([]byte, maxIdentitySize+1)
+		for i := range line {
+			line[i] = 'a'
+		}
+		b.Write(append(line, '\n'))
+	}()
+
+	if _, err := readIdentity(a); err == nil || !strings.Contains(err.Error(), "larger than") {
+		t.Fatalf("readIdentity = %v, want a size error", err)
+	}
+}
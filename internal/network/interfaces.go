@@ -0,0 +1,105 @@
+package network
+
+import (
+	"net"
+	"strings"
+)
+
+// InterfaceInfo describes a network interface discovery can run on.
+type InterfaceInfo struct {
+	Name  string
+	Addrs []string
+	// Virtual is set for container, VM and VPN interfaces, see
+	// IsVirtualInterface.
+	Virtual bool
+}
+
+// Name prefixes of interfaces created by Docker, VMs, VPNs and macOS
+// peer-to-peer links. Phones are practically never reachable through them.
+var virtualInterfacePrefixes = []string{
+	"docker", "veth", "br-", "virbr", "vboxnet", "vmnet", "bridge",
+	"utun", "tun", "tap", "wg", "tailscale", "zt", "awdl", "llw",
+}
+
+// IsVirtualInterface guesses from its name whether an interface belongs to a
+// container, VM or VPN rather than a real network.
+func IsVirtualInterface(name string) bool {
+	for _, prefix := range virtualInterfacePrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// virtualNetworks are address ranges never used by a LAN a phone is on:
+// link-local and Docker's default bridge.
+var virtualNetworks = []*net.IPNet{
+	mustParseCIDR("169.254.0.0/16"),
+	mustParseCIDR("172.17.0.0/16"),
+}
+
+func mustParseCIDR(s string) *net.IPNet {
+	_, ipnet, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return ipnet
+}
+
+func isVirtualAddress(ip net.IP) bool {
+	for _, ipnet := range virtualNetworks {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ListInterfaces returns the interfaces that are up, with their IPv4 and
+// IPv6 addresses, leaving out loopback.
+func ListInterfaces() []InterfaceInfo {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+
+	var list []InterfaceInfo
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		info := InterfaceInfo{Name: iface.Name, Virtual: IsVirtualInterface(iface.Name)}
+		addrs, _ := iface.Addrs()
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok {
+				info.Addrs = append(info.Addrs, ipnet.IP.String())
+			}
+		}
+		if len(info.Addrs) > 0 {
+			list = append(list, info)
+		}
+	}
+	return list
+}
+
+// interfaceFor returns the name of the interface whose subnet contains ip,
+// or "" if none does.
+func interfaceFor(ip net.IP) string {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return ""
+	}
+	for _, iface := range ifaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok && ipnet.Contains(ip) {
+				return iface.Name
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,142 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// KDE Connect payloads are fetched from a port in this range.
+const (
+	payloadPortMin = 1739
+	payloadPortMax = 1764
+)
+
+// How long to wait for the remote to come and fetch a payload.
+const payloadAcceptTimeout = 60 * time.Second
+
+// PayloadServer serves a single payload to the remote, which connects to
+// Port after receiving the packet announcing it.
+type PayloadServer struct {
+	Port     int
+	listener *net.TCPListener
+	config   *tls.Config
+}
+
+// ListenPayload opens a payload server. If peer is set, only a client
+// presenting that certificate, the device's on its main connection, is
+// served.
+func ListenPayload(cert *tls.Certificate, peer *x509.Certificate) (*PayloadServer, error) {
+	for port := payloadPortMin; port <= payloadPortMax; port++ {
+		l, err := net.ListenTCP("tcp", &net.TCPAddr{Port: port})
+		if err == nil {
+			return &PayloadServer{Port: port, listener: l, config: peerTLSConfig(cert, peer)}, nil
+		}
+	}
+	return nil, fmt.Errorf("no free payload port in %d-%d", payloadPortMin, payloadPortMax)
+}
+
+// Serve waits for the remote to connect and streams r to it over TLS.
+// onProgress receives the number of bytes sent so far. Cancelling ctx aborts
+// the wait or the transfer. The server can't be reused afterwards.
+func (s *PayloadServer) Serve(ctx context.Context, r io.Reader, onProgress func(sent int64)) error {
+	defer s.listener.Close()
+	stop := context.AfterFunc(ctx, func() { s.listener.Close() })
+	defer stop()
+
+	s.listener.SetDeadline(time.Now().Add(payloadAcceptTimeout))
+	rawConn, err := s.listener.Accept()
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("device did not fetch the payload: %v", err)
+	}
+	defer rawConn.Close()
+	stopConn := context.AfterFunc(ctx, func() { rawConn.Close() })
+	defer stopConn()
+
+	// The remote connects as the TLS client, like on the main link
+	tlsConn := tls.Server(rawConn, s.config)
+	if err := tlsConn.Handshake(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("tls handshake failed: %v", err)
+	}
+
+	_, err = io.Copy(&countingWriter{writer: tlsConn, onProgress: onProgress}, r)
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+func (s *PayloadServer) Close() error {
+	return s.listener.Close()
+}
+
+// ReceivePayload fetches a payload of size bytes the device at host offers
+// on port and writes it to w. If peer is set, the device must present that
+// certificate, as on its main connection.
+func ReceivePayload(ctx context.Context, host string, port int, cert *tls.Certificate, peer *x509.Certificate, size int64, w io.Writer) error {
+	// We're the TLS client here, the reverse of the main link's roles
+	dialer := &tls.Dialer{NetDialer: &net.Dialer{Timeout: 10 * time.Second}, Config: peerTLSConfig(cert, peer)}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	n, err := io.Copy(w, io.LimitReader(conn, size))
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err == nil && n < size {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// peerTLSConfig is the TLS config for a payload connection to the device
+// whose certificate is peer. With a nil peer any certificate is accepted.
+func peerTLSConfig(cert *tls.Certificate, peer *x509.Certificate) *tls.Config {
+	config := newTLSConfig(cert)
+	if peer == nil {
+		return config
+	}
+	// VerifyConnection, unlike VerifyPeerCertificate, also runs when a
+	// session is resumed
+	config = config.Clone()
+	config.VerifyConnection = func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 || !bytes.Equal(cs.PeerCertificates[0].Raw, peer.Raw) {
+			return errors.New("payload connection with a different certificate than the device's")
+		}
+		return nil
+	}
+	return config
+}
+
+type countingWriter struct {
+	writer     io.Writer
+	written    int64
+	onProgress func(int64)
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.writer.Write(p)
+	cw.written += int64(n)
+	if cw.onProgress != nil {
+		cw.onProgress(cw.written)
+	}
+	return n, err
+}
@@ -0,0 +1,82 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// testCert returns a self-signed certificate like the ones devices use.
+func testCert(t *testing.T, name string) *tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name, Organization: []string{"KDE"}, OrganizationalUnit: []string{"Kde connect"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func TestPayloadServedOnlyToDevice(t *testing.T) {
+	desktop := testCert(t, "desktop")
+	phone := testCert(t, "phone")
+	intruder := testCert(t, "intruder")
+	payload := []byte("hello from the desktop")
+
+	for _, tt := range []struct {
+		name   string
+		client *tls.Certificate
+		ok     bool
+	}{
+		{"device", phone, true},
+		{"other certificate", intruder, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, err := ListenPayload(desktop, phone.Leaf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			served := make(chan error, 1)
+			go func() {
+				served <- srv.Serve(ctx, bytes.NewReader(payload), nil)
+			}()
+
+			var got bytes.Buffer
+			err = ReceivePayload(ctx, "127.0.0.1", srv.Port, tt.client, desktop.Leaf, int64(len(payload)), &got)
+			serveErr := <-served
+			if tt.ok {
+				if err != nil || serveErr != nil {
+					t.Fatalf("transfer failed: receive %v, serve %v", err, serveErr)
+				}
+				if !bytes.Equal(got.Bytes(), payload) {
+					t.Fatalf("received %q, want %q", got.Bytes(), payload)
+				}
+			} else if serveErr == nil {
+				t.Fatal("payload served to a client with another certificate")
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package network
+
+import (
+	"net"
+
+	"github.com/barishamil/kde-connect-fyne/internal/protocol"
+)
+
+// PipeConnection returns both ends of an in-memory connection between the
+// devices local and remote, with no sockets or TLS involved. The first is
+// local's connection to remote, the second remote's connection to local. A
+// packet sent on one end reaches the other end's OnPacket once StartLoop runs
+// there.
+//
+// It stands in for a real connection in tests of packet handling: hand the
+// first end to the code under test, run StartLoop on the second end with an
+// OnPacket that records what arrives, and send packets from it as the device
+// would:
+//
+//	conn, device := network.PipeConnection(engine.Identity, phone)
+//	device.OnPacket = func(p protocol.Packet) { received <- p }
+//	go device.StartLoop()
+//	device.SendPacket("kdeconnect.ping", protocol.PingBody{})
+//
+// The ends have no peer certificate, so anything that verifies one sees an
+// unauthenticated device, and their addresses are not TCP addresses.
+func PipeConnection(local, remote protocol.IdentityBody) (*Connection, *Connection) {
+	a, b := net.Pipe()
+	return NewConnection(a, remote.DeviceId, remote), NewConnection(b, local.DeviceId, local)
+}
@@ -0,0 +1,99 @@
+package network
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/barishamil/kde-connect-fyne/internal/protocol"
+)
+
+// listen runs c's read loop, returning the packets it receives and a channel
+// closed once it disconnects.
+func listen(c *Connection) (chan protocol.Packet, chan struct{}) {
+	packets := make(chan protocol.Packet, 16)
+	disconnected := make(chan struct{})
+	c.OnPacket = func(p protocol.Packet) { packets <- p }
+	c.OnDisconnect = func() { close(disconnected) }
+	go c.StartLoop()
+	return packets, disconnected
+}
+
+func receive(t *testing.T, packets chan protocol.Packet) protocol.Packet {
+	t.Helper()
+	select {
+	case p := <-packets:
+		return p
+	case <-time.After(2 * time.Second):
+		t.Fatal("no packet received")
+		return protocol.Packet{}
+	}
+}
+
+func TestPipeConnectionRoundTrip(t *testing.T) {
+	desktop := protocol.IdentityBody{DeviceId: "desktop"}
+	phone := protocol.IdentityBody{DeviceId: "phone"}
+	local, remote := PipeConnection(desktop, phone)
+	defer local.Close()
+	defer remote.Close()
+
+	if local.DeviceId != "phone" || remote.DeviceId != "desktop" {
+		t.Fatalf("ends connect %s and %s, want phone and desktop", local.DeviceId, remote.DeviceId)
+	}
+	if local.PeerCertificate() != nil {
+		t.Fatal("pipe end has a peer certificate")
+	}
+	localPackets, _ := listen(local)
+	remotePackets, _ := listen(remote)
+
+	for i, msg := range []string{"one", "two", "three"} {
+		if err := local.SendPacket("kdeconnect.ping", protocol.PingBody{Message: msg}); err != nil {
+			t.Fatal(err)
+		}
+		p := receive(t, remotePackets)
+		var body protocol.PingBody
+		if err := json.Unmarshal(p.Body, &body); err != nil {
+			t.Fatal(err)
+		}
+		if p.Type != "kdeconnect.ping" || body.Message != msg {
+			t.Fatalf("packet %d = %s %+v, want ping %q", i, p.Type, body, msg)
+		}
+	}
+
+	if err := remote.SendPacket("kdeconnect.ping", protocol.PingBody{Message: "back"}); err != nil {
+		t.Fatal(err)
+	}
+	if p := receive(t, localPackets); p.Type != "kdeconnect.ping" {
+		t.Fatalf("got %s, want ping", p.Type)
+	}
+}
+
+func TestPipeConnectionClose(t *testing.T) {
+	local, remote := PipeConnection(protocol.IdentityBody{DeviceId: "desktop"}, protocol.IdentityBody{DeviceId: "phone"})
+	_, localDisconnected := listen(local)
+	remotePackets, remoteDisconnected := listen(remote)
+
+	// A packet queued right before closing is still written
+	if err := local.SendPacket("kdeconnect.pair", protocol.PairBody{Pair: false}); err != nil {
+		t.Fatal(err)
+	}
+	local.Close()
+	if p := receive(t, remotePackets); p.Type != "kdeconnect.pair" {
+		t.Fatalf("got %s, want the pair packet", p.Type)
+	}
+
+	for name, ch := range map[string]chan struct{}{"closed": localDisconnected, "remote": remoteDisconnected} {
+		select {
+		case <-ch:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%s end did not disconnect", name)
+		}
+	}
+	if err := local.SendPacket("kdeconnect.ping", protocol.PingBody{}); !errors.Is(err, ErrClosed) {
+		t.Fatalf("send after close = %v, want ErrClosed", err)
+	}
+	if err := remote.SendPacket("kdeconnect.ping", protocol.PingBody{}); !errors.Is(err, ErrClosed) {
+		t.Fatalf("send to a closed end = %v, want ErrClosed", err)
+	}
+}
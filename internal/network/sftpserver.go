@@ -0,0 +1,315 @@
+package network
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// KDE Connect serves SFTP on a port in this range.
+const (
+	sftpPortMin = 1739
+	sftpPortMax = 1764
+)
+
+// SharedFolder is a local folder served as /Name.
+type SharedFolder struct {
+	Name string
+	Path string
+}
+
+// SFTPServer lets a device browse local folders over SFTP, read-only. Each
+// server has its own host key and one-time credentials, and only accepts
+// connections from one address.
+type SFTPServer struct {
+	Port     int
+	User     string
+	Password string
+
+	folders  []SharedFolder
+	remoteIP net.IP
+	config   *ssh.ServerConfig
+	listener net.Listener
+
+	mu    sync.Mutex
+	conns map[*ssh.ServerConn]struct{}
+}
+
+func NewSFTPServer(folders []SharedFolder, remoteIP net.IP) (*SFTPServer, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &SFTPServer{
+		User:     "kdeconnect",
+		Password: randomHex(16),
+		folders:  folders,
+		remoteIP: remoteIP,
+		conns:    make(map[*ssh.ServerConn]struct{}),
+	}
+	s.config = &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			userOK := subtle.ConstantTimeCompare([]byte(c.User()), []byte(s.User)) == 1
+			passwordOK := subtle.ConstantTimeCompare(password, []byte(s.Password)) == 1
+			if userOK && passwordOK {
+				return nil, nil
+			}
+			return nil, errors.New("invalid credentials")
+		},
+	}
+	s.config.AddHostKey(signer)
+	return s, nil
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Start listens on the first free port of the KDE Connect SFTP range.
+func (s *SFTPServer) Start() error {
+	var err error
+	for port := sftpPortMin; port <= sftpPortMax; port++ {
+		s.listener, err = net.Listen("tcp", fmt.Sprintf(":%d", port))
+		if err == nil {
+			s.Port = port
+			go s.serve()
+			return nil
+		}
+	}
+	return fmt.Errorf("no free SFTP port: %w", err)
+}
+
+func (s *SFTPServer) Stop() {
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
+
+func (s *SFTPServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		if addr, ok := conn.RemoteAddr().(*net.TCPAddr); !ok || !addr.IP.Equal(s.remoteIP) {
+			fmt.Printf("SFTP server: rejecting connection from %s\n", conn.RemoteAddr())
+			conn.Close()
+			continue
+		}
+		go s.handleConn(conn)
+	}
+}
+
+func (s *SFTPServer) handleConn(nConn net.Conn) {
+	conn, chans, reqs, err := ssh.NewServerConn(nConn, s.config)
+	if err != nil {
+		fmt.Printf("SFTP server: handshake with %s failed: %v\n", nConn.RemoteAddr(), err)
+		nConn.Close()
+		return
+	}
+	s.mu.Lock()
+	s.conns[conn] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	go ssh.DiscardRequests(reqs)
+	for newChan := range chans {
+		if newChan.ChannelType() != "session" {
+			newChan.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		channel, requests, err := newChan.Accept()
+		if err != nil {
+			continue
+		}
+		go s.handleSession(channel, requests)
+	}
+}
+
+func (s *SFTPServer) handleSession(channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer channel.Close()
+
+	for req := range requests {
+		// Only the sftp subsystem is offered, no shell or exec
+		ok := req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp"
+		req.Reply(ok, nil)
+		if !ok {
+			continue
+		}
+
+		fs := &sharedFS{folders: s.folders}
+		server := sftp.NewRequestServer(channel, sftp.Handlers{
+			FileGet:  fs,
+			FilePut:  fs,
+			FileCmd:  fs,
+			FileList: fs,
+		})
+		if err := server.Serve(); err != nil && err != io.EOF {
+			fmt.Printf("SFTP server: %v\n", err)
+		}
+		server.Close()
+		return
+	}
+}
+
+// sharedFS serves shared folders read-only under a virtual root that lists
+// them by name. Request paths are cleaned as if rooted at "/", so ".." can't
+// climb out of a folder, and symlinks are only followed while they stay
+// inside the folder they are in.
+type sharedFS struct {
+	folders []SharedFolder
+}
+
+// resolve maps a request path to a local path, or "" for the virtual root.
+func (fs *sharedFS) resolve(name string) (string, error) {
+	clean := strings.TrimPrefix(path.Clean("/"+name), "/")
+	if clean == "" {
+		return "", nil
+	}
+
+	first, rest, _ := strings.Cut(clean, "/")
+	for _, folder := range fs.folders {
+		if folder.Name != first {
+			continue
+		}
+		root, err := filepath.EvalSymlinks(folder.Path)
+		if err != nil {
+			return "", err
+		}
+		real, err := filepath.EvalSymlinks(filepath.Join(root, filepath.FromSlash(rest)))
+		if err != nil {
+			return "", err
+		}
+		if real != root && !strings.HasPrefix(real, root+string(filepath.Separator)) {
+			return "", sftp.ErrSSHFxPermissionDenied
+		}
+		return real, nil
+	}
+	return "", os.ErrNotExist
+}
+
+func (fs *sharedFS) Fileread(r *sftp.Request) (io.ReaderAt, error) {
+	p, err := fs.resolve(r.Filepath)
+	if err != nil {
+		return nil, err
+	}
+	if p == "" {
+		return nil, sftp.ErrSSHFxPermissionDenied
+	}
+	return os.Open(p)
+}
+
+func (fs *sharedFS) Filewrite(r *sftp.Request) (io.WriterAt, error) {
+	return nil, sftp.ErrSSHFxPermissionDenied
+}
+
+func (fs *sharedFS) Filecmd(r *sftp.Request) error {
+	return sftp.ErrSSHFxPermissionDenied
+}
+
+func (fs *sharedFS) Filelist(r *sftp.Request) (sftp.ListerAt, error) {
+	p, err := fs.resolve(r.Filepath)
+	if err != nil {
+		return nil, err
+	}
+
+	switch r.Method {
+	case "List":
+		if p == "" {
+			return fs.listRoot(), nil
+		}
+		entries, err := os.ReadDir(p)
+		if err != nil {
+			return nil, err
+		}
+		infos := make([]os.FileInfo, 0, len(entries))
+		for _, entry := range entries {
+			if info, err := entry.Info(); err == nil {
+				infos = append(infos, info)
+			}
+		}
+		return listerAt(infos), nil
+	case "Stat":
+		if p == "" {
+			return listerAt{rootInfo{}}, nil
+		}
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		return listerAt{info}, nil
+	}
+	return nil, sftp.ErrSSHFxOpUnsupported
+}
+
+func (fs *sharedFS) listRoot() listerAt {
+	var infos listerAt
+	for _, folder := range fs.folders {
+		if info, err := os.Stat(folder.Path); err == nil && info.IsDir() {
+			infos = append(infos, namedInfo{info, folder.Name})
+		}
+	}
+	return infos
+}
+
+// namedInfo is a shared folder as listed in the virtual root.
+type namedInfo struct {
+	os.FileInfo
+	name string
+}
+
+func (i namedInfo) Name() string { return i.name }
+
+// rootInfo describes the virtual root.
+type rootInfo struct{}
+
+func (rootInfo) Name() string       { return "/" }
+func (rootInfo) Size() int64        { return 0 }
+func (rootInfo) Mode() os.FileMode  { return os.ModeDir | 0555 }
+func (rootInfo) ModTime() time.Time { return time.Time{} }
+func (rootInfo) IsDir() bool        { return true }
+func (rootInfo) Sys() interface{}   { return nil }
+
+type listerAt []os.FileInfo
+
+func (l listerAt) ListAt(f []os.FileInfo, offset int64) (int, error) {
+	if offset >= int64(len(l)) {
+		return 0, io.EOF
+	}
+	n := copy(f, l[offset:])
+	if n < len(f) {
+		return n, io.EOF
+	}
+	return n, nil
+}
@@ -2,14 +2,19 @@ package network
 
 import (
 	"context"
+	"crypto/subtle"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"path"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pkg/sftp"
@@ -21,31 +26,87 @@ type cacheEntry struct {
 	timestamp time.Time
 }
 
+// remoteFile is an open file on the device.
+type remoteFile interface {
+	io.ReadWriteSeeker
+	io.Closer
+}
+
+// sftpClient is the part of *sftp.Client the filesystem uses, so tests can
+// stand in for a device.
+type sftpClient interface {
+	Stat(p string) (os.FileInfo, error)
+	Lstat(p string) (os.FileInfo, error)
+	ReadDir(p string) ([]os.FileInfo, error)
+	OpenFile(p string, flag int) (remoteFile, error)
+	Mkdir(p string) error
+	Remove(p string) error
+	RemoveDirectory(p string) error
+	Rename(oldname, newname string) error
+}
+
+// sftpClientAdapter returns the *sftp.File it opens as a remoteFile.
+type sftpClientAdapter struct {
+	*sftp.Client
+}
+
+func (c sftpClientAdapter) OpenFile(p string, flag int) (remoteFile, error) {
+	f, err := c.Client.OpenFile(p, flag)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
 // SFTPFileSystem implements webdav.FileSystem by wrapping an sftp.Client
 type SFTPFileSystem struct {
-	client *sftp.Client
+	client sftpClient
 	root   string
 	cache  sync.Map // Path -> cacheEntry
 	ttl    time.Duration
+	now    func() time.Time
+	stores atomic.Int64 // cache stores since the last sweep
 }
 
+// Paths that don't exist are remembered for a short while, since Finder and
+// other WebDAV clients probe for the same metadata files over and over. The
+// metadata files the device never has are remembered longer.
+const (
+	missTTL        = 2 * time.Second
+	ignoredMissTTL = 30 * time.Second
+)
+
+// Expired entries are only dropped when looked up again, so every
+// cacheSweepInterval stores the whole cache is swept, and the misses are
+// dropped altogether if more than maxCachedMisses are still live.
+const (
+	cacheSweepInterval = 1024
+	maxCachedMisses    = 4096
+)
+
 func NewSFTPFileSystem(client *sftp.Client, root string) *SFTPFileSystem {
-	if root == "" {
-		root = "/"
-	}
+	return newSFTPFileSystem(sftpClientAdapter{client}, root)
+}
+
+func newSFTPFileSystem(client sftpClient, root string) *SFTPFileSystem {
 	return &SFTPFileSystem{
 		client: client,
-		root:   root,
+		root:   path.Clean("/" + root),
 		ttl:    5 * time.Second, // Cache stats for 5 seconds
+		now:    time.Now,
 	}
 }
 
+// abs maps a WebDAV path to the device path under root. Results are always
+// clean and never end in a slash, root included, so cache keys agree; the
+// Android quirks that care about trailing slashes are handled by
+// statWithFallback and readDirWithFallback.
 func (fs *SFTPFileSystem) abs(name string) string {
 	name = path.Clean("/" + name)
 
 	// If the name already starts with the root path, don't double-prefix it.
 	// This handles clients that might be sending absolute device paths.
-	if fs.root != "/" && strings.HasPrefix(name, fs.root) {
+	if fs.root != "/" && (name == fs.root || strings.HasPrefix(name, fs.root+"/")) {
 		return name
 	}
 
@@ -60,7 +121,7 @@ func (fs *SFTPFileSystem) abs(name string) string {
 func (fs *SFTPFileSystem) getCache(path string) (interface{}, bool) {
 	if val, ok := fs.cache.Load(path); ok {
 		entry := val.(cacheEntry)
-		if time.Since(entry.timestamp) < fs.ttl {
+		if fs.now().Sub(entry.timestamp) < fs.ttl {
 			return entry.value, true
 		}
 		fs.cache.Delete(path)
@@ -69,13 +130,75 @@ func (fs *SFTPFileSystem) getCache(path string) (interface{}, bool) {
 }
 
 func (fs *SFTPFileSystem) setCache(path string, value interface{}) {
-	fs.cache.Store(path, cacheEntry{value: value, timestamp: time.Now()})
+	fs.store(path, cacheEntry{value: value, timestamp: fs.now()})
+}
+
+func (fs *SFTPFileSystem) store(key string, value interface{}) {
+	fs.cache.Store(key, value)
+	if fs.stores.Add(1) >= cacheSweepInterval {
+		fs.stores.Store(0)
+		fs.sweep()
+	}
+}
+
+// sweep drops expired entries, and every miss if too many are left.
+func (fs *SFTPFileSystem) sweep() {
+	now := fs.now()
+	var misses []interface{}
+	fs.cache.Range(func(key, val interface{}) bool {
+		switch v := val.(type) {
+		case cacheEntry:
+			if now.Sub(v.timestamp) >= fs.ttl {
+				fs.cache.Delete(key)
+			}
+		case time.Time:
+			if !now.Before(v) {
+				fs.cache.Delete(key)
+			} else {
+				misses = append(misses, key)
+			}
+		}
+		return true
+	})
+	if len(misses) > maxCachedMisses {
+		for _, key := range misses {
+			fs.cache.Delete(key)
+		}
+	}
+}
+
+// cachedMiss reports whether absName was recently found not to exist.
+func (fs *SFTPFileSystem) cachedMiss(absName string) bool {
+	val, ok := fs.cache.Load("miss:" + absName)
+	if !ok {
+		return false
+	}
+	if fs.now().Before(val.(time.Time)) {
+		return true
+	}
+	fs.cache.Delete("miss:" + absName)
+	return false
+}
+
+func (fs *SFTPFileSystem) setMiss(name, absName string) {
+	ttl := missTTL
+	if fs.isIgnored(name) {
+		ttl = ignoredMissTTL
+	}
+	fs.store("miss:"+absName, fs.now().Add(ttl))
+}
+
+// forget drops what's cached about absName, for when it's created, changed or
+// removed.
+func (fs *SFTPFileSystem) forget(absName string) {
+	fs.cache.Delete("stat:" + absName)
+	fs.cache.Delete("miss:" + absName)
 }
 
 func (fs *SFTPFileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
 	absName := fs.abs(name)
-	fs.cache.Delete("stat:" + absName)
-	return fs.client.Mkdir(absName)
+	fs.forget(absName)
+	return fs.mkdirWithFallback(absName)
 }
 
 func (fs *SFTPFileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
@@ -87,16 +210,10 @@ func (fs *SFTPFileSystem) OpenFile(ctx context.Context, name string, flag int, p
 		return &SFTPFile{fs: fs, client: fs.client, name: absName, isDir: true}, nil
 	}
 
-	var f *sftp.File
-	if flag == os.O_RDONLY {
-		f, err = fs.client.Open(absName)
-	} else if flag&os.O_CREATE != 0 {
-		fs.cache.Delete("stat:" + absName)
-		f, err = fs.client.Create(absName)
-	} else {
-		f, err = fs.client.OpenFile(absName, flag)
+	if flag&os.O_CREATE != 0 {
+		fs.forget(absName)
 	}
-
+	f, err := fs.openWithFallback(absName, flag)
 	if err != nil {
 		return nil, err
 	}
@@ -106,7 +223,7 @@ func (fs *SFTPFileSystem) OpenFile(ctx context.Context, name string, flag int, p
 
 func (fs *SFTPFileSystem) RemoveAll(ctx context.Context, name string) error {
 	absName := fs.abs(name)
-	fs.cache.Delete("stat:" + absName)
+	fs.forget(absName)
 	stat, err := fs.Stat(ctx, name)
 	if err != nil {
 		return err
@@ -120,8 +237,8 @@ func (fs *SFTPFileSystem) RemoveAll(ctx context.Context, name string) error {
 func (fs *SFTPFileSystem) Rename(ctx context.Context, oldName, newName string) error {
 	absOld := fs.abs(oldName)
 	absNew := fs.abs(newName)
-	fs.cache.Delete("stat:" + absOld)
-	fs.cache.Delete("stat:" + absNew)
+	fs.forget(absOld)
+	fs.forget(absNew)
 	return fs.client.Rename(absOld, absNew)
 }
 
@@ -135,22 +252,18 @@ func (fs *SFTPFileSystem) Stat(ctx context.Context, name string) (os.FileInfo, e
 	if val, ok := fs.getCache("stat:" + absName); ok {
 		return val.(os.FileInfo), nil
 	}
-
-	info, err := fs.client.Stat(absName)
-	if err != nil {
-		// Some Android SFTP servers require a trailing slash for the root directory or subdirs
-		if !strings.HasSuffix(absName, "/") {
-			info, err = fs.client.Stat(absName + "/")
-		}
-		if err != nil {
-			// Try Lstat if Stat fails
-			info, err = fs.client.Lstat(absName)
-		}
+	if fs.cachedMiss(absName) {
+		return nil, &os.PathError{Op: "stat", Path: absName, Err: os.ErrNotExist}
 	}
 
+	info, err := fs.statWithFallback(absName)
+
 	if err == nil {
 		fs.setCache("stat:"+absName, info)
 	} else {
+		if errors.Is(err, os.ErrNotExist) {
+			fs.setMiss(name, absName)
+		}
 		// Suppress logs for common macOS metadata files that won't exist on Android
 		if !fs.isIgnored(name) {
 			fmt.Printf("SFTP Stat Failed for %s (abs: %s): %v\n", name, absName, err)
@@ -159,11 +272,63 @@ func (fs *SFTPFileSystem) Stat(ctx context.Context, name string) (os.FileInfo, e
 	return info, err
 }
 
+// The SFTP server in the KDE Connect Android app serves storage roots such as
+// /storage/emulated/0 as virtual directories, and some versions only answer
+// for them, and for other directories, when the path ends in a slash. Stat
+// also fails on some entries, like symlinks whose target the app can't read,
+// that Lstat still describes. The fallbacks retry in that order and report
+// the first error if nothing works.
+
+// withSlashFallback calls op with absName, and again with a trailing slash if
+// that fails.
+func withSlashFallback[T any](absName string, op func(string) (T, error)) (T, error) {
+	v, err := op(absName)
+	if err == nil || strings.HasSuffix(absName, "/") {
+		return v, err
+	}
+	if v, err := op(absName + "/"); err == nil {
+		return v, nil
+	}
+	return v, err
+}
+
+func (fs *SFTPFileSystem) statWithFallback(absName string) (os.FileInfo, error) {
+	info, err := withSlashFallback(absName, fs.client.Stat)
+	if err == nil {
+		return info, nil
+	}
+	if info, err := fs.client.Lstat(absName); err == nil {
+		return info, nil
+	}
+	return nil, err
+}
+
+func (fs *SFTPFileSystem) readDirWithFallback(absName string) ([]os.FileInfo, error) {
+	return withSlashFallback(absName, fs.client.ReadDir)
+}
+
+// openWithFallback opens absName. A new file is created at the path as given,
+// never a slashed one.
+func (fs *SFTPFileSystem) openWithFallback(absName string, flag int) (remoteFile, error) {
+	open := func(p string) (remoteFile, error) { return fs.client.OpenFile(p, flag) }
+	if flag&os.O_CREATE != 0 {
+		return open(absName)
+	}
+	return withSlashFallback(absName, open)
+}
+
+func (fs *SFTPFileSystem) mkdirWithFallback(absName string) error {
+	_, err := withSlashFallback(absName, func(p string) (struct{}, error) {
+		return struct{}{}, fs.client.Mkdir(p)
+	})
+	return err
+}
+
 // SFTPFile implements webdav.File
 type SFTPFile struct {
-	file         *sftp.File
+	file         remoteFile
 	fs           *SFTPFileSystem
-	client       *sftp.Client
+	client       sftpClient
 	name         string
 	isDir        bool
 	readdirCache []os.FileInfo
@@ -200,7 +365,7 @@ func (f *SFTPFile) Readdir(count int) ([]os.FileInfo, error) {
 		if val, ok := f.fs.getCache("readdir:" + f.name); ok {
 			f.readdirCache = val.([]os.FileInfo)
 		} else {
-			infos, err := f.client.ReadDir(f.name)
+			infos, err := f.fs.readDirWithFallback(f.name)
 			if err != nil {
 				return nil, err
 			}
@@ -208,7 +373,9 @@ func (f *SFTPFile) Readdir(count int) ([]os.FileInfo, error) {
 			f.fs.setCache("readdir:"+f.name, infos)
 			// Proactively cache individual stats
 			for _, info := range infos {
-				f.fs.setCache("stat:"+path.Join(f.name, info.Name()), info)
+				child := path.Join(f.name, info.Name())
+				f.fs.cache.Delete("miss:" + child)
+				f.fs.setCache("stat:"+child, info)
 			}
 		}
 		f.readdirIdx = 0
@@ -240,15 +407,19 @@ func (f *SFTPFile) Write(p []byte) (int, error) {
 	if f.isDir {
 		return 0, os.ErrInvalid
 	}
-	f.fs.cache.Delete("stat:" + f.name)
+	f.fs.forget(f.name)
 	return f.file.Write(p)
 }
 
-// WebDAVServer handles the WebDAV requests
+// WebDAVServer handles the WebDAV requests. It only listens on localhost and
+// requires Basic Auth with its generated User and Password.
 type WebDAVServer struct {
-	handler *webdav.Handler
-	server  *http.Server
-	Port    int
+	handler  *webdav.Handler
+	server   *http.Server
+	root     string
+	Port     int
+	User     string
+	Password string
 }
 
 func NewWebDAVServer(client *sftp.Client, root string) *WebDAVServer {
@@ -270,8 +441,48 @@ func NewWebDAVServer(client *sftp.Client, root string) *WebDAVServer {
 		},
 	}
 	return &WebDAVServer{
-		handler: handler,
+		handler:  handler,
+		root:     fs.root,
+		User:     "kdeconnect",
+		Password: randomHex(16),
+	}
+}
+
+// URL returns the server's root with the credentials filled in.
+func (s *WebDAVServer) URL() *url.URL {
+	return &url.URL{
+		Scheme: "http",
+		User:   url.UserPassword(s.User, s.Password),
+		Host:   net.JoinHostPort("127.0.0.1", strconv.Itoa(s.Port)),
+		Path:   "/",
+	}
+}
+
+// FileURL returns the address of the device file at remotePath, without
+// credentials so it can be shared, or false if it is outside the served root.
+func (s *WebDAVServer) FileURL(remotePath string) (*url.URL, bool) {
+	remotePath = path.Clean("/" + remotePath)
+	rel, ok := strings.CutPrefix(remotePath, s.root)
+	if s.root == "/" {
+		rel, ok = remotePath, true
+	} else if !ok || (rel != "" && rel[0] != '/') {
+		return nil, false
 	}
+	return &url.URL{
+		Scheme: "http",
+		Host:   net.JoinHostPort("127.0.0.1", strconv.Itoa(s.Port)),
+		Path:   "/" + strings.TrimPrefix(rel, "/"),
+	}, true
+}
+
+func (s *WebDAVServer) authorized(r *http.Request) bool {
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+	userOK := subtle.ConstantTimeCompare([]byte(user), []byte(s.User)) == 1
+	passwordOK := subtle.ConstantTimeCompare([]byte(password), []byte(s.Password)) == 1
+	return userOK && passwordOK
 }
 
 func (s *WebDAVServer) Start() error {
@@ -279,14 +490,12 @@ func (s *WebDAVServer) Start() error {
 	s.server = &http.Server{
 		Addr: "127.0.0.1:0",
 		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Finder often expects some form of auth for network volumes.
-			// We provide a dummy one that accepts everything.
-			if _, _, ok := r.BasicAuth(); !ok {
-				// We don't actually enforce it, but we can accept it.
-				// If we want to force Finder to send it:
-				// w.Header().Set("WWW-Authenticate", `Basic realm="KDE Connect"`)
-				// w.WriteHeader(http.StatusUnauthorized)
-				// return
+			// Anything on this machine can reach localhost, so the
+			// generated credentials are what keeps other users out.
+			if !s.authorized(r) {
+				w.Header().Set("WWW-Authenticate", `Basic realm="KDE Connect"`)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
 			}
 			s.handler.ServeHTTP(w, r)
 		}),
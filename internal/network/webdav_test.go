@@ -0,0 +1,249 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeInfo struct {
+	name string
+	dir  bool
+}
+
+func (i fakeInfo) Name() string { return i.name }
+func (i fakeInfo) Size() int64  { return 0 }
+func (i fakeInfo) Mode() os.FileMode {
+	if i.dir {
+		return os.ModeDir | 0o755
+	}
+	return 0o644
+}
+func (i fakeInfo) ModTime() time.Time { return time.Time{} }
+func (i fakeInfo) IsDir() bool        { return i.dir }
+func (i fakeInfo) Sys() interface{}   { return nil }
+
+// fakeClient is a device holding files, each path mapped to whether it is a
+// directory. It counts the Stat calls it gets, by path. With slashOnly it acts
+// like the Android app versions that only find directories by a path ending
+// in a slash.
+type fakeClient struct {
+	mu        sync.Mutex
+	files     map[string]bool
+	stats     map[string]int
+	slashOnly bool
+}
+
+func newFakeClient(files map[string]bool) *fakeClient {
+	return &fakeClient{files: files, stats: make(map[string]int)}
+}
+
+func (c *fakeClient) lookup(p string) (os.FileInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	slashed := p != "/" && strings.HasSuffix(p, "/")
+	key := p
+	if slashed {
+		key = strings.TrimSuffix(p, "/")
+	}
+	dir, ok := c.files[key]
+	if !ok || slashed && !dir || c.slashOnly && dir && !slashed && p != "/" {
+		return nil, &os.PathError{Op: "stat", Path: p, Err: os.ErrNotExist}
+	}
+	return fakeInfo{name: key, dir: dir}, nil
+}
+
+func (c *fakeClient) Stat(p string) (os.FileInfo, error) {
+	c.mu.Lock()
+	c.stats[p]++
+	c.mu.Unlock()
+	return c.lookup(p)
+}
+
+func (c *fakeClient) Lstat(p string) (os.FileInfo, error) { return c.lookup(p) }
+
+func (c *fakeClient) ReadDir(p string) ([]os.FileInfo, error) {
+	if _, err := c.lookup(p); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// fakeFile is an empty file; writes to it are discarded.
+type fakeFile struct {
+	*bytes.Reader
+}
+
+func (fakeFile) Write(p []byte) (int, error) { return len(p), nil }
+func (fakeFile) Close() error                { return nil }
+
+func (c *fakeClient) OpenFile(p string, flag int) (remoteFile, error) {
+	if flag&os.O_CREATE != 0 {
+		c.mu.Lock()
+		c.files[p] = false
+		c.mu.Unlock()
+	} else if _, err := c.lookup(p); err != nil {
+		return nil, err
+	}
+	return fakeFile{bytes.NewReader(nil)}, nil
+}
+
+// Mkdir creates p, which must be in a directory the client finds. With
+// slashOnly p must end in a slash too.
+func (c *fakeClient) Mkdir(p string) error {
+	if c.slashOnly && !strings.HasSuffix(p, "/") {
+		return &os.PathError{Op: "mkdir", Path: p, Err: os.ErrPermission}
+	}
+	parent := p[:strings.LastIndex(strings.TrimSuffix(p, "/"), "/")+1]
+	if _, err := c.lookup(parent); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.files[strings.TrimSuffix(p, "/")] = true
+	return nil
+}
+
+func (c *fakeClient) Remove(p string) error          { return nil }
+func (c *fakeClient) RemoveDirectory(p string) error { return nil }
+func (c *fakeClient) Rename(o, n string) error       { return nil }
+
+func (c *fakeClient) statCount(p string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats[p]
+}
+
+// fakeClock is a settable time for a filesystem's cache.
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func TestMissCacheTTL(t *testing.T) {
+	client := newFakeClient(map[string]bool{"/root": true})
+	fs := newSFTPFileSystem(client, "/root")
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	fs.now = clock.now
+	ctx := context.Background()
+
+	for _, tt := range []struct {
+		name string
+		ttl  time.Duration
+	}{
+		{"/missing.txt", missTTL},
+		{"/._missing.txt", ignoredMissTTL},
+	} {
+		abs := "/root" + tt.name
+		for i := 0; i < 3; i++ {
+			if _, err := fs.Stat(ctx, tt.name); !os.IsNotExist(err) {
+				t.Fatalf("Stat %s = %v, want not exist", tt.name, err)
+			}
+		}
+		if n := client.statCount(abs); n != 1 {
+			t.Fatalf("%s looked up %d times within its TTL, want 1", tt.name, n)
+		}
+
+		clock.advance(tt.ttl - time.Millisecond)
+		fs.Stat(ctx, tt.name)
+		if n := client.statCount(abs); n != 1 {
+			t.Fatalf("%s looked up again before its TTL", tt.name)
+		}
+		clock.advance(time.Millisecond)
+		fs.Stat(ctx, tt.name)
+		if n := client.statCount(abs); n != 2 {
+			t.Fatalf("%s not looked up again after its TTL", tt.name)
+		}
+	}
+}
+
+func TestMissCacheBounded(t *testing.T) {
+	fs := newSFTPFileSystem(newFakeClient(map[string]bool{"/": true}), "/")
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	fs.now = clock.now
+	ctx := context.Background()
+	entries := func() int {
+		n := 0
+		fs.cache.Range(func(_, _ interface{}) bool { n++; return true })
+		return n
+	}
+
+	// Live misses are capped
+	for i := 0; i < maxCachedMisses+2*cacheSweepInterval; i++ {
+		fs.Stat(ctx, fmt.Sprintf("/live-%d", i))
+	}
+	if n := entries(); n > maxCachedMisses+cacheSweepInterval {
+		t.Fatalf("%d entries cached, want at most %d", n, maxCachedMisses+cacheSweepInterval)
+	}
+
+	// Expired ones are swept even if never looked up again
+	clock.advance(ignoredMissTTL)
+	for i := 0; i < cacheSweepInterval; i++ {
+		fs.Stat(ctx, fmt.Sprintf("/expired-%d", i))
+	}
+	if n := entries(); n > cacheSweepInterval {
+		t.Fatalf("%d entries cached after expiry, want at most %d", n, cacheSweepInterval)
+	}
+}
+
+func TestSlashOnlyDirectories(t *testing.T) {
+	client := newFakeClient(map[string]bool{
+		"/storage/emulated/0":              true,
+		"/storage/emulated/0/DCIM":         true,
+		"/storage/emulated/0/DCIM/a.jpg":   false,
+		"/storage/emulated/0/Music":        true,
+		"/storage/emulated/0/Music/b.flac": false,
+	})
+	client.slashOnly = true
+	fs := newSFTPFileSystem(client, "/storage/emulated/0")
+	ctx := context.Background()
+
+	for _, name := range []string{"/", "/DCIM", "/Music"} {
+		t.Run("dir "+name, func(t *testing.T) {
+			info, err := fs.Stat(ctx, name)
+			if err != nil || !info.IsDir() {
+				t.Fatalf("Stat = %v, %v; want a directory", info, err)
+			}
+			f, err := fs.OpenFile(ctx, name, os.O_RDONLY, 0)
+			if err != nil {
+				t.Fatalf("OpenFile: %v", err)
+			}
+			defer f.Close()
+			if _, err := f.Readdir(0); err != nil {
+				t.Fatalf("Readdir: %v", err)
+			}
+		})
+	}
+
+	t.Run("file", func(t *testing.T) {
+		f, err := fs.OpenFile(ctx, "/DCIM/a.jpg", os.O_RDONLY, 0)
+		if err != nil {
+			t.Fatalf("OpenFile: %v", err)
+		}
+		defer f.Close()
+		if _, err := io.ReadAll(f); err != nil {
+			t.Fatalf("reading: %v", err)
+		}
+	})
+
+	t.Run("mkdir", func(t *testing.T) {
+		if err := fs.Mkdir(ctx, "/DCIM/New", 0o755); err != nil {
+			t.Fatalf("Mkdir: %v", err)
+		}
+		if info, err := fs.Stat(ctx, "/DCIM/New"); err != nil || !info.IsDir() {
+			t.Fatalf("Stat after Mkdir = %v, %v; want a directory", info, err)
+		}
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		if _, err := fs.OpenFile(ctx, "/DCIM/missing.jpg", os.O_RDONLY, 0); !os.IsNotExist(err) {
+			t.Fatalf("OpenFile = %v, want not exist", err)
+		}
+	})
+}
@@ -2,6 +2,9 @@ package protocol
 
 import (
 	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
@@ -47,10 +50,43 @@ func GetVerificationKey(certA, certB *x509.Certificate, timestamp int64) (string
 	return strings.ToUpper(hexStr), nil
 }
 
-func GenerateCertificate(deviceName string) (tls.Certificate, []byte, []byte, error) {
-	priv, err := rsa.GenerateKey(rand.Reader, 2048)
-	if err != nil {
-		return tls.Certificate{}, nil, nil, err
+// Key types for GenerateCertificate. RSA is what every KDE Connect version
+// accepts; EC keys are much faster to generate and handshake with, but some
+// older versions reject them.
+const (
+	KeyTypeRSA = "rsa"
+	KeyTypeEC  = "ec"
+)
+
+// GenerateCertificate creates a self-signed certificate with a 2048-bit RSA
+// key, or a P-256 key if keyType is KeyTypeEC.
+func GenerateCertificate(deviceName, keyType string) (tls.Certificate, []byte, []byte, error) {
+	var priv crypto.Signer
+	var privPEM []byte
+	keyUsage := x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign
+	switch keyType {
+	case KeyTypeEC:
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return tls.Certificate{}, nil, nil, err
+		}
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return tls.Certificate{}, nil, nil, err
+		}
+		priv = key
+		privPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	case KeyTypeRSA, "":
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return tls.Certificate{}, nil, nil, err
+		}
+		priv = key
+		privPEM = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+		// Only RSA keys encrypt; ECDSA certificates must not claim it
+		keyUsage |= x509.KeyUsageKeyEncipherment
+	default:
+		return tls.Certificate{}, nil, nil, fmt.Errorf("unsupported key type %q", keyType)
 	}
 
 	notBefore := time.Now()
@@ -70,19 +106,18 @@ func GenerateCertificate(deviceName string) (tls.Certificate, []byte, []byte, er
 		},
 		NotBefore:             notBefore,
 		NotAfter:              notAfter,
-		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		KeyUsage:              keyUsage,
 		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
 		BasicConstraintsValid: true,
 		IsCA:                  true,
 	}
 
-	derBytes, err := x509.CreateCertificate(rand.Reader, &template, &template, &priv.PublicKey, priv)
+	derBytes, err := x509.CreateCertificate(rand.Reader, &template, &template, priv.Public(), priv)
 	if err != nil {
 		return tls.Certificate{}, nil, nil, err
 	}
 
 	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: derBytes})
-	privPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(priv)})
 
 	cert, err := tls.X509KeyPair(certPEM, privPEM)
 	return cert, certPEM, privPEM, err
@@ -0,0 +1,113 @@
+package protocol
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"testing"
+)
+
+// handshake runs a TLS handshake between server and client over loopback,
+// each requiring the other's certificate as devices do, and returns the
+// certificate each side saw.
+func handshake(t *testing.T, server, client tls.Certificate) (seenByServer, seenByClient *x509.Certificate) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	type result struct {
+		cert *x509.Certificate
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		raw, err := l.Accept()
+		if err != nil {
+			done <- result{err: err}
+			return
+		}
+		defer raw.Close()
+		conn := tls.Server(raw, &tls.Config{
+			Certificates:       []tls.Certificate{server},
+			ClientAuth:         tls.RequireAnyClientCert,
+			InsecureSkipVerify: true,
+		})
+		if err := conn.Handshake(); err != nil {
+			done <- result{err: err}
+			return
+		}
+		done <- result{cert: conn.ConnectionState().PeerCertificates[0]}
+	}()
+
+	conn, err := tls.Dial("tcp", l.Addr().String(), &tls.Config{
+		Certificates:       []tls.Certificate{client},
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		t.Fatalf("client handshake: %v", err)
+	}
+	defer conn.Close()
+	res := <-done
+	if res.err != nil {
+		t.Fatalf("server handshake: %v", res.err)
+	}
+	return res.cert, conn.ConnectionState().PeerCertificates[0]
+}
+
+func TestGenerateCertificateHandshake(t *testing.T) {
+	certs := make(map[string]tls.Certificate)
+	for _, keyType := range []string{KeyTypeRSA, KeyTypeEC} {
+		cert, certPEM, privPEM, err := GenerateCertificate("device_"+keyType, keyType)
+		if err != nil {
+			t.Fatalf("%s: %v", keyType, err)
+		}
+		if len(certPEM) == 0 || len(privPEM) == 0 {
+			t.Fatalf("%s: empty PEM", keyType)
+		}
+		// The PEM is what gets saved, so it must load again
+		if _, err := tls.X509KeyPair(certPEM, privPEM); err != nil {
+			t.Fatalf("%s: reloading: %v", keyType, err)
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if keyType == KeyTypeEC && leaf.KeyUsage&x509.KeyUsageKeyEncipherment != 0 {
+			t.Errorf("EC certificate claims key encipherment")
+		}
+		certs[keyType] = cert
+	}
+
+	for _, pair := range [][2]string{
+		{KeyTypeRSA, KeyTypeRSA},
+		{KeyTypeEC, KeyTypeEC},
+		{KeyTypeRSA, KeyTypeEC},
+		{KeyTypeEC, KeyTypeRSA},
+	} {
+		t.Run(pair[0]+" server, "+pair[1]+" client", func(t *testing.T) {
+			server, client := certs[pair[0]], certs[pair[1]]
+			seenByServer, seenByClient := handshake(t, server, client)
+
+			serverLeaf, _ := x509.ParseCertificate(server.Certificate[0])
+			clientLeaf, _ := x509.ParseCertificate(client.Certificate[0])
+			if !seenByServer.Equal(clientLeaf) || !seenByClient.Equal(serverLeaf) {
+				t.Fatal("peers saw the wrong certificates")
+			}
+			// Both screens must show the same verification key
+			a, _ := GetVerificationKey(serverLeaf, seenByServer, 1700000000)
+			b, _ := GetVerificationKey(clientLeaf, seenByClient, 1700000000)
+			if a != b {
+				t.Fatalf("verification keys differ: %s and %s", a, b)
+			}
+		})
+	}
+}
+
+func TestGenerateCertificateUnknownKeyType(t *testing.T) {
+	if _, _, _, err := GenerateCertificate("device", "dsa"); err == nil {
+		t.Fatal("unknown key type accepted")
+	}
+}
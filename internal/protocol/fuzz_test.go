@@ -0,0 +1,78 @@
+package protocol
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func FuzzPacket(f *testing.F) {
+	for _, seed := range []string{
+		`{"id":1,"type":"kdeconnect.identity","body":{"deviceId":"phone","deviceName":"Phone","deviceType":"phone","protocolVersion":8,"tcpPort":1716,"incomingCapabilities":["kdeconnect.ping"],"outgoingCapabilities":[]}}`,
+		`{"id":2,"type":"kdeconnect.pair","body":{"pair":true,"timestamp":1700000000}}`,
+		`{"id":3,"type":"kdeconnect.sftp","body":{"ip":"192.0.2.7","port":1739,"user":"kdeconnect","password":"secret","path":"/storage/emulated/0","multiPaths":["/storage/emulated/0"],"pathNames":["All files"]}}`,
+		`{"id":4,"type":"kdeconnect.sftp","body":{"errorMessage":"no storage"}}`,
+		`{"id":5,"type":"kdeconnect.share.request","body":{"filename":"a.jpg"},"payloadSize":1024,"payloadTransferInfo":{"port":1739}}`,
+		`{"id":6,"type":"kdeconnect.mousepad.request","body":{"dx":1e308,"dy":-1e308,"specialKey":-1}}`,
+		`{"id":7,"type":"kdeconnect.pair","body":null}`,
+		`{"type":1}`,
+		`[]`,
+	} {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var p Packet
+		if err := json.Unmarshal(data, &p); err != nil {
+			return
+		}
+
+		// A packet that decoded re-encodes to the same packet
+		encoded, err := json.Marshal(p)
+		if err != nil {
+			t.Fatalf("re-encoding %q: %v", data, err)
+		}
+		var again Packet
+		if err := json.Unmarshal(encoded, &again); err != nil {
+			t.Fatalf("decoding re-encoded %q: %v", encoded, err)
+		}
+		if again.Id != p.Id || again.Type != p.Type || again.PayloadSize != p.PayloadSize {
+			t.Fatalf("round trip changed %+v to %+v", p, again)
+		}
+
+		var identity IdentityBody
+		if json.Unmarshal(p.Body, &identity) == nil && identity.Validate() == nil {
+			if identity.DeviceId == "" || identity.TcpPort != 0 && !validPort(identity.TcpPort) {
+				t.Fatalf("invalid identity accepted: %+v", identity)
+			}
+		}
+
+		var pair PairBody
+		if json.Unmarshal(p.Body, &pair) == nil && pair.Validate() == nil {
+			if pair.Pair && pair.Timestamp <= 0 {
+				t.Fatalf("pair request without a timestamp accepted: %+v", pair)
+			}
+		}
+
+		var sftp SftpBody
+		if json.Unmarshal(p.Body, &sftp) == nil {
+			_ = sftp.String()
+			if sftp.Validate() == nil && !sftp.StartBrowsing {
+				if !validPort(sftp.Port) || sftp.User == "" || sftp.Password == "" {
+					t.Fatalf("unusable offer accepted: %v", sftp)
+				}
+			}
+		}
+
+		// The rest only need to survive
+		for _, body := range []Validator{
+			new(NotificationBody),
+			new(SystemVolumeBody),
+			new(PresenterBody),
+			new(MousepadRequestBody),
+		} {
+			if json.Unmarshal(p.Body, body) == nil {
+				body.Validate()
+			}
+		}
+	})
+}
@@ -1,11 +1,21 @@
 package protocol
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"fmt"
+)
 
 type Packet struct {
-	Id   int64           `json:"id"`
-	Type string          `json:"type"`
-	Body json.RawMessage `json:"body"`
+	Id                  int64                `json:"id"`
+	Type                string               `json:"type"`
+	Body                json.RawMessage      `json:"body"`
+	PayloadSize         int64                `json:"payloadSize,omitempty"`
+	PayloadTransferInfo *PayloadTransferInfo `json:"payloadTransferInfo,omitempty"`
+}
+
+// PayloadTransferInfo tells the remote where to fetch a packet's payload.
+type PayloadTransferInfo struct {
+	Port int `json:"port"`
 }
 
 type IdentityBody struct {
@@ -24,6 +34,101 @@ type PairBody struct {
 	Timestamp int64 `json:"timestamp,omitempty"`
 }
 
+type ShareRequestBody struct {
+	Filename     string `json:"filename,omitempty"`
+	LastModified int64  `json:"lastModified,omitempty"`
+	Open         bool   `json:"open,omitempty"`
+}
+
+type ClipboardBody struct {
+	Content string `json:"content"`
+}
+
+// NotificationBody is a notification mirrored from the device, or with
+// IsCancel set, the removal of one.
+type NotificationBody struct {
+	Id          string `json:"id"`
+	AppName     string `json:"appName,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Text        string `json:"text,omitempty"`
+	Ticker      string `json:"ticker,omitempty"`
+	IsClearable bool   `json:"isClearable,omitempty"`
+	IsCancel    bool   `json:"isCancel,omitempty"`
+	Silent      bool   `json:"silent,omitempty"`
+	// PayloadHash is the MD5 of the icon sent as the packet's payload
+	PayloadHash string `json:"payloadHash,omitempty"`
+	// RequestReplyId is set when the notification has an inline reply action
+	RequestReplyId string `json:"requestReplyId,omitempty"`
+	// Actions are the labels of the notification's action buttons
+	Actions []string `json:"actions,omitempty"`
+}
+
+// NotificationActionBody triggers the action labelled Action on the
+// notification Key.
+type NotificationActionBody struct {
+	Key    string `json:"key"`
+	Action string `json:"action"`
+}
+
+// NotificationReplyBody answers a notification's inline reply action.
+type NotificationReplyBody struct {
+	RequestReplyId string `json:"requestReplyId"`
+	Message        string `json:"message"`
+}
+
+type PingBody struct {
+	Message string `json:"message,omitempty"`
+}
+
+type SystemVolumeSink struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Muted       bool   `json:"muted"`
+	Volume      int    `json:"volume"`
+	MaxVolume   int    `json:"maxVolume"`
+	Enabled     bool   `json:"enabled"`
+}
+
+// SystemVolumeBody is used both for kdeconnect.systemvolume.request (from the
+// remote) and kdeconnect.systemvolume (sink list or single-sink updates).
+type SystemVolumeBody struct {
+	RequestSinks bool               `json:"requestSinks,omitempty"`
+	SinkList     []SystemVolumeSink `json:"sinkList,omitempty"`
+	Name         string             `json:"name,omitempty"`
+	Volume       *int               `json:"volume,omitempty"`
+	Muted        *bool              `json:"muted,omitempty"`
+	Enabled      *bool              `json:"enabled,omitempty"`
+}
+
+type PresenterBody struct {
+	Dx   float64 `json:"dx,omitempty"`
+	Dy   float64 `json:"dy,omitempty"`
+	Stop bool    `json:"stop,omitempty"`
+}
+
+type MousepadRequestBody struct {
+	Key         string  `json:"key,omitempty"`
+	SpecialKey  int     `json:"specialKey,omitempty"`
+	Shift       bool    `json:"shift,omitempty"`
+	Ctrl        bool    `json:"ctrl,omitempty"`
+	Alt         bool    `json:"alt,omitempty"`
+	Super       bool    `json:"super,omitempty"`
+	Dx          float64 `json:"dx,omitempty"`
+	Dy          float64 `json:"dy,omitempty"`
+	Scroll      bool    `json:"scroll,omitempty"`
+	SingleClick bool    `json:"singleclick,omitempty"`
+	DoubleClick bool    `json:"doubleclick,omitempty"`
+	MiddleClick bool    `json:"middleclick,omitempty"`
+	RightClick  bool    `json:"rightclick,omitempty"`
+}
+
+// LockBody is used both for kdeconnect.lock.request and kdeconnect.lock.
+type LockBody struct {
+	RequestLocked bool  `json:"requestLocked,omitempty"`
+	SetLocked     *bool `json:"setLocked,omitempty"`
+	IsLocked      *bool `json:"isLocked,omitempty"`
+}
+
 type SftpBody struct {
 	StartBrowsing bool     `json:"startBrowsing,omitempty"`
 	Ip            string   `json:"ip,omitempty"`
@@ -35,3 +140,13 @@ type SftpBody struct {
 	PathNames     []string `json:"pathNames,omitempty"`
 	ErrorMessage  string   `json:"errorMessage,omitempty"`
 }
+
+// String masks the credentials so offers can be logged safely.
+func (b SftpBody) String() string {
+	password := ""
+	if b.Password != "" {
+		password = "***"
+	}
+	return fmt.Sprintf("{StartBrowsing:%t Ip:%s Port:%d User:%s Password:%s Path:%s MultiPaths:%v PathNames:%v ErrorMessage:%s}",
+		b.StartBrowsing, b.Ip, b.Port, b.User, password, b.Path, b.MultiPaths, b.PathNames, b.ErrorMessage)
+}
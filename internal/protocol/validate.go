@@ -0,0 +1,94 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Validator is implemented by bodies that can tell when their values make no
+// sense, so a garbage packet is dropped instead of acted on.
+type Validator interface {
+	Validate() error
+}
+
+func validPort(port int) bool {
+	return port >= 1 && port <= 65535
+}
+
+func finite(values ...float64) bool {
+	for _, v := range values {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return false
+		}
+	}
+	return true
+}
+
+func (b IdentityBody) Validate() error {
+	if b.DeviceId == "" {
+		return errors.New("missing deviceId")
+	}
+	// Zero means the default port
+	if b.TcpPort != 0 && !validPort(b.TcpPort) {
+		return fmt.Errorf("invalid tcpPort %d", b.TcpPort)
+	}
+	return nil
+}
+
+func (b PairBody) Validate() error {
+	// Protocol version 8 requires the timestamp the verification key uses
+	if b.Timestamp < 0 || (b.Pair && b.Timestamp == 0) {
+		return fmt.Errorf("invalid timestamp %d", b.Timestamp)
+	}
+	return nil
+}
+
+func (b NotificationBody) Validate() error {
+	if b.Id == "" {
+		return errors.New("missing id")
+	}
+	return nil
+}
+
+func (b SystemVolumeBody) Validate() error {
+	if b.Volume != nil && *b.Volume < 0 {
+		return fmt.Errorf("invalid volume %d", *b.Volume)
+	}
+	return nil
+}
+
+func (b PresenterBody) Validate() error {
+	if !finite(b.Dx, b.Dy) {
+		return errors.New("invalid pointer movement")
+	}
+	return nil
+}
+
+func (b MousepadRequestBody) Validate() error {
+	if !finite(b.Dx, b.Dy) {
+		return errors.New("invalid pointer movement")
+	}
+	if b.SpecialKey < 0 {
+		return fmt.Errorf("invalid specialKey %d", b.SpecialKey)
+	}
+	return nil
+}
+
+// Validate checks an SFTP offer has what's needed to connect. Browse
+// requests carry nothing else and are always valid.
+func (b SftpBody) Validate() error {
+	if b.StartBrowsing {
+		return nil
+	}
+	if b.ErrorMessage != "" {
+		return fmt.Errorf("device reported: %s", b.ErrorMessage)
+	}
+	if !validPort(b.Port) {
+		return fmt.Errorf("invalid port %d", b.Port)
+	}
+	if b.User == "" || b.Password == "" {
+		return errors.New("missing credentials")
+	}
+	return nil
+}
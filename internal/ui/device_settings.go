@@ -0,0 +1,124 @@
+package ui
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/barishamil/kde-connect-fyne/internal/core"
+	"github.com/barishamil/kde-connect-fyne/internal/network"
+	"github.com/barishamil/kde-connect-fyne/internal/protocol"
+)
+
+var pluginNames = map[string]string{
+	"kdeconnect.clipboard":    "Clipboard",
+	"kdeconnect.contacts":     "Contacts",
+	"kdeconnect.lock":         "Lock Screen",
+	"kdeconnect.mousepad":     "Remote Input",
+	"kdeconnect.notification": "Notifications",
+	"kdeconnect.ping":         "Ping",
+	"kdeconnect.presenter":    "Presentation Remote",
+	"kdeconnect.sftp":         "File Browsing",
+	"kdeconnect.share":        "Share Files",
+	"kdeconnect.systemvolume": "System Volume",
+}
+
+func pluginName(plugin string) string {
+	if name, ok := pluginNames[plugin]; ok {
+		return name
+	}
+	return strings.TrimPrefix(plugin, "kdeconnect.")
+}
+
+// showDevicePlugins lets the user switch individual plugins off for one
+// device.
+func (a *App) showDevicePlugins(device protocol.IdentityBody) {
+	box := container.NewVBox()
+	for _, plugin := range core.Plugins() {
+		check := widget.NewCheck(pluginName(plugin), nil)
+		check.SetChecked(a.Engine.PluginEnabled(device.DeviceId, plugin))
+		check.OnChanged = func(enabled bool) {
+			a.Engine.SetPluginEnabled(device.DeviceId, plugin, enabled)
+			a.Devices.Refresh()
+			a.refreshTray()
+		}
+		box.Add(check)
+	}
+
+	// Only the certificate it paired with is accepted automatically
+	fingerprint := a.Engine.PairedFingerprint(device.DeviceId)
+	autoPair := widget.NewCheck("Always accept pair requests", func(allowed bool) {
+		if allowed {
+			a.Engine.SetAutoPair(device.DeviceId, fingerprint)
+		} else {
+			a.Engine.SetAutoPair(device.DeviceId, "")
+		}
+	})
+	autoPair.SetChecked(a.Engine.AutoPairEnabled(device.DeviceId))
+	if fingerprint == "" && !autoPair.Checked {
+		autoPair.Disable()
+	}
+
+	diagnostics := widget.NewButton("Connection Diagnostics…", func() {
+		a.showDeviceStats(device)
+	})
+
+	dialog.ShowCustom("Plugins for "+device.DeviceName, "Close", container.NewVBox(
+		widget.NewLabel("Changes apply when the device reconnects."),
+		box,
+		widget.NewSeparator(),
+		autoPair,
+		diagnostics,
+	), a.Window)
+}
+
+// showDeviceStats shows what has gone over the connection to a device, to
+// tell whether a plugin's packets arrive at all.
+func transportName(t network.Transport) string {
+	if t == network.TransportBluetooth {
+		return "Bluetooth"
+	}
+	return "LAN"
+}
+
+func (a *App) showDeviceStats(device protocol.IdentityBody) {
+	st := a.Engine.DeviceStats(device.DeviceId)
+
+	var b strings.Builder
+	connected := false
+	for _, conn := range a.Engine.GetActiveConnections() {
+		if conn.DeviceId == device.DeviceId {
+			fmt.Fprintf(&b, "Connected over %s to %s since %s, protocol version %d\n",
+				transportName(conn.Transport), conn.RemoteAddr, conn.Since.Format("Jan 2 15:04:05"), conn.ProtocolVersion)
+			connected = true
+		}
+	}
+	if !connected {
+		b.WriteString("Not connected\n")
+	}
+	fmt.Fprintf(&b, "Connections established: %d (outgoing attempts: %d)\n", st.Connects, st.ConnectAttempts)
+	if st.LastError != "" {
+		fmt.Fprintf(&b, "Last error (%s): %s\n", st.LastErrorTime.Format("Jan 2 15:04:05"), st.LastError)
+	}
+	writeCounts := func(title string, counts map[string]int64) {
+		fmt.Fprintf(&b, "\n%s:\n", title)
+		if len(counts) == 0 {
+			b.WriteString("  none\n")
+		}
+		for _, pType := range slices.Sorted(maps.Keys(counts)) {
+			fmt.Fprintf(&b, "  %-45s %d\n", pType, counts[pType])
+		}
+	}
+	writeCounts("Packets received", st.PacketsReceived)
+	writeCounts("Packets sent", st.PacketsSent)
+
+	text := widget.NewLabelWithStyle(b.String(), fyne.TextAlignLeading, fyne.TextStyle{Monospace: true})
+	scroll := container.NewVScroll(text)
+	scroll.SetMinSize(fyne.NewSize(520, 320))
+	dialog.ShowCustom("Diagnostics for "+device.DeviceName, "Close", scroll, a.Window)
+}
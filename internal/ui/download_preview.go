@@ -0,0 +1,196 @@
+package ui
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/barishamil/kde-connect-fyne/internal/lang"
+)
+
+// remoteTree is a device folder's contents, listed before downloading it so
+// the download doesn't walk it again. Folders come before their contents.
+type remoteTree struct {
+	entries []treeEntry
+	files   int
+	size    int64
+}
+
+type treeEntry struct {
+	rel  string // relative to the folder, slash-separated
+	dir  bool
+	size int64
+}
+
+// dirReader lists a device folder, as *sftp.Client does.
+type dirReader interface {
+	ReadDir(p string) ([]os.FileInfo, error)
+}
+
+// walkRemote lists everything under root, calling onProgress with the
+// number of files found so far after each folder. It keeps its own stack
+// rather than recursing, so very deep trees are fine.
+func walkRemote(ctx context.Context, client dirReader, root string, onProgress func(files int)) (*remoteTree, error) {
+	tree := &remoteTree{}
+	stack := []string{""}
+	for len(stack) > 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		rel := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		infos, err := client.ReadDir(path.Join(root, rel))
+		if err != nil {
+			return nil, err
+		}
+		for _, info := range infos {
+			child := path.Join(rel, info.Name())
+			if info.IsDir() {
+				tree.entries = append(tree.entries, treeEntry{rel: child, dir: true})
+				stack = append(stack, child)
+				continue
+			}
+			tree.entries = append(tree.entries, treeEntry{rel: child, size: info.Size()})
+			tree.files++
+			tree.size += info.Size()
+		}
+		onProgress(tree.files)
+	}
+	return tree, nil
+}
+
+// confirmDownload lists the folders among files, in the device folder dir,
+// behind a cancellable progress dialog, then asks before downloading with the
+// total file count and size. start gets the listings by name; with no
+// folders it is called straight away.
+func (fb *FileBrowser) confirmDownload(dir string, files []os.FileInfo, destPath string, start func(trees map[string]*remoteTree)) {
+	var dirs []os.FileInfo
+	count, size := 0, int64(0)
+	for _, f := range files {
+		if f.IsDir() {
+			dirs = append(dirs, f)
+		} else {
+			count++
+			size += f.Size()
+		}
+	}
+	if len(dirs) == 0 {
+		start(nil)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	status := widget.NewLabel(lang.T("browser.counting"))
+	d := dialog.NewCustom(lang.T("browser.preparing"), lang.T("common.cancel"), container.NewVBox(
+		status,
+		widget.NewProgressBarInfinite(),
+	), fb.App.Window)
+	d.SetOnClosed(cancel)
+	d.Show()
+
+	client := fb.client()
+	go func() {
+		trees := make(map[string]*remoteTree)
+		var err error
+		var lastUpdate time.Time
+		for _, f := range dirs {
+			found := count
+			var tree *remoteTree
+			tree, err = walkRemote(ctx, client, path.Join(dir, f.Name()), func(n int) {
+				if time.Since(lastUpdate) < 100*time.Millisecond {
+					return
+				}
+				lastUpdate = time.Now()
+				text := lang.Tf("browser.counting_files", formatCount(found+n))
+				fyne.Do(func() {
+					status.SetText(text)
+				})
+			})
+			if err != nil {
+				break
+			}
+			trees[f.Name()] = tree
+			count += tree.files
+			size += tree.size
+		}
+
+		fyne.Do(func() {
+			if ctx.Err() != nil {
+				// Cancelled, and the dialog is already gone
+				return
+			}
+			d.Hide()
+			if err != nil {
+				dialog.ShowError(err, fb.App.Window)
+				return
+			}
+			msg := lang.Tf("browser.confirm_download", formatCount(count), formatSize(size), displayPath(destPath))
+			dialog.ShowConfirm(lang.T("browser.confirm_download_title"), msg, func(ok bool) {
+				if ok {
+					start(trees)
+				}
+			}, fb.App.Window)
+		})
+	}()
+}
+
+// downloadTree downloads a folder listed by walkRemote into localPath. The
+// item's progress counts the bytes of the whole folder.
+func (fb *FileBrowser) downloadTree(ctx context.Context, remotePath, localPath string, tree *remoteTree, item *TransferItem) error {
+	if err := os.MkdirAll(localPath, 0755); err != nil {
+		return err
+	}
+	var done int64 // in the files before the current one
+	for _, e := range tree.entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		lPath := filepath.Join(localPath, filepath.FromSlash(e.rel))
+		if e.dir {
+			if err := os.MkdirAll(lPath, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		base := done
+		err := fb.downloadFileWithRetry(ctx, path.Join(remotePath, e.rel), lPath, e.size, item, func(n, _ int64) {
+			item.SetBytes(base+n, tree.size)
+		})
+		if err != nil {
+			return err
+		}
+		done += e.size
+	}
+	return nil
+}
+
+// formatCount writes n with thousands separators, e.g. 1,204.
+func formatCount(n int) string {
+	s := strconv.Itoa(n)
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
+
+// displayPath shortens p to start with ~ when it is in the home folder.
+func displayPath(p string) string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return p
+	}
+	rel, err := filepath.Rel(home, p)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return p
+	}
+	return filepath.Join("~", rel)
+}
@@ -0,0 +1,124 @@
+package ui
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeInfo struct {
+	name string
+	size int64
+	dir  bool
+}
+
+func (i fakeInfo) Name() string       { return i.name }
+func (i fakeInfo) Size() int64        { return i.size }
+func (i fakeInfo) Mode() os.FileMode  { return 0 }
+func (i fakeInfo) ModTime() time.Time { return time.Time{} }
+func (i fakeInfo) IsDir() bool        { return i.dir }
+func (i fakeInfo) Sys() interface{}   { return nil }
+
+// fakeDirs is a device's folders by path.
+type fakeDirs map[string][]os.FileInfo
+
+func (d fakeDirs) ReadDir(p string) ([]os.FileInfo, error) {
+	infos, ok := d[p]
+	if !ok {
+		return nil, &os.PathError{Op: "readdir", Path: p, Err: os.ErrNotExist}
+	}
+	return infos, nil
+}
+
+func TestWalkRemote(t *testing.T) {
+	dirs := fakeDirs{
+		"/sdcard/DCIM": {
+			fakeInfo{name: "a.jpg", size: 100},
+			fakeInfo{name: "Camera", dir: true},
+			fakeInfo{name: "Empty", dir: true},
+		},
+		"/sdcard/DCIM/Camera": {
+			fakeInfo{name: "b.jpg", size: 20},
+			fakeInfo{name: "c.mp4", size: 3000},
+		},
+		"/sdcard/DCIM/Empty": nil,
+	}
+
+	var progress []int
+	tree, err := walkRemote(context.Background(), dirs, "/sdcard/DCIM", func(n int) { progress = append(progress, n) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.files != 3 || tree.size != 3120 {
+		t.Fatalf("%d files of %d bytes, want 3 of 3120", tree.files, tree.size)
+	}
+
+	// Folders come before their contents, so they can be created first
+	index := make(map[string]int)
+	for i, e := range tree.entries {
+		index[e.rel] = i
+	}
+	want := []string{"a.jpg", "Camera", "Empty", "Camera/b.jpg", "Camera/c.mp4"}
+	if len(index) != len(want) {
+		t.Fatalf("entries %+v, want %v", tree.entries, want)
+	}
+	for _, rel := range want {
+		if _, ok := index[rel]; !ok {
+			t.Fatalf("%s missing from %+v", rel, tree.entries)
+		}
+	}
+	if index["Camera"] > index["Camera/b.jpg"] || index["Camera"] > index["Camera/c.mp4"] {
+		t.Fatalf("folder listed after its contents: %+v", tree.entries)
+	}
+	if !tree.entries[index["Camera"]].dir || tree.entries[index["Camera/c.mp4"]].size != 3000 {
+		t.Fatalf("wrong entries: %+v", tree.entries)
+	}
+
+	if len(progress) != 3 || progress[len(progress)-1] != 3 {
+		t.Fatalf("progress %v, want a call per folder ending at 3", progress)
+	}
+	for i := 1; i < len(progress); i++ {
+		if progress[i] < progress[i-1] {
+			t.Fatalf("progress went backwards: %v", progress)
+		}
+	}
+}
+
+func TestWalkRemoteErrors(t *testing.T) {
+	dirs := fakeDirs{
+		"/sdcard": {fakeInfo{name: "Gone", dir: true}},
+	}
+	if _, err := walkRemote(context.Background(), dirs, "/sdcard", func(int) {}); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("walkRemote = %v, want the listing error", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := walkRemote(ctx, fakeDirs{"/sdcard": nil}, "/sdcard", func(int) {}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("walkRemote = %v, want context.Canceled", err)
+	}
+}
+
+func TestWalkRemoteDeep(t *testing.T) {
+	dirs := fakeDirs{}
+	p := "/sdcard"
+	for i := 0; i < 1000; i++ {
+		dirs[p] = []os.FileInfo{fakeInfo{name: "d", dir: true}}
+		p += "/d"
+	}
+	dirs[p] = []os.FileInfo{fakeInfo{name: "leaf", size: 1}}
+
+	tree, err := walkRemote(context.Background(), dirs, "/sdcard", func(int) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.files != 1 || len(tree.entries) != 1001 {
+		t.Fatalf("%d files in %d entries, want 1 in 1001", tree.files, len(tree.entries))
+	}
+	if last := tree.entries[len(tree.entries)-1]; !strings.HasSuffix(last.rel, "/d/leaf") || last.size != 1 {
+		t.Fatalf("leaf not last: %+v", last)
+	}
+}
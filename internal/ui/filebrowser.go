@@ -1,14 +1,21 @@
 package ui
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/url"
 	"os"
+	"os/exec"
 	"path"
 	"path/filepath"
+	"runtime"
+	"slices"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"fyne.io/fyne/v2"
@@ -16,72 +23,124 @@ import (
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/data/binding"
 	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/driver/desktop"
 	"fyne.io/fyne/v2/layout"
 	"fyne.io/fyne/v2/storage"
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
+	"github.com/barishamil/kde-connect-fyne/internal/lang"
+	"github.com/barishamil/kde-connect-fyne/internal/logging"
+	"github.com/barishamil/kde-connect-fyne/internal/protocol"
 	"github.com/pkg/sftp"
 )
 
 type FileBrowser struct {
 	App        *App
+	Device     protocol.IdentityBody
 	Container  *fyne.Container
 	Client     *sftp.Client
 	List       *widget.List
+	Grid       *widget.GridWrap
 	files      []os.FileInfo
+	root       string // the offer's path, where browsing falls back to
 	path       string
 	pathString binding.String
 	progress   *widget.ProgressBar
+	storage    *widget.Label
 
 	loadingOverlay *fyne.Container
 	cancelRefresh  chan struct{}
+	reconnectMu    sync.Mutex
+	stopTransfers  func()
+
+	thumbSem chan struct{}
+	thumbMu  sync.Mutex
+	thumbs   *thumbCache
+	thumbFor map[*canvas.Image]string // which file each row's image is showing
 
 	sortBy    string // "name", "size", "date"
 	sortOrder int    // 1 for asc, -1 for desc
+
+	// cursor is the selected row; keyboardSelect marks selections made with
+	// the arrow keys, which move the cursor without opening the item.
+	cursor         int
+	keyboardSelect bool
+
+	// In selection mode rows get a checkbox and tapping one marks it instead
+	// of opening it; marked holds the names checked in the current folder.
+	selecting      bool
+	marked         map[string]bool
+	selectBar      *fyne.Container
+	selectedCount  *widget.Label
+	downloadMarked *widget.Button
 }
 
-func NewFileBrowser(parent *App, client *sftp.Client, initialPath string) *FileBrowser {
+// The file browser's sort, kept across devices and launches.
+const (
+	prefFileSortBy    = "fileSortBy"
+	prefFileSortOrder = "fileSortOrder"
+)
+
+func NewFileBrowser(parent *App, device protocol.IdentityBody, client *sftp.Client, initialPath string) *FileBrowser {
 	if initialPath == "" {
 		initialPath = "/"
 	}
+	startPath := initialPath
+	if last := parent.Engine.LastPath(device.DeviceId); last != "" {
+		startPath = last
+	}
 
 	fb := &FileBrowser{
 		App:        parent,
+		Device:     device,
 		Client:     client,
-		path:       initialPath,
+		root:       initialPath,
+		path:       startPath,
 		pathString: binding.NewString(),
 		progress:   widget.NewProgressBar(),
-		sortBy:     "name",
-		sortOrder:  1,
+		storage:    widget.NewLabel(""),
+		sortBy:     parent.FyneApp.Preferences().StringWithFallback(prefFileSortBy, "name"),
+		sortOrder:  parent.FyneApp.Preferences().IntWithFallback(prefFileSortOrder, 1),
+		cursor:     -1,
+		marked:     make(map[string]bool),
+		thumbSem:   make(chan struct{}, maxThumbnailLoads),
+		thumbs:     newThumbCache(maxCachedThumbnails),
+		thumbFor:   make(map[*canvas.Image]string),
 	}
 	fb.progress.Hide()
+	fb.storage.Hide()
 	fb.pathString.Set(fb.path)
 
 	fb.setupUI()
+	fb.setupShortcuts()
 	fb.refreshFiles()
 	return fb
 }
 
+// Close stops the browser following the transfers once another takes its
+// place.
+func (fb *FileBrowser) Close() {
+	fb.stopTransfers()
+}
+
 type progressWriter struct {
 	total      int64
 	downloaded int64
-	onProgress func(float64)
+	onProgress func(downloaded, total int64)
 	writer     io.Writer
 }
 
 func (pw *progressWriter) Write(p []byte) (int, error) {
 	n, err := pw.writer.Write(p)
 	pw.downloaded += int64(n)
-	if pw.total > 0 {
-		pw.onProgress(float64(pw.downloaded) / float64(pw.total))
-	}
+	pw.onProgress(pw.downloaded, pw.total)
 	return n, err
 }
 
 func (fb *FileBrowser) setupUI() {
 	// Setup Loading Overlay
 	spinner := widget.NewProgressBarInfinite()
-	cancelBtn := widget.NewButton("Cancel", func() {
+	cancelBtn := widget.NewButton(lang.T("common.cancel"), func() {
 		if fb.cancelRefresh != nil {
 			close(fb.cancelRefresh)
 			fb.cancelRefresh = nil
@@ -90,7 +149,7 @@ func (fb *FileBrowser) setupUI() {
 	})
 	fb.loadingOverlay = container.NewCenter(
 		container.NewVBox(
-			widget.NewLabel("Loading directory..."),
+			widget.NewLabel(lang.T("browser.loading")),
 			spinner,
 			cancelBtn,
 		),
@@ -102,144 +161,463 @@ func (fb *FileBrowser) setupUI() {
 			return len(fb.files)
 		},
 		func() fyne.CanvasObject {
-			return container.NewHBox(
+			return newFileRow(container.NewHBox(
+				widget.NewCheck("", nil),
 				container.NewStack(
 					widget.NewIcon(theme.FileIcon()),
-					canvas.NewImageFromResource(theme.FileIcon()),
+					newThumbnailImage(32),
 				),
 				container.NewVBox(
 					widget.NewLabel("file name"),
 					widget.NewLabel("size / date"),
 				),
 				layout.NewSpacer(),
-				widget.NewButtonWithIcon("", theme.DownloadIcon(), func() {}),
-			)
+				widget.NewButtonWithIcon(lang.T("browser.download_button"), theme.DownloadIcon(), func() {}),
+			))
 		},
 		func(id widget.ListItemID, obj fyne.CanvasObject) {
 			if id >= len(fb.files) {
 				return
 			}
 			f := fb.files[id]
-			box := obj.(*fyne.Container)
-			stack := box.Objects[0].(*fyne.Container)
+			row := obj.(*fileRow)
+			box := row.content
+			check := box.Objects[0].(*widget.Check)
+			stack := box.Objects[1].(*fyne.Container)
 			icon := stack.Objects[0].(*widget.Icon)
 			thumb := stack.Objects[1].(*canvas.Image)
-			infoBox := box.Objects[1].(*fyne.Container)
+			infoBox := box.Objects[2].(*fyne.Container)
 			nameLabel := infoBox.Objects[0].(*widget.Label)
 			detailLabel := infoBox.Objects[1].(*widget.Label)
-			btn := box.Objects[3].(*widget.Button)
+			btn := box.Objects[4].(*widget.Button)
+
+			fb.bindCheck(check, f)
 
 			// Reset thumb
 			thumb.Hide()
 			icon.Show()
 
+			icon.SetResource(fileIcon(f))
 			if f.IsDir() {
-				icon.SetResource(theme.FolderIcon())
 				detailLabel.SetText(fmt.Sprintf("%s", f.ModTime().Format("2006-01-02 15:04")))
 			} else {
-				ext := strings.ToLower(filepath.Ext(f.Name()))
-				switch ext {
-				case ".jpg", ".jpeg", ".png", ".gif":
-					icon.SetResource(theme.FileImageIcon())
-				case ".mp4", ".mkv", ".avi":
-					icon.SetResource(theme.FileVideoIcon())
-				default:
-					icon.SetResource(theme.FileIcon())
-				}
 				detailLabel.SetText(fmt.Sprintf("%s | %s", formatSize(f.Size()), f.ModTime().Format("2006-01-02 15:04")))
 			}
 			nameLabel.SetText(f.Name())
 			btn.OnTapped = func() {
 				fb.startDownload(f)
 			}
+			row.onSecondaryTap = func(e *fyne.PointEvent) {
+				fb.showFileMenu(f, e.AbsolutePosition)
+			}
 
-			fb.loadThumbnail(id, f, thumb, icon, box)
+			fb.loadThumbnail(f, thumb, icon, box)
 		},
 	)
 
-	fb.List.OnSelected = func(id widget.ListItemID) {
-		if id >= len(fb.files) {
-			return
-		}
-		f := fb.files[id]
-		if f.IsDir() {
-			fb.path = path.Join(fb.path, f.Name())
-			fb.pathString.Set(fb.path)
-			fb.refreshFiles()
+	fb.List.OnSelected = fb.onSelected
+
+	fb.Grid = widget.NewGridWrap(
+		func() int {
+			return len(fb.files)
+		},
+		func() fyne.CanvasObject {
+			name := widget.NewLabel("file name")
+			name.Alignment = fyne.TextAlignCenter
+			name.Truncation = fyne.TextTruncateEllipsis
+			return newFileRow(container.NewVBox(
+				container.NewCenter(container.NewGridWrap(fyne.NewSquareSize(gridThumbnailSize), container.NewStack(
+					widget.NewIcon(theme.FileIcon()),
+					newThumbnailImage(gridThumbnailSize),
+				))),
+				container.NewBorder(nil, nil, widget.NewCheck("", nil), nil, name),
+			))
+		},
+		func(id widget.GridWrapItemID, obj fyne.CanvasObject) {
+			if id >= len(fb.files) {
+				return
+			}
+			f := fb.files[id]
+			cell := obj.(*fileRow)
+			box := cell.content
+			stack := box.Objects[0].(*fyne.Container).Objects[0].(*fyne.Container).Objects[0].(*fyne.Container)
+			icon := stack.Objects[0].(*widget.Icon)
+			thumb := stack.Objects[1].(*canvas.Image)
+			label := box.Objects[1].(*fyne.Container)
+			name := label.Objects[0].(*widget.Label)
+
+			fb.bindCheck(label.Objects[1].(*widget.Check), f)
+			thumb.Hide()
+			icon.Show()
+			icon.SetResource(fileIcon(f))
+			name.SetText(f.Name())
+			cell.onSecondaryTap = func(e *fyne.PointEvent) {
+				fb.showFileMenu(f, e.AbsolutePosition)
+			}
+
+			fb.loadThumbnail(f, thumb, icon, box)
+		},
+	)
+	fb.Grid.OnSelected = fb.onSelected
+
+	var viewBtn *widget.Button
+	viewBtn = widget.NewButtonWithIcon("", theme.GridIcon(), func() {
+		fb.setGridView(!fb.App.fileGridView)
+		if fb.App.fileGridView {
+			viewBtn.SetIcon(theme.ListIcon())
 		} else {
-			fb.openFile(f)
+			viewBtn.SetIcon(theme.GridIcon())
 		}
+	})
+	if fb.App.fileGridView {
+		viewBtn.SetIcon(theme.ListIcon())
 	}
 
-	backBtn := widget.NewButtonWithIcon("Back", theme.NavigateBackIcon(), func() {
-		fb.path = path.Dir(fb.path)
-		fb.pathString.Set(fb.path)
-		fb.refreshFiles()
+	backBtn := widget.NewButtonWithIcon(lang.T("browser.back"), theme.NavigateBackIcon(), fb.goUp)
+	selectBtn := widget.NewButtonWithIcon(lang.T("browser.select"), theme.CheckButtonCheckedIcon(), func() {
+		fb.setSelecting(!fb.selecting)
 	})
 
-	sortSelect := widget.NewSelect([]string{"Name", "Size", "Date"}, func(s string) {
-		fb.sortBy = strings.ToLower(s)
+	fb.selectedCount = widget.NewLabel("")
+	fb.downloadMarked = widget.NewButtonWithIcon(lang.T("browser.download_selected"), theme.DownloadIcon(), fb.startBatchDownload)
+	fb.selectBar = container.NewHBox(
+		fb.selectedCount,
+		layout.NewSpacer(),
+		widget.NewButton(lang.T("browser.select_all"), fb.selectAll),
+		fb.downloadMarked,
+	)
+	fb.selectBar.Hide()
+
+	// Options are shown translated, so they're matched by position
+	sortKeys := []string{"name", "size", "date"}
+	sortSelect := widget.NewSelect([]string{lang.T("browser.sort_name"), lang.T("browser.sort_size"), lang.T("browser.sort_date")}, nil)
+	sortSelect.OnChanged = func(string) {
+		fb.sortBy = sortKeys[sortSelect.SelectedIndex()]
+		fb.App.FyneApp.Preferences().SetString(prefFileSortBy, fb.sortBy)
 		fb.sortFiles()
-		fb.List.Refresh()
-	})
-	sortSelect.SetSelected("Name")
+		fb.view().Refresh()
+	}
+	sortSelect.SetSelectedIndex(max(slices.Index(sortKeys, fb.sortBy), 0))
 
-	orderSelect := widget.NewSelect([]string{"Asc", "Desc"}, func(s string) {
-		if s == "Asc" {
+	orderSelect := widget.NewSelect([]string{lang.T("browser.ascending"), lang.T("browser.descending")}, nil)
+	orderSelect.OnChanged = func(string) {
+		if orderSelect.SelectedIndex() == 0 {
 			fb.sortOrder = 1
 		} else {
 			fb.sortOrder = -1
 		}
+		fb.App.FyneApp.Preferences().SetInt(prefFileSortOrder, fb.sortOrder)
 		fb.sortFiles()
-		fb.List.Refresh()
-	})
-	orderSelect.SetSelected("Asc")
+		fb.view().Refresh()
+	}
+	if fb.sortOrder == -1 {
+		orderSelect.SetSelectedIndex(1)
+	} else {
+		orderSelect.SetSelectedIndex(0)
+	}
 
-	downloadsList := widget.NewListWithData(
-		fb.App.Downloads.Downloads,
-		func() fyne.CanvasObject {
-			return container.NewVBox(
-				widget.NewLabel("filename"),
-				widget.NewProgressBar(),
-			)
-		},
-		func(i binding.DataItem, o fyne.CanvasObject) {
-			item, _ := i.(binding.Untyped).Get()
-			download := item.(*DownloadItem)
-			box := o.(*fyne.Container)
-			name := box.Objects[0].(*widget.Label)
-			prog := box.Objects[1].(*widget.ProgressBar)
-
-			name.SetText(download.Name)
-			prog.Bind(download.Progress)
-		},
-	)
+	// This device's share of the transfers window
+	transfers, stopTransfers := fb.App.Transfers.Filter(func(t *TransferItem) bool {
+		return t.DeviceName == fb.Device.DeviceName
+	})
+	fb.stopTransfers = stopTransfers
+	transfersList := fb.App.newTransferList(transfers)
 
-	downloadsContainer := container.NewVBox(
+	transfersContainer := container.NewVBox(
 		widget.NewSeparator(),
-		widget.NewLabel("Active Downloads"),
-		container.NewStack(downloadsList),
+		widget.NewLabel(lang.T("browser.transfers")),
+		container.NewStack(transfersList),
 	)
-	downloadsContainer.Hide()
+	transfersContainer.Hide()
 
-	fb.App.Downloads.Downloads.AddListener(binding.NewDataListener(func() {
-		l, _ := fb.App.Downloads.Downloads.Get()
-		if len(l) > 0 {
-			downloadsContainer.Show()
+	transfers.AddListener(binding.NewDataListener(func() {
+		if transfers.Length() > 0 {
+			transfersContainer.Show()
 		} else {
-			downloadsContainer.Hide()
+			transfersContainer.Hide()
 		}
 	}))
 
 	fb.Container = container.NewBorder(
 		container.NewVBox(
-			container.NewHBox(backBtn, layout.NewSpacer(), widget.NewLabel("Sort:"), sortSelect, orderSelect),
-			container.NewHBox(widget.NewLabel("Path: "), widget.NewLabelWithData(fb.pathString)),
+			container.NewHBox(backBtn, layout.NewSpacer(), widget.NewLabel(lang.T("browser.sort")), sortSelect, orderSelect, viewBtn, selectBtn),
+			container.NewHBox(widget.NewLabel(lang.T("browser.path")), widget.NewLabelWithData(fb.pathString)),
+			fb.selectBar,
 			fb.progress,
 		),
-		downloadsContainer, nil, nil,
-		container.NewStack(fb.List, fb.loadingOverlay),
+		container.NewVBox(transfersContainer, fb.storage), nil, nil,
+		container.NewStack(fb.List, fb.Grid, fb.loadingOverlay),
 	)
+	fb.setGridView(fb.App.fileGridView)
+}
+
+// Edge length of the previews in grid view.
+const gridThumbnailSize = 96
+
+func newThumbnailImage(size float32) *canvas.Image {
+	thumb := canvas.NewImageFromResource(theme.FileIcon())
+	thumb.FillMode = canvas.ImageFillContain
+	thumb.SetMinSize(fyne.NewSquareSize(size))
+	thumb.Hide()
+	return thumb
+}
+
+func fileIcon(f os.FileInfo) fyne.Resource {
+	if f.IsDir() {
+		return theme.FolderIcon()
+	}
+	switch strings.ToLower(filepath.Ext(f.Name())) {
+	case ".jpg", ".jpeg", ".png", ".gif":
+		return theme.FileImageIcon()
+	case ".mp4", ".mkv", ".avi":
+		return theme.FileVideoIcon()
+	default:
+		return theme.FileIcon()
+	}
+}
+
+// fileView is the list or grid the files are shown in.
+type fileView interface {
+	fyne.CanvasObject
+	Select(id int)
+	Unselect(id int)
+	UnselectAll()
+	RefreshItem(id int)
+	ScrollTo(id int)
+}
+
+func (fb *FileBrowser) view() fileView {
+	if fb.App.fileGridView {
+		return fb.Grid
+	}
+	return fb.List
+}
+
+// setGridView switches between list and grid view. The choice is kept for
+// the rest of the session.
+func (fb *FileBrowser) setGridView(grid bool) {
+	fb.App.fileGridView = grid
+	fb.cursor = -1
+	fb.List.UnselectAll()
+	fb.Grid.UnselectAll()
+	if grid {
+		fb.List.Hide()
+		fb.Grid.Show()
+	} else {
+		fb.Grid.Hide()
+		fb.List.Show()
+	}
+	fb.view().Refresh()
+}
+
+func (fb *FileBrowser) onSelected(id int) {
+	if id >= len(fb.files) {
+		return
+	}
+	fb.cursor = id
+	if fb.keyboardSelect {
+		return
+	}
+	if fb.selecting {
+		// Unselect so tapping the same item again toggles it back
+		name := fb.files[id].Name()
+		fb.setMarked(name, !fb.marked[name])
+		fb.view().Unselect(id)
+		fb.view().RefreshItem(id)
+		return
+	}
+	fb.activate(fb.files[id])
+}
+
+// bindCheck shows f's checkbox in selection mode, checked if f is marked.
+func (fb *FileBrowser) bindCheck(check *widget.Check, f os.FileInfo) {
+	check.OnChanged = nil
+	check.SetChecked(fb.marked[f.Name()])
+	check.OnChanged = func(on bool) {
+		fb.setMarked(f.Name(), on)
+	}
+	if fb.selecting {
+		check.Show()
+	} else {
+		check.Hide()
+	}
+}
+
+func (fb *FileBrowser) setSelecting(on bool) {
+	fb.selecting = on
+	clear(fb.marked)
+	fb.updateSelectBar()
+	if on {
+		fb.selectBar.Show()
+	} else {
+		fb.selectBar.Hide()
+	}
+	fb.view().Refresh()
+}
+
+func (fb *FileBrowser) setMarked(name string, on bool) {
+	if on {
+		fb.marked[name] = true
+	} else {
+		delete(fb.marked, name)
+	}
+	fb.updateSelectBar()
+}
+
+// selectAll marks everything in the current folder.
+func (fb *FileBrowser) selectAll() {
+	if !fb.selecting {
+		fb.setSelecting(true)
+	}
+	for _, f := range fb.files {
+		fb.marked[f.Name()] = true
+	}
+	fb.updateSelectBar()
+	fb.view().Refresh()
+}
+
+func (fb *FileBrowser) updateSelectBar() {
+	fb.selectedCount.SetText(lang.Tf("browser.selected", len(fb.marked)))
+	if len(fb.marked) == 0 {
+		fb.downloadMarked.Disable()
+	} else {
+		fb.downloadMarked.Enable()
+	}
+}
+
+// fileRow is a file list row that can be right-clicked.
+type fileRow struct {
+	widget.BaseWidget
+	content        *fyne.Container
+	onSecondaryTap func(*fyne.PointEvent)
+}
+
+func newFileRow(content *fyne.Container) *fileRow {
+	r := &fileRow{content: content}
+	r.ExtendBaseWidget(r)
+	return r
+}
+
+func (r *fileRow) CreateRenderer() fyne.WidgetRenderer {
+	return widget.NewSimpleRenderer(r.content)
+}
+
+func (r *fileRow) TappedSecondary(e *fyne.PointEvent) {
+	if r.onSecondaryTap != nil {
+		r.onSecondaryTap(e)
+	}
+}
+
+// showFileMenu shows the context menu for a file row at pos.
+func (fb *FileBrowser) showFileMenu(f os.FileInfo, pos fyne.Position) {
+	download := fyne.NewMenuItem(lang.T("browser.download"), func() {
+		fb.startDownload(f)
+	})
+	download.Icon = theme.DownloadIcon()
+	copyItems := fb.copyMenuItems(path.Join(fb.path, f.Name()))
+
+	if f.IsDir() {
+		items := append([]*fyne.MenuItem{download, fyne.NewMenuItemSeparator()}, copyItems...)
+		widget.ShowPopUpMenuAtPosition(fyne.NewMenu("", items...), fb.App.Window.Canvas(), pos)
+		return
+	}
+
+	items := []*fyne.MenuItem{fyne.NewMenuItem(lang.T("browser.open"), func() {
+		fb.openFile(f, "")
+	})}
+	if isStreamable(f.Name()) {
+		stream := fyne.NewMenuItem(lang.T("browser.stream"), func() {
+			fb.streamFile(f)
+		})
+		stream.Icon = theme.MediaPlayIcon()
+		items = append(items, stream)
+	}
+
+	saved := fb.App.Engine.OpenWithApp(f.Name())
+	if saved != "" {
+		items = append(items, fyne.NewMenuItem(lang.Tf("browser.open_with_app", saved), func() {
+			fb.openFile(f, saved)
+		}))
+	}
+
+	var apps []*fyne.MenuItem
+	for _, app := range fb.App.Engine.OpenWithApps() {
+		item := fyne.NewMenuItem(app, func() {
+			fb.App.Engine.SetOpenWithApp(f.Name(), app)
+			fb.openFile(f, app)
+		})
+		item.Checked = app == saved
+		apps = append(apps, item)
+	}
+	if len(apps) > 0 {
+		apps = append(apps, fyne.NewMenuItemSeparator())
+	}
+	apps = append(apps, fyne.NewMenuItem(lang.T("browser.other_app"), func() {
+		fb.chooseApp(f)
+	}))
+	if saved != "" {
+		apps = append(apps, fyne.NewMenuItem(lang.T("browser.system_default"), func() {
+			fb.App.Engine.SetOpenWithApp(f.Name(), "")
+		}))
+	}
+	openWith := fyne.NewMenuItem(lang.T("browser.open_with"), nil)
+	openWith.ChildMenu = fyne.NewMenu("", apps...)
+
+	items = append(items, openWith, fyne.NewMenuItemSeparator(), download, fyne.NewMenuItemSeparator())
+	items = append(items, copyItems...)
+	widget.ShowPopUpMenuAtPosition(fyne.NewMenu("", items...), fb.App.Window.Canvas(), pos)
+}
+
+// copyMenuItems offers to copy remotePath, and its WebDAV address while the
+// device is mounted.
+func (fb *FileBrowser) copyMenuItems(remotePath string) []*fyne.MenuItem {
+	copyPath := fyne.NewMenuItem(lang.T("browser.copy_path"), func() {
+		fb.App.FyneApp.Clipboard().SetContent(remotePath)
+	})
+	copyPath.Icon = theme.ContentCopyIcon()
+	items := []*fyne.MenuItem{copyPath}
+
+	if srv, ok := fb.App.webdavServers[fb.Device.DeviceId]; ok {
+		if u, ok := srv.FileURL(remotePath); ok {
+			items = append(items, fyne.NewMenuItem(lang.T("browser.copy_webdav_url"), func() {
+				fb.App.FyneApp.Clipboard().SetContent(u.String())
+			}))
+		}
+	}
+	return items
+}
+
+// chooseApp asks for an application to open f with and remembers it for
+// files of the same type.
+func (fb *FileBrowser) chooseApp(f os.FileInfo) {
+	entry := widget.NewEntry()
+	if runtime.GOOS == "darwin" {
+		entry.SetPlaceHolder(lang.T("browser.app_placeholder_mac"))
+	} else {
+		entry.SetPlaceHolder(lang.T("browser.app_placeholder"))
+	}
+	entry.Validator = func(s string) error {
+		if strings.TrimSpace(s) == "" {
+			return errors.New(lang.T("browser.app_required"))
+		}
+		return nil
+	}
+
+	ext := strings.ToLower(filepath.Ext(f.Name()))
+	title := lang.T("browser.open_with")
+	if ext != "" {
+		title = lang.Tf("browser.open_type_with", ext)
+	}
+	dialog.ShowForm(title, lang.T("browser.open"), lang.T("common.cancel"), []*widget.FormItem{
+		widget.NewFormItem(lang.T("browser.application"), entry),
+	}, func(ok bool) {
+		if !ok {
+			return
+		}
+		app := strings.TrimSpace(entry.Text)
+		fb.App.Engine.SetOpenWithApp(f.Name(), app)
+		fb.openFile(f, app)
+	}, fb.App.Window)
 }
 
 func formatSize(size int64) string {
@@ -254,6 +632,10 @@ func formatSize(size int64) string {
 }
 
 func (fb *FileBrowser) sortFiles() {
+	// The selection is by index, so it doesn't survive reordering
+	fb.cursor = -1
+	fb.view().UnselectAll()
+
 	sort.Slice(fb.files, func(i, j int) bool {
 		// Always keep directories at top if sorting by name?
 		// KDE Connect usually keeps dirs together. Let's do that.
@@ -281,6 +663,100 @@ func (fb *FileBrowser) sortFiles() {
 	})
 }
 
+// activate enters a directory or opens a file.
+func (fb *FileBrowser) activate(f os.FileInfo) {
+	if f.IsDir() {
+		fb.navigate(path.Join(fb.path, f.Name()))
+	} else {
+		fb.openFile(f, "")
+	}
+}
+
+func (fb *FileBrowser) goUp() {
+	fb.navigate(path.Dir(fb.path))
+}
+
+func (fb *FileBrowser) navigate(p string) {
+	fb.path = p
+	clear(fb.marked)
+	fb.updateSelectBar()
+	fb.pathString.Set(fb.path)
+	fb.refreshFiles()
+}
+
+// setupShortcuts binds the browser's keyboard shortcuts on the main window:
+// Backspace goes up, Enter opens the selected item, the arrow keys move the
+// selection, Cmd/Ctrl+D downloads it, Cmd/Ctrl+A selects everything and
+// Cmd/Ctrl+R refreshes.
+func (fb *FileBrowser) setupShortcuts() {
+	c := fb.App.Window.Canvas()
+
+	c.AddShortcut(&desktop.CustomShortcut{KeyName: fyne.KeyA, Modifier: fyne.KeyModifierShortcutDefault}, func(fyne.Shortcut) {
+		if fb.keysActive() {
+			fb.selectAll()
+		}
+	})
+
+	c.AddShortcut(&desktop.CustomShortcut{KeyName: fyne.KeyD, Modifier: fyne.KeyModifierShortcutDefault}, func(fyne.Shortcut) {
+		if f, ok := fb.selected(); ok && fb.keysActive() {
+			fb.startDownload(f)
+		}
+	})
+	c.AddShortcut(&desktop.CustomShortcut{KeyName: fyne.KeyR, Modifier: fyne.KeyModifierShortcutDefault}, func(fyne.Shortcut) {
+		if fb.keysActive() {
+			fb.refreshFiles()
+		}
+	})
+
+	c.SetOnTypedKey(func(ev *fyne.KeyEvent) {
+		if !fb.keysActive() {
+			return
+		}
+		switch ev.Name {
+		case fyne.KeyBackspace:
+			fb.goUp()
+		case fyne.KeyReturn, fyne.KeyEnter:
+			if f, ok := fb.selected(); ok {
+				fb.activate(f)
+			}
+		case fyne.KeyUp:
+			fb.moveCursor(-1)
+		case fyne.KeyDown:
+			fb.moveCursor(1)
+		}
+	})
+}
+
+// keysActive reports whether keys should go to this browser: it must be the
+// one on screen, and no text entry may have focus.
+func (fb *FileBrowser) keysActive() bool {
+	objects := fb.App.MainContent.Objects
+	if len(objects) == 0 || objects[0] != fb.Container {
+		return false
+	}
+	_, typing := fb.App.Window.Canvas().Focused().(*widget.Entry)
+	return !typing
+}
+
+func (fb *FileBrowser) selected() (os.FileInfo, bool) {
+	if fb.cursor < 0 || fb.cursor >= len(fb.files) {
+		return nil, false
+	}
+	return fb.files[fb.cursor], true
+}
+
+func (fb *FileBrowser) moveCursor(delta int) {
+	if len(fb.files) == 0 {
+		return
+	}
+	id := min(max(fb.cursor+delta, 0), len(fb.files)-1)
+
+	fb.keyboardSelect = true
+	fb.view().Select(id)
+	fb.keyboardSelect = false
+	fb.view().ScrollTo(id)
+}
+
 func (fb *FileBrowser) refreshFiles() {
 	if fb.cancelRefresh != nil {
 		close(fb.cancelRefresh)
@@ -290,8 +766,12 @@ func (fb *FileBrowser) refreshFiles() {
 
 	fb.loadingOverlay.Show()
 
+	dir := fb.path
 	go func() {
-		files, err := fb.Client.ReadDir(fb.path)
+		files, err := fb.client().ReadDir(dir)
+		if err == nil {
+			fb.updateStorage(dir)
+		}
 
 		select {
 		case <-cancel:
@@ -304,80 +784,316 @@ func (fb *FileBrowser) refreshFiles() {
 
 			if err != nil {
 				fmt.Printf("Error reading dir: %v\n", err)
+				if errors.Is(err, os.ErrNotExist) && dir != fb.root {
+					// Deleted on the device since it was last browsed
+					fb.navigate(fb.root)
+					return
+				}
 				// Clear files if there was an error to avoid showing old data
 				fb.files = nil
-				fb.List.Refresh()
+				fb.view().Refresh()
 				return
 			}
 			fb.files = files
 			fb.sortFiles()
-			fb.List.Refresh()
+			fb.view().Refresh()
+			fb.App.Engine.SetLastPath(fb.Device.DeviceId, dir)
 		})
 	}()
 }
 
-func (fb *FileBrowser) loadThumbnail(id widget.ListItemID, f os.FileInfo, thumb *canvas.Image, icon *widget.Icon, box *fyne.Container) {
+// updateStorage shows the free space of the filesystem dir is on, or hides
+// the readout if the server can't tell.
+func (fb *FileBrowser) updateStorage(dir string) {
+	client := fb.client()
+	if _, ok := client.HasExtension("statvfs@openssh.com"); !ok {
+		return
+	}
+
+	st, err := client.StatVFS(dir)
+	if err != nil {
+		logging.Debugf("statvfs %s: %v\n", dir, err)
+		fyne.Do(fb.storage.Hide)
+		return
+	}
+
+	// Bavail excludes blocks reserved for root, which apps can't use
+	free := int64(st.Frsize * st.Bavail)
+	total := int64(st.TotalSpace())
+	fyne.Do(func() {
+		if total == 0 {
+			fb.storage.Hide()
+			return
+		}
+		fb.storage.SetText(lang.Tf("browser.free_space", formatSize(free), formatSize(total)))
+		fb.storage.Show()
+	})
+}
+
+// Thumbnails share the SFTP connection with browsing and downloads, so only
+// a few load at a time and each gets a deadline.
+const (
+	maxThumbnailLoads = 4
+	thumbnailTimeout  = 10 * time.Second
+)
+
+func (fb *FileBrowser) loadThumbnail(f os.FileInfo, thumb *canvas.Image, icon *widget.Icon, box *fyne.Container) {
+	remoteP := path.Join(fb.path, f.Name())
+
+	fb.thumbMu.Lock()
+	fb.thumbFor[thumb] = remoteP
+	res, cached := fb.thumbs.get(remoteP)
+	fb.thumbMu.Unlock()
+
 	ext := strings.ToLower(filepath.Ext(f.Name()))
 	isImage := ext == ".jpg" || ext == ".jpeg" || ext == ".png" || ext == ".gif"
 	if !isImage || f.Size() >= 2*1024*1024 {
 		return
 	}
 
-	remoteP := path.Join(fb.path, f.Name())
+	if cached {
+		// Failed thumbnails are skipped rather than retried
+		if res != nil {
+			showThumbnail(thumb, icon, box, res)
+		}
+		return
+	}
+
 	go func() {
-		src, err := fb.Client.Open(remoteP)
-		if err != nil {
+		fb.thumbSem <- struct{}{}
+		defer func() { <-fb.thumbSem }()
+
+		// The row may have scrolled to another file while we waited
+		if !fb.thumbWanted(thumb, remoteP) {
 			return
 		}
-		data, err := io.ReadAll(src)
-		src.Close()
+
+		data, err := fb.readThumbnail(remoteP)
+		var res fyne.Resource
 		if err != nil {
-			return
+			logging.Debugf("Skipping thumbnail for %s: %v\n", remoteP, err)
+		} else {
+			res = fyne.NewStaticResource(f.Name(), data)
 		}
 
+		fb.thumbMu.Lock()
+		fb.thumbs.put(remoteP, res)
+		fb.thumbMu.Unlock()
+
+		if res == nil {
+			return // The row keeps its file icon
+		}
 		fyne.Do(func() {
-			if id >= len(fb.files) || fb.files[id].Name() != f.Name() {
-				return
+			if fb.thumbWanted(thumb, remoteP) {
+				showThumbnail(thumb, icon, box, res)
 			}
-			thumb.Resource = fyne.NewStaticResource(f.Name(), data)
-			thumb.FillMode = canvas.ImageFillContain
-			thumb.SetMinSize(fyne.NewSize(32, 32))
-			thumb.Show()
-			icon.Hide()
-			box.Refresh()
 		})
 	}()
 }
 
+func (fb *FileBrowser) thumbWanted(thumb *canvas.Image, remotePath string) bool {
+	fb.thumbMu.Lock()
+	defer fb.thumbMu.Unlock()
+	return fb.thumbFor[thumb] == remotePath
+}
+
+func (fb *FileBrowser) readThumbnail(remotePath string) ([]byte, error) {
+	src, err := fb.client().Open(remotePath)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	// SFTP reads don't take a context; closing the file unblocks them
+	timer := time.AfterFunc(thumbnailTimeout, func() { src.Close() })
+	defer timer.Stop()
+
+	return io.ReadAll(src)
+}
+
+func showThumbnail(thumb *canvas.Image, icon *widget.Icon, box *fyne.Container, res fyne.Resource) {
+	thumb.Resource = res
+	thumb.Show()
+	icon.Hide()
+	box.Refresh()
+}
+
 func (fb *FileBrowser) startDownload(f os.FileInfo) {
-	d := dialog.NewFolderOpen(func(uri fyne.ListableURI, err error) {
-		if err != nil || uri == nil {
-			return
+	dir := fb.path
+	fb.chooseDestination(func(destPath string) {
+		fb.confirmDownload(dir, []os.FileInfo{f}, destPath, func(trees map[string]*remoteTree) {
+			fb.download(dir, f, destPath, trees[f.Name()], func(err error) {
+				fyne.Do(func() {
+					if err != nil {
+						dialog.ShowError(err, fb.App.Window)
+					} else {
+						fb.App.showDownloaded(lang.Tf("browser.downloaded", f.Name(), destPath), filepath.Join(destPath, f.Name()))
+					}
+				})
+			})
+		})
+	})
+}
+
+// startBatchDownload asks once for a folder and downloads every marked item
+// into it, each as its own transfer, reporting when the last one ends.
+func (fb *FileBrowser) startBatchDownload() {
+	var files []os.FileInfo
+	for _, f := range fb.files {
+		if fb.marked[f.Name()] {
+			files = append(files, f)
 		}
+	}
+	if len(files) == 0 {
+		return
+	}
 
-		destPath := uri.Path()
-		remotePath := path.Join(fb.path, f.Name())
-		localPath := filepath.Join(destPath, f.Name())
+	dir := fb.path
+	fb.chooseDestination(func(destPath string) {
+		fb.confirmDownload(dir, files, destPath, func(trees map[string]*remoteTree) {
+			fb.setSelecting(false)
+			fb.downloadAll(dir, files, destPath, trees)
+		})
+	})
+}
 
-		fb.App.Downloads.StartDownload(f.Name(), func(progress binding.Float) error {
-			if f.IsDir() {
-				return fb.downloadDir(remotePath, localPath, progress)
+// downloadAll starts a transfer for each of files, in the device folder dir,
+// reporting when the last one ends.
+func (fb *FileBrowser) downloadAll(dir string, files []os.FileInfo, destPath string, trees map[string]*remoteTree) {
+	var mu sync.Mutex
+	var errs []error
+	remaining := len(files)
+	for _, f := range files {
+		fb.download(dir, f, destPath, trees[f.Name()], func(err error) {
+			mu.Lock()
+			if err != nil && !errors.Is(err, context.Canceled) {
+				errs = append(errs, fmt.Errorf("%s: %w", f.Name(), err))
+			}
+			remaining--
+			last := remaining == 0
+			mu.Unlock()
+			if !last {
+				return
 			}
-			return fb.downloadFile(remotePath, localPath, f.Size(), progress)
-		}, func(err error) {
 			fyne.Do(func() {
-				if err != nil {
-					dialog.ShowError(err, fb.App.Window)
+				if len(errs) > 0 {
+					dialog.ShowError(errors.Join(errs...), fb.App.Window)
 				} else {
-					dialog.ShowInformation("Success", fmt.Sprintf("Downloaded %s to %s", f.Name(), destPath), fb.App.Window)
+					fb.App.showDownloaded(lang.Tf("browser.downloaded_count", len(files), destPath), destPath)
 				}
 			})
 		})
+	}
+}
+
+func (fb *FileBrowser) chooseDestination(onChosen func(destPath string)) {
+	d := dialog.NewFolderOpen(func(uri fyne.ListableURI, err error) {
+		if err != nil || uri == nil {
+			return
+		}
+		onChosen(uri.Path())
 	}, fb.App.Window)
 	d.Show()
 }
 
-func (fb *FileBrowser) downloadFile(remotePath, localPath string, size int64, progress binding.Float) error {
+// download starts a transfer of f, in the device folder dir, into destPath.
+// tree is f's listing from confirmDownload, if it is a folder.
+func (fb *FileBrowser) download(dir string, f os.FileInfo, destPath string, tree *remoteTree, onDone func(error)) {
+	remotePath := path.Join(dir, f.Name())
+	localPath := filepath.Join(destPath, f.Name())
+
+	fb.App.Transfers.Start(TransferDownload, fb.Device.DeviceName, f.Name(), localPath, func(ctx context.Context, item *TransferItem) error {
+		if !f.IsDir() {
+			return fb.downloadFileWithRetry(ctx, remotePath, localPath, f.Size(), item, item.SetBytes)
+		}
+		if tree == nil {
+			var err error
+			if tree, err = walkRemote(ctx, fb.client(), remotePath, func(int) {}); err != nil {
+				return err
+			}
+		}
+		item.Size = tree.size
+		return fb.downloadTree(ctx, remotePath, localPath, tree, item)
+	}, onDone)
+}
+
+// How many times an interrupted download is resumed before giving up.
+const downloadRetries = 3
+
+// downloadFileWithRetry resumes a download interrupted by a dropped
+// connection from the partial file, reconnecting SFTP in between, with
+// exponential backoff. Other errors end it. onProgress receives the bytes of
+// the file downloaded so far and its size.
+func (fb *FileBrowser) downloadFileWithRetry(ctx context.Context, remotePath, localPath string, size int64, item *TransferItem, onProgress func(done, total int64)) error {
+	for attempt := 1; ; attempt++ {
+		client := fb.client()
+		err := fb.downloadFile(ctx, client, remotePath, localPath, size, onProgress)
+		if err == nil || ctx.Err() != nil || !transientError(err) || attempt > downloadRetries {
+			return err
+		}
+		fmt.Printf("Download of %s failed (attempt %d): %v\n", remotePath, attempt, err)
+
+		item.Status.Set(lang.Tf("browser.retrying", attempt, downloadRetries))
+		select {
+		case <-time.After(time.Duration(1<<(attempt-1)) * time.Second):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		if err := fb.reconnect(client); err != nil {
+			fmt.Printf("SFTP reconnect failed: %v\n", err)
+			continue
+		}
+		item.Status.Set(item.Direction.activeStatus())
+	}
+}
+
+// transientError reports whether err comes from a dropped connection, which
+// reconnecting may cure, rather than from e.g. a missing file or a full disk.
+func transientError(err error) bool {
+	var status *sftp.StatusError
+	if errors.As(err, &status) {
+		code := status.FxCode()
+		return code == sftp.ErrSSHFxConnectionLost || code == sftp.ErrSSHFxNoConnection
+	}
+	var netErr net.Error
+	return errors.Is(err, sftp.ErrSSHFxConnectionLost) ||
+		errors.Is(err, sftp.ErrSSHFxNoConnection) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, net.ErrClosed) ||
+		errors.As(err, &netErr)
+}
+
+// client returns the SFTP client, which reconnect may replace from any
+// download's goroutine.
+func (fb *FileBrowser) client() *sftp.Client {
+	fb.reconnectMu.Lock()
+	defer fb.reconnectMu.Unlock()
+	return fb.Client
+}
+
+// reconnect replaces a failed SFTP client, unless another download has
+// already done so.
+func (fb *FileBrowser) reconnect(failed *sftp.Client) error {
+	fb.reconnectMu.Lock()
+	defer fb.reconnectMu.Unlock()
+
+	if fb.Client != failed {
+		return nil
+	}
+	client, err := fb.App.Engine.ConnectSFTP(fb.Device.DeviceId)
+	if err != nil {
+		return err
+	}
+	failed.Close()
+	fb.Client = client
+	return nil
+}
+
+// downloadFile downloads remotePath into localPath, resuming from what is
+// already there. Cancelling ctx aborts it mid-file.
+func (fb *FileBrowser) downloadFile(ctx context.Context, client *sftp.Client, remotePath, localPath string, size int64, onProgress func(done, total int64)) error {
 	var initialOffset int64
 	var dst *os.File
 	var err error
@@ -390,7 +1106,7 @@ func (fb *FileBrowser) downloadFile(remotePath, localPath string, size int64, pr
 			initialOffset = info.Size()
 		} else if info.Size() == size {
 			fmt.Printf("File %s already fully downloaded\n", localPath)
-			progress.Set(1.0)
+			onProgress(size, size)
 			return nil
 		} else {
 			// Local file is larger? Unexpected. Just restart.
@@ -405,11 +1121,14 @@ func (fb *FileBrowser) downloadFile(remotePath, localPath string, size int64, pr
 	}
 	defer dst.Close()
 
-	src, err := fb.Client.Open(remotePath)
+	src, err := client.Open(remotePath)
 	if err != nil {
 		return err
 	}
 	defer src.Close()
+	// SFTP reads don't take a context; closing the file unblocks them
+	stop := context.AfterFunc(ctx, func() { src.Close() })
+	defer stop()
 
 	if initialOffset > 0 {
 		_, err = src.Seek(initialOffset, io.SeekStart)
@@ -421,55 +1140,39 @@ func (fb *FileBrowser) downloadFile(remotePath, localPath string, size int64, pr
 	pw := &progressWriter{
 		total:      size,
 		downloaded: initialOffset,
-		onProgress: func(p float64) {
-			progress.Set(p)
-		},
-		writer: dst,
+		onProgress: onProgress,
+		writer:     dst,
 	}
 
-	_, err = io.Copy(pw, src)
-	return err
-}
-
-func (fb *FileBrowser) downloadDir(remotePath, localPath string, progress binding.Float) error {
-	err := os.MkdirAll(localPath, 0755)
-	if err != nil {
-		return err
+	n, err := io.Copy(pw, src)
+	fb.App.Engine.RecordTransfer(0, n)
+	if ctx.Err() != nil {
+		return ctx.Err()
 	}
-
-	files, err := fb.Client.ReadDir(remotePath)
-	if err != nil {
-		return err
-	}
-
-	for _, f := range files {
-		rPath := path.Join(remotePath, f.Name())
-		lPath := filepath.Join(localPath, f.Name())
-
-		if f.IsDir() {
-			if err := fb.downloadDir(rPath, lPath, progress); err != nil {
-				return err
-			}
-		} else {
-			if err := fb.downloadFile(rPath, lPath, f.Size(), progress); err != nil {
-				return err
-			}
-		}
+	if err == nil && initialOffset+n < size {
+		// The connection went away mid-file
+		err = io.ErrUnexpectedEOF
 	}
-	return nil
+	return err
 }
 
-func (fb *FileBrowser) openFile(f os.FileInfo) {
+// openFile downloads f and, once complete, opens it with app, or the system
+// default if app is "". Use streamFile to play media while it loads.
+func (fb *FileBrowser) openFile(f os.FileInfo, app string) {
 	remotePath := path.Join(fb.path, f.Name())
-	ext := strings.ToLower(filepath.Ext(f.Name()))
-	isMP4 := ext == ".mp4"
 
 	fb.progress.Show()
 	fb.progress.SetValue(0)
 
-	localPath, di, err := fb.App.Downloads.StartPersistentDownload(f.Name(), func(localPath string, progress binding.Float) error {
-		return fb.downloadFile(remotePath, localPath, f.Size(), progress)
-	}, func(destPath string, err error) {
+	localPath, err := persistentDownloadPath(f.Name())
+	if err != nil {
+		fb.hideProgressError(err)
+		return
+	}
+
+	di := fb.App.Transfers.Start(TransferDownload, fb.Device.DeviceName, f.Name(), localPath, func(ctx context.Context, item *TransferItem) error {
+		return fb.downloadFileWithRetry(ctx, remotePath, localPath, f.Size(), item, item.SetBytes)
+	}, func(err error) {
 		fyne.Do(func() {
 			fb.progress.Hide()
 			if err != nil {
@@ -477,26 +1180,10 @@ func (fb *FileBrowser) openFile(f os.FileInfo) {
 				return
 			}
 
-			if !isMP4 {
-				fb.openWithSystem(destPath)
-			}
+			fb.open(localPath, app)
 		})
 	})
 
-	if err != nil {
-		fb.hideProgressError(err)
-		return
-	}
-
-	if isMP4 {
-		go func() {
-			time.Sleep(500 * time.Millisecond)
-			fyne.Do(func() {
-				fb.openWithSystem(localPath)
-			})
-		}()
-	}
-
 	// Link browser's internal progress bar to the download item
 	di.Progress.AddListener(binding.NewDataListener(func() {
 		val, _ := di.Progress.Get()
@@ -506,11 +1193,47 @@ func (fb *FileBrowser) openFile(f os.FileInfo) {
 	}))
 }
 
+func (fb *FileBrowser) open(path, app string) {
+	if app == "" {
+		fb.openWithSystem(path)
+		return
+	}
+	go func() {
+		if err := openWithApp(path, app); err != nil {
+			fyne.Do(func() {
+				dialog.ShowError(fmt.Errorf("%s: %w", lang.Tf("browser.open_with_failed", app), err), fb.App.Window)
+			})
+		}
+	}()
+}
+
+// openWithApp opens path in a specific application. Elsewhere than macOS app
+// is run directly, never through a shell, so a file name can't inject
+// commands.
+func openWithApp(path, app string) error {
+	switch runtime.GOOS {
+	case "darwin":
+		output, err := exec.Command("open", "-a", app, path).CombinedOutput()
+		if msg := strings.TrimSpace(string(output)); err != nil && msg != "" {
+			return errors.New(msg)
+		}
+		return err
+	default:
+		cmd := exec.Command(app, path)
+		if err := cmd.Start(); err != nil {
+			return err
+		}
+		// Reap it once it exits so it doesn't linger as a zombie
+		go cmd.Wait()
+		return nil
+	}
+}
+
 func (fb *FileBrowser) openWithSystem(path string) {
 	u := storage.NewFileURI(path)
 	parsedURL, _ := url.Parse(u.String())
 	if err := fb.App.FyneApp.OpenURL(parsedURL); err != nil {
-		dialog.ShowError(fmt.Errorf("could not open file: %w", err), fb.App.Window)
+		dialog.ShowError(fmt.Errorf("%s: %w", lang.T("browser.open_failed"), err), fb.App.Window)
 	}
 }
 
@@ -0,0 +1,15 @@
+//go:build !darwin
+
+package ui
+
+import "fmt"
+
+const launchAtLoginSupported = false
+
+func launchAtLogin() bool {
+	return false
+}
+
+func setLaunchAtLogin(enabled bool) error {
+	return fmt.Errorf("launch at login not supported on this platform")
+}
@@ -0,0 +1,230 @@
+package ui
+
+import (
+	"fmt"
+	"slices"
+	"time"
+	"unicode/utf8"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"github.com/barishamil/kde-connect-fyne/internal/core"
+)
+
+const (
+	prefGroupNotifications = "groupNotifications"
+	// prefNotificationPopups is how many desktop notifications one app may
+	// pop up per notificationPopupWindow; 0 means no limit.
+	prefNotificationPopups = "notificationPopups"
+
+	defaultNotificationPopups = 3
+	notificationPopupWindow   = 10 * time.Second
+)
+
+// listenNotifications mirrors device notifications to the desktop and keeps
+// the notifications window up to date.
+func (a *App) listenNotifications() {
+	a.Engine.SetNotificationGrouping(a.FyneApp.Preferences().BoolWithFallback(prefGroupNotifications, true))
+
+	a.Engine.Events.On("notification_posted", func(data interface{}) {
+		n := data.(core.Notification)
+		fyne.Do(func() {
+			if !n.Silent && a.allowPopup(n.AppName) {
+				// Fyne notifications have no icon; the app's icon shows in
+				// the notifications window instead.
+				a.FyneApp.SendNotification(fyne.NewNotification(notificationTitle(n), n.Text))
+			}
+			a.refreshNotifications()
+		})
+	})
+	a.Engine.Events.On("notification_removed", func(data interface{}) {
+		fyne.Do(a.refreshNotifications)
+	})
+}
+
+// allowPopup reports whether a desktop notification may be shown for app,
+// so chatty apps only end up in the notifications window.
+func (a *App) allowPopup(app string) bool {
+	limit := a.FyneApp.Preferences().IntWithFallback(prefNotificationPopups, defaultNotificationPopups)
+	if limit <= 0 {
+		return true
+	}
+
+	now := time.Now()
+	recent := slices.DeleteFunc(a.notificationPopups[app], func(t time.Time) bool {
+		return now.Sub(t) >= notificationPopupWindow
+	})
+	if len(recent) >= limit {
+		a.notificationPopups[app] = recent
+		return false
+	}
+	a.notificationPopups[app] = append(recent, now)
+	return true
+}
+
+func notificationTitle(n core.Notification) string {
+	switch {
+	case n.Title == "":
+		return n.AppName
+	case n.AppName == "" || n.AppName == n.Title:
+		return n.Title
+	}
+	return fmt.Sprintf("%s: %s", n.AppName, n.Title)
+}
+
+// notificationIcon returns the resource for an app icon, reusing it across
+// notifications from the same app.
+func (a *App) notificationIcon(n core.Notification) fyne.Resource {
+	if n.Icon == nil {
+		return theme.InfoIcon()
+	}
+	if res, ok := a.notificationIcons[n.AppName]; ok && len(res.Content()) == len(n.Icon) {
+		return res
+	}
+	res := fyne.NewStaticResource(n.AppName+".png", n.Icon)
+	a.notificationIcons[n.AppName] = res
+	return res
+}
+
+// Longer action labels are cut short so a row's buttons stay on screen.
+const maxActionLabel = 24
+
+func actionLabel(action string) string {
+	if utf8.RuneCountInString(action) <= maxActionLabel {
+		return action
+	}
+	return string([]rune(action)[:maxActionLabel-1]) + "…"
+}
+
+// replyToNotification sends the draft typed under n and clears it.
+func (a *App) replyToNotification(n core.Notification, entry *widget.Entry) {
+	if entry.Text == "" {
+		return
+	}
+	if err := a.Engine.ReplyToNotification(n.DeviceId, n.RequestReplyId, entry.Text); err != nil {
+		dialog.ShowError(err, a.notificationsWindow)
+		return
+	}
+	delete(a.notificationDrafts, notificationKey(n))
+	entry.SetText("")
+}
+
+func notificationKey(n core.Notification) string {
+	return n.DeviceId + "/" + n.Id
+}
+
+func (a *App) refreshNotifications() {
+	a.notifications = a.Engine.Notifications()
+	if a.notificationList != nil {
+		a.notificationList.Refresh()
+	}
+}
+
+// showNotifications opens the list of notifications mirrored from devices.
+func (a *App) showNotifications() {
+	if a.notificationsWindow != nil {
+		a.notificationsWindow.RequestFocus()
+		return
+	}
+
+	w := a.FyneApp.NewWindow("Notifications")
+	a.notificationsWindow = w
+
+	a.notificationList = widget.NewList(
+		func() int {
+			return len(a.notifications)
+		},
+		func() fyne.CanvasObject {
+			icon := canvas.NewImageFromResource(theme.InfoIcon())
+			icon.FillMode = canvas.ImageFillContain
+			icon.SetMinSize(fyne.NewSquareSize(32))
+
+			source := widget.NewLabelWithStyle("App — Device", fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
+			source.Truncation = fyne.TextTruncateEllipsis
+			text := widget.NewLabel("text")
+			text.Truncation = fyne.TextTruncateEllipsis
+
+			reply := widget.NewEntry()
+			reply.SetPlaceHolder("Reply…")
+			send := widget.NewButtonWithIcon("", theme.MailSendIcon(), nil)
+			return container.NewBorder(nil, nil, container.NewVBox(icon), nil,
+				container.NewVBox(source, widget.NewLabel("title"), text,
+					container.NewBorder(nil, nil, nil, send, reply), container.NewHBox()),
+			)
+		},
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			if id >= len(a.notifications) {
+				return
+			}
+			n := a.notifications[id]
+			row := obj.(*fyne.Container)
+			content := row.Objects[0].(*fyne.Container)
+			icon := row.Objects[1].(*fyne.Container).Objects[0].(*canvas.Image)
+			source := content.Objects[0].(*widget.Label)
+			title := content.Objects[1].(*widget.Label)
+			text := content.Objects[2].(*widget.Label)
+			replyBox := content.Objects[3].(*fyne.Container)
+			reply := replyBox.Objects[0].(*widget.Entry)
+			send := replyBox.Objects[1].(*widget.Button)
+			actions := content.Objects[4].(*fyne.Container)
+
+			icon.Resource = a.notificationIcon(n)
+			icon.Refresh()
+			app := n.AppName
+			if n.Count > 1 {
+				app = fmt.Sprintf("%s (%d)", app, n.Count)
+			}
+			source.SetText(fmt.Sprintf("%s — %s · %s", app, a.Engine.DeviceName(n.DeviceId), n.Received.Format("15:04")))
+			title.SetText(n.Title)
+			text.SetText(n.Text)
+
+			// Rows are reused, so the entry shows this notification's draft
+			key := notificationKey(n)
+			reply.OnChanged = nil
+			reply.SetText(a.notificationDrafts[key])
+			reply.OnChanged = func(s string) {
+				a.notificationDrafts[key] = s
+			}
+			reply.OnSubmitted = func(string) {
+				a.replyToNotification(n, reply)
+			}
+			send.OnTapped = func() {
+				a.replyToNotification(n, reply)
+			}
+			if n.RequestReplyId == "" {
+				replyBox.Hide()
+			} else {
+				replyBox.Show()
+			}
+
+			actions.RemoveAll()
+			for _, action := range n.Actions {
+				actions.Add(widget.NewButton(actionLabel(action), func() {
+					if err := a.Engine.TriggerNotificationAction(n.DeviceId, n.Id, action); err != nil {
+						dialog.ShowError(err, a.notificationsWindow)
+					}
+				}))
+			}
+			if len(n.Actions) == 0 {
+				actions.Hide()
+			} else {
+				actions.Show()
+			}
+			a.notificationList.SetItemHeight(id, row.MinSize().Height)
+		},
+	)
+
+	w.SetOnClosed(func() {
+		a.notificationsWindow = nil
+		a.notificationList = nil
+	})
+
+	a.refreshNotifications()
+	w.SetContent(a.notificationList)
+	w.Resize(fyne.NewSize(420, 500))
+	w.Show()
+}
@@ -0,0 +1,86 @@
+package ui
+
+import (
+	"fmt"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"github.com/barishamil/kde-connect-fyne/internal/lang"
+	"github.com/barishamil/kde-connect-fyne/internal/protocol"
+)
+
+// showRemoteInput opens a window that controls the device's pointer and
+// keyboard, like the touchpad in the phone app does for this computer.
+func (a *App) showRemoteInput(device protocol.IdentityBody) {
+	send := func(req protocol.MousepadRequestBody) {
+		if err := a.Engine.SendMousepadRequest(device.DeviceId, req); err != nil {
+			fmt.Printf("Failed to send remote input to %s: %v\n", device.DeviceName, err)
+		}
+	}
+
+	keys := widget.NewEntry()
+	keys.SetPlaceHolder(lang.T("remote.type"))
+	keys.OnSubmitted = func(text string) {
+		keys.SetText("")
+		if text != "" {
+			go send(protocol.MousepadRequestBody{Key: text})
+		}
+	}
+
+	w := a.FyneApp.NewWindow(lang.Tf("remote.title", device.DeviceName))
+	w.SetContent(container.NewBorder(nil, keys, nil, nil, newTouchpad(send)))
+	w.Resize(fyne.NewSize(480, 360))
+	w.Show()
+}
+
+// touchpad turns drags, taps and scrolls on it into mousepad requests.
+type touchpad struct {
+	widget.BaseWidget
+	send func(protocol.MousepadRequestBody)
+}
+
+func newTouchpad(send func(protocol.MousepadRequestBody)) *touchpad {
+	t := &touchpad{send: send}
+	t.ExtendBaseWidget(t)
+	return t
+}
+
+func (t *touchpad) CreateRenderer() fyne.WidgetRenderer {
+	bg := canvas.NewRectangle(theme.Color(theme.ColorNameInputBackground))
+	bg.CornerRadius = theme.Size(theme.SizeNameInputRadius)
+	hint := widget.NewLabel(lang.T("remote.hint"))
+	hint.Importance = widget.LowImportance
+	hint.Wrapping = fyne.TextWrapWord
+	hint.Alignment = fyne.TextAlignCenter
+	return widget.NewSimpleRenderer(container.NewStack(bg, container.NewCenter(hint)))
+}
+
+// Moves are only merged by the engine, so they're sent right away; anything
+// else may have to wait for a connection and goes off the UI goroutine.
+
+func (t *touchpad) Dragged(e *fyne.DragEvent) {
+	t.send(protocol.MousepadRequestBody{Dx: float64(e.Dragged.DX), Dy: float64(e.Dragged.DY)})
+}
+
+func (t *touchpad) DragEnd() {}
+
+func (t *touchpad) Tapped(*fyne.PointEvent) {
+	go t.send(protocol.MousepadRequestBody{SingleClick: true})
+}
+
+func (t *touchpad) DoubleTapped(*fyne.PointEvent) {
+	go t.send(protocol.MousepadRequestBody{DoubleClick: true})
+}
+
+func (t *touchpad) TappedSecondary(*fyne.PointEvent) {
+	go t.send(protocol.MousepadRequestBody{RightClick: true})
+}
+
+// Scrolled sends the wheel as a two-finger scroll, whose deltas run the
+// other way.
+func (t *touchpad) Scrolled(e *fyne.ScrollEvent) {
+	t.send(protocol.MousepadRequestBody{Dx: -float64(e.Scrolled.DX), Dy: -float64(e.Scrolled.DY), Scroll: true})
+}
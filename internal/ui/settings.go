@@ -0,0 +1,267 @@
+package ui
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/driver/desktop"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"github.com/barishamil/kde-connect-fyne/internal/core"
+	"github.com/barishamil/kde-connect-fyne/internal/network"
+)
+
+func (a *App) showSettings() {
+	if a.settingsWindow != nil {
+		a.settingsWindow.RequestFocus()
+		return
+	}
+
+	w := a.FyneApp.NewWindow("Settings")
+	a.settingsWindow = w
+	w.SetOnClosed(func() {
+		a.settingsWindow = nil
+	})
+
+	forgetBtn := widget.NewButtonWithIcon("Forget All Devices", theme.DeleteIcon(), func() {
+		dialog.ShowConfirm("Forget All Devices",
+			"This unpairs every device. All devices must be paired again to reconnect.",
+			func(ok bool) {
+				if !ok {
+					return
+				}
+				go func() {
+					a.Engine.ResetPairings()
+					fyne.Do(func() {
+						a.removeUndiscoveredDevices()
+						a.Devices.Refresh()
+					})
+				}()
+			}, w)
+	})
+	forgetBtn.Importance = widget.DangerImportance
+
+	regenerateBtn := widget.NewButtonWithIcon("Regenerate Identity", theme.ViewRefreshIcon(), func() {
+		dialog.ShowConfirm("Regenerate Identity",
+			"This creates a new device ID and certificate and unpairs every device. All devices must be paired again, and the app must be restarted.",
+			func(ok bool) {
+				if !ok {
+					return
+				}
+				go func() {
+					err := a.Engine.RegenerateIdentity()
+					fyne.Do(func() {
+						if err != nil {
+							dialog.ShowError(err, w)
+							return
+						}
+						dialog.ShowConfirm("Restart Required", "The new identity takes effect after restarting. Quit now?", func(quit bool) {
+							if quit {
+								a.quit()
+							}
+						}, w)
+					})
+				}()
+			}, w)
+	})
+	regenerateBtn.Importance = widget.DangerImportance
+
+	encryptCheck := widget.NewCheck("Encrypt private key with the system keychain", nil)
+	encryptCheck.SetChecked(a.Engine.KeyEncrypted())
+	encryptCheck.OnChanged = func(enabled bool) {
+		if err := a.Engine.SetKeyEncryption(enabled); err != nil {
+			dialog.ShowError(err, w)
+			encryptCheck.SetChecked(a.Engine.KeyEncrypted())
+		}
+	}
+	if !core.KeyEncryptionSupported() {
+		encryptCheck.Disable()
+	}
+
+	closeToTrayCheck := widget.NewCheck("Keep running in the tray when the window is closed", func(enabled bool) {
+		a.FyneApp.Preferences().SetBool(prefCloseToTray, enabled)
+	})
+	closeToTrayCheck.SetChecked(a.FyneApp.Preferences().BoolWithFallback(prefCloseToTray, true))
+	if _, ok := a.FyneApp.Driver().(desktop.App); !ok {
+		closeToTrayCheck.Disable()
+	}
+
+	themeSelect := widget.NewSelect(themeNames, func(name string) {
+		pref := strings.ToLower(name)
+		if pref == "system" {
+			pref = ""
+		}
+		a.FyneApp.Preferences().SetString(prefTheme, pref)
+		a.applyTheme()
+	})
+	switch a.FyneApp.Preferences().String(prefTheme) {
+	case "light":
+		themeSelect.SetSelected("Light")
+	case "dark":
+		themeSelect.SetSelected("Dark")
+	default:
+		themeSelect.SetSelected("System")
+	}
+
+	loginCheck := widget.NewCheck("Launch at login", nil)
+	loginCheck.SetChecked(launchAtLogin())
+	loginCheck.OnChanged = func(enabled bool) {
+		if err := setLaunchAtLogin(enabled); err != nil {
+			dialog.ShowError(err, w)
+			loginCheck.SetChecked(launchAtLogin())
+		}
+	}
+	if !launchAtLoginSupported {
+		loginCheck.Disable()
+	}
+
+	groupCheck := widget.NewCheck("Group notifications with the same app and title", func(enabled bool) {
+		a.FyneApp.Preferences().SetBool(prefGroupNotifications, enabled)
+		a.Engine.SetNotificationGrouping(enabled)
+	})
+	groupCheck.SetChecked(a.Engine.NotificationGrouping())
+
+	popupOptions := []string{"1", "3", "5", "10", "Unlimited"}
+	popupSelect := widget.NewSelect(popupOptions, func(s string) {
+		n, _ := strconv.Atoi(s) // Unlimited is 0
+		a.FyneApp.Preferences().SetInt(prefNotificationPopups, n)
+	})
+	if n := a.FyneApp.Preferences().IntWithFallback(prefNotificationPopups, defaultNotificationPopups); n > 0 {
+		popupSelect.SetSelected(strconv.Itoa(n))
+	} else {
+		popupSelect.SetSelected("Unlimited")
+	}
+
+	sharedBox := container.NewVBox()
+	var updateShared func()
+	updateShared = func() {
+		sharedBox.RemoveAll()
+		dirs := a.Engine.SharedFolders()
+		if len(dirs) == 0 {
+			sharedBox.Add(widget.NewLabelWithStyle("Not sharing any folders", fyne.TextAlignLeading, fyne.TextStyle{Italic: true}))
+		}
+		for _, dir := range dirs {
+			label := widget.NewLabel(dir)
+			label.Truncation = fyne.TextTruncateEllipsis
+			removeBtn := widget.NewButtonWithIcon("", theme.DeleteIcon(), func() {
+				a.Engine.RemoveSharedFolder(dir)
+				updateShared()
+			})
+			removeBtn.Importance = widget.LowImportance
+			sharedBox.Add(container.NewBorder(nil, nil, nil, removeBtn, label))
+		}
+	}
+	addSharedBtn := widget.NewButtonWithIcon("Add Folder…", theme.FolderNewIcon(), func() {
+		dialog.ShowFolderOpen(func(uri fyne.ListableURI, err error) {
+			if err != nil || uri == nil {
+				return
+			}
+			a.Engine.AddSharedFolder(uri.Path())
+			updateShared()
+		}, w)
+	})
+	updateShared()
+
+	tlsNote := widget.NewLabelWithStyle("TLS 1.3 is used whenever the device supports it. Some older Android versions only support 1.2.", fyne.TextAlignLeading, fyne.TextStyle{Italic: true})
+	tlsNote.Wrapping = fyne.TextWrapWord
+	tlsSelect := widget.NewSelect([]string{"1.2", "1.3"}, nil)
+	tlsSelect.SetSelected(a.Engine.MinTLSVersion())
+	tlsSelect.OnChanged = func(version string) {
+		if err := a.Engine.SetMinTLSVersion(version); err != nil {
+			dialog.ShowError(err, w)
+		}
+	}
+
+	idleOptions := []string{"Never", "2 minutes", "10 minutes", "30 minutes"}
+	idleTimeouts := []time.Duration{0, 2 * time.Minute, 10 * time.Minute, 30 * time.Minute}
+	idleSelect := widget.NewSelect(idleOptions, func(s string) {
+		if err := a.Engine.SetIdleTimeout(idleTimeouts[slices.Index(idleOptions, s)]); err != nil {
+			dialog.ShowError(err, w)
+		}
+	})
+	if i := slices.Index(idleTimeouts, a.Engine.IdleTimeout()); i >= 0 {
+		idleSelect.SetSelected(idleOptions[i])
+	} else {
+		idleSelect.PlaceHolder = a.Engine.IdleTimeout().String()
+	}
+
+	// Real interfaces are checked while discovery isn't restricted
+	selected := a.Engine.DiscoveryInterfaces()
+	ifaces := network.ListInterfaces()
+	ifaceBox := container.NewVBox()
+	var ifaceChecks []*widget.Check
+	for _, iface := range ifaces {
+		label := fmt.Sprintf("%s (%s)", iface.Name, strings.Join(iface.Addrs, ", "))
+		if iface.Virtual {
+			label += " — virtual"
+		}
+		check := widget.NewCheck(label, nil)
+		if len(selected) == 0 {
+			check.SetChecked(!iface.Virtual)
+		} else {
+			check.SetChecked(slices.Contains(selected, iface.Name))
+		}
+		ifaceChecks = append(ifaceChecks, check)
+		ifaceBox.Add(check)
+	}
+	for i, check := range ifaceChecks {
+		check.OnChanged = func(bool) {
+			var names []string
+			isDefault := true
+			for j, c := range ifaceChecks {
+				if c.Checked {
+					names = append(names, ifaces[j].Name)
+				}
+				if c.Checked == ifaces[j].Virtual {
+					isDefault = false
+				}
+			}
+			if len(names) == 0 {
+				// Discovery needs at least one interface
+				ifaceChecks[i].SetChecked(true)
+				return
+			}
+			if isDefault {
+				names = nil
+			}
+			a.Engine.SetDiscoveryInterfaces(names)
+		}
+	}
+
+	w.SetContent(container.NewVScroll(container.NewVBox(
+		widget.NewCard("General", "", container.NewVBox(
+			container.NewBorder(nil, nil, widget.NewLabel("Appearance"), nil, themeSelect),
+			closeToTrayCheck,
+			loginCheck,
+		)),
+		widget.NewCard("Notifications", "", container.NewVBox(
+			groupCheck,
+			container.NewBorder(nil, nil, widget.NewLabel("Pop-ups per app every 10 seconds"), nil, popupSelect),
+		)),
+		widget.NewCard("Sharing", "Folders paired devices can browse", container.NewVBox(
+			sharedBox,
+			addSharedBtn,
+		)),
+		widget.NewCard("Network", "Interfaces used to discover devices", container.NewVBox(
+			ifaceBox,
+			container.NewBorder(nil, nil, widget.NewLabel("Disconnect silent devices after"), nil, idleSelect),
+		)),
+		widget.NewCard("Devices", "Reset pairing state", container.NewVBox(
+			forgetBtn,
+			regenerateBtn,
+		)),
+		widget.NewCard("Security", "", container.NewVBox(
+			encryptCheck,
+			container.NewBorder(nil, nil, widget.NewLabel("Minimum TLS version"), nil, tlsSelect),
+			tlsNote,
+		)),
+	)))
+	w.Resize(fyne.NewSize(460, 620))
+	w.Show()
+}
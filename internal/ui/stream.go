@@ -0,0 +1,105 @@
+package ui
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"github.com/barishamil/kde-connect-fyne/internal/network"
+	"github.com/pkg/sftp"
+)
+
+// streamServer serves a device's whole filesystem over HTTP so players can
+// fetch ranges of a file on demand.
+type streamServer struct {
+	client *sftp.Client
+	srv    *network.WebDAVServer
+}
+
+// isStreamable reports whether name is audio or video a player can stream.
+func isStreamable(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".mp4", ".m4v", ".mov", ".mkv", ".avi", ".webm", ".mp3", ".m4a", ".aac", ".flac", ".ogg", ".opus", ".wav":
+		return true
+	}
+	return false
+}
+
+// streamURL returns the URL remotePath can be streamed from, starting a
+// server for the browser's SFTP client if needed.
+func (fb *FileBrowser) streamURL(remotePath string) (*url.URL, error) {
+	client := fb.client()
+
+	a := fb.App
+	a.streamMu.Lock()
+	defer a.streamMu.Unlock()
+
+	s, ok := a.streamServers[fb.Device.DeviceId]
+	if !ok || s.client != client {
+		if ok {
+			s.srv.Stop()
+		}
+		srv := network.NewWebDAVServer(client, "/")
+		if err := srv.Start(); err != nil {
+			return nil, fmt.Errorf("failed to start streaming server: %w", err)
+		}
+		s = &streamServer{client: client, srv: srv}
+		a.streamServers[fb.Device.DeviceId] = s
+		go a.stopStreamServerOnClose(fb.Device.DeviceId, s)
+	}
+
+	u := s.srv.URL()
+	u.Path = path.Clean(remotePath)
+	return u, nil
+}
+
+// stopStreamServerOnClose stops s once its SFTP client is closed, as it is
+// when the device disconnects, since it can't serve anything after that.
+func (a *App) stopStreamServerOnClose(deviceId string, s *streamServer) {
+	s.client.Wait()
+
+	a.streamMu.Lock()
+	if a.streamServers[deviceId] == s {
+		delete(a.streamServers, deviceId)
+	}
+	a.streamMu.Unlock()
+	s.srv.Stop()
+}
+
+// stopStreamServers stops every stream server, for when the app quits.
+func (a *App) stopStreamServers() {
+	a.streamMu.Lock()
+	defer a.streamMu.Unlock()
+	for deviceId, s := range a.streamServers {
+		s.srv.Stop()
+		delete(a.streamServers, deviceId)
+	}
+}
+
+// streamFile opens f in a player straight from the device, falling back to
+// downloading it first if that fails.
+func (fb *FileBrowser) streamFile(f os.FileInfo) {
+	remotePath := path.Join(fb.path, f.Name())
+	app := fb.App.Engine.OpenWithApp(f.Name())
+
+	go func() {
+		u, err := fb.streamURL(remotePath)
+		if err == nil {
+			if app != "" {
+				err = openWithApp(u.String(), app)
+			} else {
+				err = fb.App.FyneApp.OpenURL(u)
+			}
+		}
+		if err != nil {
+			fmt.Printf("Streaming %s failed, downloading instead: %v\n", f.Name(), err)
+			fyne.Do(func() {
+				fb.openFile(f, app)
+			})
+		}
+	}()
+}
@@ -0,0 +1,40 @@
+package ui
+
+import (
+	"image/color"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/theme"
+)
+
+// prefTheme is the appearance, "light" or "dark"; anything else follows the
+// system.
+const prefTheme = "theme"
+
+var themeNames = []string{"System", "Light", "Dark"}
+
+// variantTheme is the default theme held to one variant whatever the system
+// uses.
+type variantTheme struct {
+	fyne.Theme
+	variant fyne.ThemeVariant
+}
+
+func (t variantTheme) Color(name fyne.ThemeColorName, _ fyne.ThemeVariant) color.Color {
+	return t.Theme.Color(name, t.variant)
+}
+
+// applyTheme sets the saved appearance. The default theme picks its variant
+// from the system and follows it as that changes.
+func (a *App) applyTheme() {
+	var t fyne.Theme
+	switch a.FyneApp.Preferences().String(prefTheme) {
+	case "light":
+		t = variantTheme{theme.DefaultTheme(), theme.VariantLight}
+	case "dark":
+		t = variantTheme{theme.DefaultTheme(), theme.VariantDark}
+	default:
+		t = theme.DefaultTheme()
+	}
+	a.FyneApp.Settings().SetTheme(t)
+}
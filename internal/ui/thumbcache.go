@@ -0,0 +1,53 @@
+package ui
+
+import (
+	"container/list"
+
+	"fyne.io/fyne/v2"
+)
+
+// maxCachedThumbnails is how many thumbnails a file browser keeps, so
+// browsing large photo folders doesn't use ever more memory.
+const maxCachedThumbnails = 200
+
+// thumbCache keeps the most recently used thumbnails by remote path, nil for
+// files that failed to load. It isn't safe for concurrent use.
+type thumbCache struct {
+	max   int
+	order *list.List // of *thumbEntry, most recently used first
+	items map[string]*list.Element
+}
+
+type thumbEntry struct {
+	path string
+	res  fyne.Resource
+}
+
+func newThumbCache(max int) *thumbCache {
+	return &thumbCache{max: max, order: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (c *thumbCache) get(path string) (fyne.Resource, bool) {
+	el, ok := c.items[path]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*thumbEntry).res, true
+}
+
+// put caches res for path, dropping the least recently used thumbnail if the
+// cache is full.
+func (c *thumbCache) put(path string, res fyne.Resource) {
+	if el, ok := c.items[path]; ok {
+		el.Value.(*thumbEntry).res = res
+		c.order.MoveToFront(el)
+		return
+	}
+	c.items[path] = c.order.PushFront(&thumbEntry{path: path, res: res})
+	if c.order.Len() > c.max {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*thumbEntry).path)
+	}
+}
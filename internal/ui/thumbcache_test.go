@@ -0,0 +1,29 @@
+package ui
+
+import (
+	"testing"
+
+	"fyne.io/fyne/v2"
+)
+
+func TestThumbCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newThumbCache(2)
+	a := fyne.NewStaticResource("a.jpg", []byte("a"))
+	c.put("/a.jpg", a)
+	c.put("/b.jpg", nil) // failed to load
+	c.get("/a.jpg")
+	c.put("/c.jpg", fyne.NewStaticResource("c.jpg", []byte("c")))
+
+	if _, ok := c.get("/b.jpg"); ok {
+		t.Error("least recently used thumbnail kept")
+	}
+	if res, ok := c.get("/a.jpg"); !ok || res != a {
+		t.Errorf("get(/a.jpg) = %v, %v; want the cached thumbnail", res, ok)
+	}
+	if _, ok := c.get("/c.jpg"); !ok {
+		t.Error("newest thumbnail dropped")
+	}
+	if n := len(c.items); n != 2 {
+		t.Errorf("%d thumbnails cached, want 2", n)
+	}
+}
@@ -0,0 +1,487 @@
+package ui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/data/binding"
+	"fyne.io/fyne/v2/theme"
+	"github.com/barishamil/kde-connect-fyne/internal/core"
+)
+
+type TransferDirection int
+
+const (
+	TransferDownload TransferDirection = iota
+	TransferUpload
+)
+
+func (d TransferDirection) Icon() fyne.Resource {
+	if d == TransferUpload {
+		return theme.UploadIcon()
+	}
+	return theme.DownloadIcon()
+}
+
+func (d TransferDirection) Arrow() string {
+	if d == TransferUpload {
+		return "↑"
+	}
+	return "↓"
+}
+
+func (d TransferDirection) activeStatus() string {
+	if d == TransferUpload {
+		return "Sending..."
+	}
+	return "Downloading..."
+}
+
+type TransferItem struct {
+	ID         string
+	Name       string
+	DeviceName string
+	Direction  TransferDirection
+	Progress   binding.Float
+	Status     binding.String
+	Rate       binding.String
+
+	// LocalPath is the file or folder on this computer, if any. Size, when
+	// set by the task, is the whole transfer's size; otherwise the last
+	// file's is recorded.
+	LocalPath string
+	Size      int64
+
+	finished time.Time // guarded by the manager's historyMu
+	temp     bool      // a download to a temporary file, left out of the history
+
+	cancel context.CancelFunc
+	active atomic.Bool
+	failed atomic.Bool // ended with an error or cancelled
+
+	// What Start was given, kept so the transfer can be retried
+	task   func(context.Context, *TransferItem) error
+	onDone func(error)
+
+	mu       sync.Mutex
+	done     int64
+	total    int64
+	samples  []rateSample
+	start    rateSample // first of this run, what the ETA is measured from
+	lastRate time.Time
+}
+
+type rateSample struct {
+	at    time.Time
+	bytes int64
+}
+
+// The rate is averaged over this window so it doesn't jitter.
+const rateWindow = 5 * time.Second
+
+// Cancel aborts the transfer if it supports cancellation.
+func (t *TransferItem) Cancel() {
+	if t.cancel != nil {
+		t.cancel()
+	}
+}
+
+func (t *TransferItem) Active() bool {
+	return t.active.Load()
+}
+
+// Failed reports whether the transfer ended without completing.
+func (t *TransferItem) Failed() bool {
+	return !t.active.Load() && t.failed.Load()
+}
+
+// SetBytes reports done out of total bytes, updating Progress and Rate.
+func (t *TransferItem) SetBytes(done, total int64) {
+	if total > 0 {
+		t.Progress.Set(float64(done) / float64(total))
+	}
+
+	t.mu.Lock()
+	now := time.Now()
+	if n := len(t.samples); n > 0 && done < t.samples[n-1].bytes {
+		// A file started over; start measuring afresh
+		t.samples = nil
+	}
+	if len(t.samples) == 0 {
+		t.start = rateSample{at: now, bytes: done}
+	}
+	t.done, t.total = done, total
+	if n := len(t.samples); n == 0 || now.Sub(t.samples[n-1].at) >= 200*time.Millisecond {
+		t.samples = append(t.samples, rateSample{at: now, bytes: done})
+	}
+	// Keep one sample older than the window as the baseline
+	for len(t.samples) > 2 && now.Sub(t.samples[1].at) > rateWindow {
+		t.samples = t.samples[1:]
+	}
+	update := now.Sub(t.lastRate) >= 500*time.Millisecond
+	if update {
+		t.lastRate = now
+	}
+	t.mu.Unlock()
+
+	if update {
+		t.Rate.Set(t.Speed())
+	}
+}
+
+// Speed returns the current rate and time remaining, e.g.
+// "3.2 MB/s — 12s left", or "" before there's enough data. The time remaining
+// uses the average rate of the whole transfer, which the pauses between the
+// files of a folder don't throw off the way they do the current rate.
+func (t *TransferItem) Speed() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.samples) < 2 {
+		return ""
+	}
+	first, last := t.samples[0], t.samples[len(t.samples)-1]
+	elapsed := last.at.Sub(first.at).Seconds()
+	if elapsed <= 0 {
+		return ""
+	}
+	rate := float64(last.bytes-first.bytes) / elapsed
+
+	speed := formatBytes(int64(rate)) + "/s"
+	if sinceStart := last.at.Sub(t.start.at).Seconds(); sinceStart > 0 && t.total > t.done {
+		if average := float64(last.bytes-t.start.bytes) / sinceStart; average > 0 {
+			eta := time.Duration(float64(t.total-t.done) / average * float64(time.Second))
+			speed += " — " + formatETA(eta) + " left"
+		}
+	}
+	return speed
+}
+
+func formatETA(d time.Duration) string {
+	d = d.Round(time.Second)
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm %02ds", int(d.Minutes()), int(d.Seconds())%60)
+	default:
+		return fmt.Sprintf("%dh %02dm", int(d.Hours()), int(d.Minutes())%60)
+	}
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+type TransferManager struct {
+	Transfers binding.UntypedList
+	OnChanged func()
+
+	engine    *core.Engine // where the history is kept, once loaded
+	historyMu sync.Mutex   // guards engine and the transfers' finished times
+}
+
+func NewTransferManager() *TransferManager {
+	tm := &TransferManager{
+		Transfers: binding.NewUntypedList(),
+	}
+	tm.Transfers.AddListener(binding.NewDataListener(func() {
+		if tm.OnChanged != nil {
+			tm.OnChanged()
+		}
+	}))
+	return tm
+}
+
+func (tm *TransferManager) Add(direction TransferDirection, deviceName, name string) *TransferItem {
+	item := tm.newItem(direction, deviceName, name)
+	item.Status.Set("Starting...")
+	tm.Transfers.Append(item)
+	return item
+}
+
+func (tm *TransferManager) newItem(direction TransferDirection, deviceName, name string) *TransferItem {
+	item := &TransferItem{
+		ID:         fmt.Sprintf("%d", time.Now().UnixNano()),
+		Name:       name,
+		DeviceName: deviceName,
+		Direction:  direction,
+		Progress:   binding.NewFloat(),
+		Status:     binding.NewString(),
+		Rate:       binding.NewString(),
+	}
+
+	// Add listener to progress/status to trigger OnChanged
+	item.Progress.AddListener(binding.NewDataListener(tm.notify))
+	item.Status.AddListener(binding.NewDataListener(tm.notify))
+	return item
+}
+
+// LoadHistory lists the transfers engine saved before this run, and saves
+// the history there from now on.
+func (tm *TransferManager) LoadHistory(engine *core.Engine) {
+	var items []interface{}
+	for _, r := range engine.TransferHistory() {
+		direction := TransferDownload
+		if r.Direction == "upload" {
+			direction = TransferUpload
+		}
+		item := tm.newItem(direction, r.Device, r.Name)
+		item.LocalPath = r.LocalPath
+		item.Size = r.Size
+		item.finished = r.Time
+		item.Status.Set(r.Status)
+		if r.Status == "Completed" {
+			item.Progress.Set(1.0)
+		} else {
+			item.failed.Store(true)
+		}
+		items = append(items, item)
+	}
+
+	tm.historyMu.Lock()
+	tm.engine = engine
+	tm.historyMu.Unlock()
+	current, _ := tm.Transfers.Get()
+	tm.Transfers.Set(append(items, current...))
+}
+
+// saveHistory writes the finished transfers still listed.
+func (tm *TransferManager) saveHistory() {
+	tm.historyMu.Lock()
+	defer tm.historyMu.Unlock()
+	if tm.engine == nil {
+		return
+	}
+
+	if err := tm.engine.SaveTransferHistory(tm.historyRecords()); err != nil {
+		fmt.Printf("Failed to save transfer history: %v\n", err)
+	}
+}
+
+// historyRecords returns the finished transfers to keep in the history. The
+// caller holds historyMu.
+func (tm *TransferManager) historyRecords() []core.TransferRecord {
+	items, _ := tm.Transfers.Get()
+	var records []core.TransferRecord
+	for _, it := range items {
+		item := it.(*TransferItem)
+		if item.Active() || item.temp || item.finished.IsZero() {
+			continue
+		}
+		status, _ := item.Status.Get()
+		size := item.Size
+		if size == 0 {
+			item.mu.Lock()
+			size = item.total
+			item.mu.Unlock()
+		}
+		direction := "download"
+		if item.Direction == TransferUpload {
+			direction = "upload"
+		}
+		records = append(records, core.TransferRecord{
+			Name:      item.Name,
+			Device:    item.DeviceName,
+			Direction: direction,
+			Size:      size,
+			Status:    status,
+			Time:      item.finished,
+			LocalPath: item.LocalPath,
+		})
+	}
+	return records
+}
+
+func (tm *TransferManager) notify() {
+	if tm.OnChanged != nil {
+		tm.OnChanged()
+	}
+}
+
+func (tm *TransferManager) GetActiveCount() int {
+	items, _ := tm.Transfers.Get()
+	count := 0
+	for _, it := range items {
+		if it.(*TransferItem).Active() {
+			count++
+		}
+	}
+	return count
+}
+
+func (tm *TransferManager) GetRecent(count int) []*TransferItem {
+	items, _ := tm.Transfers.Get()
+	var recent []*TransferItem
+	start := len(items) - count
+	if start < 0 {
+		start = 0
+	}
+	for i := len(items) - 1; i >= start; i-- {
+		recent = append(recent, items[i].(*TransferItem))
+	}
+	return recent
+}
+
+// Start runs task in the background as a cancellable transfer and tracks its
+// status. localPath is the file or folder on this computer, or "". onDone is
+// called with the task's result.
+func (tm *TransferManager) Start(direction TransferDirection, deviceName, name, localPath string, task func(context.Context, *TransferItem) error, onDone func(error)) *TransferItem {
+	return tm.start(tm.Add(direction, deviceName, name), localPath, task, onDone)
+}
+
+func (tm *TransferManager) start(item *TransferItem, localPath string, task func(context.Context, *TransferItem) error, onDone func(error)) *TransferItem {
+	item.LocalPath = localPath
+	item.task = task
+	item.onDone = onDone
+	tm.run(item)
+	return item
+}
+
+// Retry runs a failed or cancelled transfer's task again. Downloads resume
+// from what was already written.
+func (tm *TransferManager) Retry(item *TransferItem) {
+	if !item.Failed() || item.task == nil {
+		return
+	}
+	item.mu.Lock()
+	item.samples = nil
+	item.mu.Unlock()
+	tm.run(item)
+}
+
+// ClearFinished removes every transfer that isn't running.
+func (tm *TransferManager) ClearFinished() {
+	items, _ := tm.Transfers.Get()
+	var running []interface{}
+	for _, it := range items {
+		if it.(*TransferItem).Active() {
+			running = append(running, it)
+		}
+	}
+	tm.Transfers.Set(running)
+	tm.saveHistory()
+}
+
+// Filter returns the transfers keep accepts, as a list kept up to date until
+// stop is called.
+func (tm *TransferManager) Filter(keep func(*TransferItem) bool) (list binding.UntypedList, stop func()) {
+	list = binding.NewUntypedList()
+	listener := binding.NewDataListener(func() {
+		items, _ := tm.Transfers.Get()
+		var kept []interface{}
+		for _, it := range items {
+			if keep(it.(*TransferItem)) {
+				kept = append(kept, it)
+			}
+		}
+		list.Set(kept)
+	})
+	tm.Transfers.AddListener(listener)
+	return list, func() { tm.Transfers.RemoveListener(listener) }
+}
+
+func (tm *TransferManager) run(item *TransferItem) {
+	ctx, cancel := context.WithCancel(context.Background())
+	item.cancel = cancel
+	item.failed.Store(false)
+	item.active.Store(true)
+	item.Status.Set(item.Direction.activeStatus())
+
+	go func() {
+		defer cancel()
+		err := item.task(ctx, item)
+		tm.historyMu.Lock()
+		item.finished = time.Now()
+		tm.historyMu.Unlock()
+		item.failed.Store(err != nil)
+		item.active.Store(false)
+		switch {
+		case errors.Is(err, context.Canceled):
+			item.Status.Set("Cancelled")
+		case err != nil:
+			item.Status.Set("Error: " + err.Error())
+		default:
+			item.Status.Set("Completed")
+			item.Progress.Set(1.0)
+		}
+		item.Rate.Set("")
+		tm.saveHistory()
+		if item.onDone != nil {
+			item.onDone(err)
+		}
+	}()
+}
+
+func (tm *TransferManager) StartDownload(name string, task func(binding.Float) error, onDone func(error)) *TransferItem {
+	return tm.Start(TransferDownload, "", name, "", func(_ context.Context, item *TransferItem) error {
+		return task(item.Progress)
+	}, onDone)
+}
+
+// persistentDownloadPath returns where files opened from a device are kept.
+func persistentDownloadPath(name string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	downloadDir := filepath.Join(home, "kde-connect")
+	if err := os.MkdirAll(downloadDir, 0755); err != nil {
+		return "", err
+	}
+	// We no longer truncate the file here to support resuming.
+	// The task is responsible for opening the file correctly.
+	return filepath.Join(downloadDir, name), nil
+}
+
+func (tm *TransferManager) StartPersistentDownload(name string, task func(string, binding.Float) error, onDone func(string, error)) (string, *TransferItem, error) {
+	targetPath, err := persistentDownloadPath(name)
+	if err != nil {
+		return "", nil, err
+	}
+
+	item := tm.Start(TransferDownload, "", name, targetPath, func(_ context.Context, item *TransferItem) error {
+		return task(targetPath, item.Progress)
+	}, func(err error) {
+		if onDone != nil {
+			onDone(targetPath, err)
+		}
+	})
+	return targetPath, item, nil
+}
+
+func (tm *TransferManager) StartTempDownload(name, ext string, task func(string, binding.Float) error, onDone func(string, error)) (string, *TransferItem, error) {
+	tmpFile, err := os.CreateTemp("", "kdeconnect-*"+ext)
+	if err != nil {
+		return "", nil, err
+	}
+	tmpPath := tmpFile.Name()
+	tmpFile.Close()
+
+	item := tm.Add(TransferDownload, "", name)
+	item.temp = true
+	tm.start(item, tmpPath, func(_ context.Context, item *TransferItem) error {
+		return task(tmpPath, item.Progress)
+	}, func(err error) {
+		if onDone != nil {
+			onDone(tmpPath, err)
+		}
+	})
+	return tmpPath, item, nil
+}
@@ -0,0 +1,54 @@
+package ui
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"fyne.io/fyne/v2/data/binding"
+	"fyne.io/fyne/v2/test"
+)
+
+func TestFilterStops(t *testing.T) {
+	test.NewTempApp(t)
+	tm := NewTransferManager()
+	list, stop := tm.Filter(func(item *TransferItem) bool { return item.DeviceName == "Phone" })
+
+	tm.Add(TransferDownload, "Phone", "a.jpg")
+	tm.Add(TransferDownload, "Tablet", "b.jpg")
+	if n := list.Length(); n != 1 {
+		t.Fatalf("%d transfers listed, want 1", n)
+	}
+
+	stop()
+	tm.Add(TransferDownload, "Phone", "c.jpg")
+	if n := list.Length(); n != 1 {
+		t.Fatalf("%d transfers listed after stopping, want 1", n)
+	}
+}
+
+func TestHistorySkipsTempDownloads(t *testing.T) {
+	test.NewTempApp(t)
+	tm := NewTransferManager()
+	done := make(chan string, 2)
+	tm.Start(TransferDownload, "Phone", "a.jpg", "/home/a.jpg", func(context.Context, *TransferItem) error {
+		return nil
+	}, func(error) { done <- "a.jpg" })
+	tmpPath, _, err := tm.StartTempDownload("b.jpg", ".jpg", func(string, binding.Float) error {
+		return nil
+	}, func(string, error) { done <- "b.jpg" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpPath)
+	for i := 0; i < 2; i++ {
+		<-done
+	}
+
+	tm.historyMu.Lock()
+	records := tm.historyRecords()
+	tm.historyMu.Unlock()
+	if len(records) != 1 || records[0].Name != "a.jpg" || records[0].Time.IsZero() {
+		t.Fatalf("history = %+v, want only a.jpg", records)
+	}
+}
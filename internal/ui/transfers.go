@@ -0,0 +1,205 @@
+package ui
+
+import (
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/data/binding"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"github.com/barishamil/kde-connect-fyne/internal/lang"
+)
+
+// showTransfers opens the window listing every transfer, from all devices.
+func (a *App) showTransfers() {
+	if a.transfersWindow != nil {
+		a.transfersWindow.RequestFocus()
+		return
+	}
+
+	w := a.FyneApp.NewWindow(lang.T("transfers.title"))
+	a.transfersWindow = w
+	w.SetOnClosed(func() {
+		a.transfersWindow = nil
+	})
+
+	clearBtn := widget.NewButtonWithIcon(lang.T("transfers.clear"), theme.DeleteIcon(), a.Transfers.ClearFinished)
+	w.SetContent(container.NewBorder(
+		container.NewHBox(layout.NewSpacer(), clearBtn), nil, nil, nil,
+		a.newTransferList(a.Transfers.Transfers),
+	))
+	w.Resize(fyne.NewSize(480, 400))
+	w.Show()
+}
+
+// newTransferList lists the transfers in data, with a button on each to
+// cancel it while it runs, retry it once it has failed, or reveal a finished
+// download. Clicking a finished transfer shows its file in the file manager.
+func (a *App) newTransferList(data binding.UntypedList) *widget.List {
+	var list *widget.List
+	list = widget.NewListWithData(data,
+		func() fyne.CanvasObject {
+			return newTransferRow(a)
+		},
+		func(i binding.DataItem, o fyne.CanvasObject) {
+			item, _ := i.(binding.Untyped).Get()
+			o.(*transferRow).bind(item.(*TransferItem))
+		},
+	)
+	list.OnSelected = func(id widget.ListItemID) {
+		list.Unselect(id)
+		it, err := data.GetValue(id)
+		if err != nil {
+			return
+		}
+		if item := it.(*TransferItem); !item.Active() && !item.Failed() && item.LocalPath != "" {
+			a.revealFile(item.LocalPath)
+		}
+	}
+	return list
+}
+
+// revealLabel names revealFile's action the way the platform does.
+func revealLabel() string {
+	if runtime.GOOS == "darwin" {
+		return lang.T("transfers.show_in_finder")
+	}
+	return lang.T("transfers.show_in_folder")
+}
+
+// showDownloaded reports a finished download with msg, offering to reveal
+// localPath.
+func (a *App) showDownloaded(msg, localPath string) {
+	d := dialog.NewConfirm(lang.T("common.success"), msg, func(reveal bool) {
+		if reveal {
+			a.revealFile(localPath)
+		}
+	}, a.Window)
+	d.SetConfirmText(revealLabel())
+	d.SetDismissText(lang.T("common.ok"))
+	d.Show()
+}
+
+// revealFile shows p selected in the file manager where the platform allows,
+// and otherwise opens the folder it is in.
+func (a *App) revealFile(p string) {
+	if _, err := os.Stat(p); err != nil {
+		dialog.ShowError(err, a.Window)
+		return
+	}
+
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", "-R", p)
+	case "windows":
+		cmd = exec.Command("explorer", "/select,", p)
+	default:
+		u, _ := url.Parse(storage.NewFileURI(filepath.Dir(p)).String())
+		if err := a.FyneApp.OpenURL(u); err != nil {
+			dialog.ShowError(err, a.Window)
+		}
+		return
+	}
+	// explorer exits with 1 even when it works, so only failing to start
+	// counts
+	if err := cmd.Start(); err != nil {
+		dialog.ShowError(err, a.Window)
+		return
+	}
+	go cmd.Wait()
+}
+
+// transferRow shows one transfer. Rows are reused, so it follows the status
+// of whichever transfer it is bound to at the time.
+type transferRow struct {
+	widget.BaseWidget
+	app *App
+
+	content  *fyne.Container
+	icon     *widget.Icon
+	name     *widget.Label
+	status   *widget.Label
+	rate     *widget.Label
+	action   *widget.Button
+	progress *widget.ProgressBar
+
+	item     *TransferItem
+	listener binding.DataListener
+}
+
+func newTransferRow(app *App) *transferRow {
+	r := &transferRow{
+		app:      app,
+		icon:     widget.NewIcon(theme.DownloadIcon()),
+		name:     widget.NewLabel("filename"),
+		status:   widget.NewLabel("status"),
+		rate:     widget.NewLabel("rate"),
+		action:   widget.NewButtonWithIcon("", theme.CancelIcon(), nil),
+		progress: widget.NewProgressBar(),
+	}
+	r.name.Truncation = fyne.TextTruncateEllipsis
+	r.action.Importance = widget.LowImportance
+	r.content = container.NewVBox(
+		container.NewBorder(nil, nil, r.icon, container.NewHBox(r.status, r.rate, r.action), r.name),
+		r.progress,
+	)
+	r.ExtendBaseWidget(r)
+	return r
+}
+
+func (r *transferRow) CreateRenderer() fyne.WidgetRenderer {
+	return widget.NewSimpleRenderer(r.content)
+}
+
+func (r *transferRow) bind(item *TransferItem) {
+	if r.item != nil {
+		r.item.Status.RemoveListener(r.listener)
+	}
+	r.item = item
+
+	r.icon.SetResource(item.Direction.Icon())
+	if item.DeviceName != "" {
+		r.name.SetText(item.Name + " — " + item.DeviceName)
+	} else {
+		r.name.SetText(item.Name)
+	}
+	r.status.Bind(item.Status)
+	r.rate.Bind(item.Rate)
+	r.progress.Bind(item.Progress)
+
+	r.listener = binding.NewDataListener(r.updateAction)
+	item.Status.AddListener(r.listener)
+}
+
+func (r *transferRow) updateAction() {
+	item := r.item
+	switch {
+	case item.Active():
+		r.action.SetIcon(theme.CancelIcon())
+		r.action.OnTapped = item.Cancel
+		r.action.Show()
+	case item.Failed() && item.task != nil:
+		r.action.SetIcon(theme.ViewRefreshIcon())
+		r.action.OnTapped = func() {
+			r.app.Transfers.Retry(item)
+		}
+		r.action.Show()
+	case !item.Failed() && item.Direction == TransferDownload && item.LocalPath != "":
+		r.action.SetIcon(theme.FolderOpenIcon())
+		r.action.OnTapped = func() {
+			r.app.revealFile(item.LocalPath)
+		}
+		r.action.Show()
+	default:
+		r.action.Hide()
+	}
+}
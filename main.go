@@ -1,28 +1,107 @@
 package main
 
 import (
+	"flag"
 	"log"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
 
+	"github.com/barishamil/kde-connect-fyne/internal/control"
 	"github.com/barishamil/kde-connect-fyne/internal/core"
-	"github.com/barishamil/kde-connect-fyne/internal/ui"
 )
 
 func main() {
-	deviceName, _ := os.Hostname()
+	headless := flag.Bool("headless", !hasGUI, "run without the GUI, controlled through the control socket")
+	controlPath := flag.String("control", "", "control socket path for -headless (default: control.sock in the config directory)")
+	trust := flag.String("trust", "", "comma-separated certificate fingerprints (SHA-256) whose pair requests are accepted automatically in -headless")
+	port := flag.Int("port", 0, "TCP port to listen on, instead of the one picked from 1716-1764")
+	name := flag.String("name", "", "device name shown to other devices (default: the hostname)")
+	configDir := flag.String("config-dir", "", "directory for the config and certificate (default: $KDECONNECT_FYNE_CONFIG_DIR or kde-connect-fyne in the user config directory)")
+	flag.Parse()
+
+	if *port < 0 || *port > 65535 {
+		log.Fatalf("Invalid -port %d: must be between 1 and 65535", *port)
+	}
+
+	deviceName := *name
+	if deviceName == "" {
+		deviceName, _ = os.Hostname()
+	}
 	if deviceName == "" {
 		deviceName = "Fyne Client"
 	}
 
-	engine, err := core.NewEngine(deviceName)
+	var engine *core.Engine
+	var err error
+	if *configDir != "" {
+		engine, err = core.NewEngineWithConfigDir(deviceName, *configDir)
+	} else {
+		engine, err = core.NewEngine(deviceName)
+	}
 	if err != nil {
 		log.Fatalf("Failed to initialize engine: %v", err)
 	}
+	if *port != 0 {
+		if err := engine.SetListenPort(*port); err != nil {
+			log.Fatalf("Failed to use -port: %v", err)
+		}
+	}
 
-	app := ui.NewApp(engine)
+	if *headless {
+		path := *controlPath
+		if path == "" {
+			path = filepath.Join(engine.ConfigDir(), "control.sock")
+		}
+		var trusted []string
+		if *trust != "" {
+			trusted = strings.Split(*trust, ",")
+		}
+		runHeadless(engine, path, trusted)
+	} else {
+		runGUI(engine)
+	}
+
+	engine.Stop()
+	if err := engine.FlushConfig(); err != nil {
+		log.Printf("Failed to save config: %v", err)
+	}
+}
+
+// runHeadless serves the control socket, and the event stream next to it on
+// events.sock, until interrupted.
+func runHeadless(engine *core.Engine, socketPath string, trusted []string) {
+	l, err := control.Listen(socketPath)
+	if err != nil {
+		log.Fatalf("Failed to open control socket: %v", err)
+	}
+	defer os.Remove(socketPath)
+
+	srv := control.NewServer(engine, trusted)
+	defer srv.Close()
+	go func() {
+		if err := srv.Serve(l); err != nil {
+			log.Printf("Control socket stopped: %v", err)
+		}
+	}()
+
+	eventsPath := filepath.Join(filepath.Dir(socketPath), "events.sock")
+	events, err := control.Listen(eventsPath)
+	if err != nil {
+		log.Fatalf("Failed to open event socket: %v", err)
+	}
+	defer os.Remove(eventsPath)
+	engine.StartEventStream(events)
 
 	engine.Start()
 
-	log.Printf("KDE Connect client started with ID %s\n", engine.Identity.DeviceId)
-	app.Run()
+	log.Printf("KDE Connect client started headless with ID %s, control socket at %s\n", engine.Identity.DeviceId, socketPath)
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	<-sig
+	l.Close()
+	events.Close()
 }